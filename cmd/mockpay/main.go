@@ -0,0 +1,60 @@
+// Command mockpay plays the role of the mock payment provider during local
+// testing by sending a signed webhook for a pending topup, e.g.
+//
+//	go run ./cmd/mockpay -id mock_0123abcd -status settled
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"main/config"
+	"main/helper"
+	"net/http"
+)
+
+func main() {
+	url := flag.String("url", "http://localhost:8080/payments/webhook", "webhook endpoint of the server")
+	externalID := flag.String("id", "", "external ID of the payment, as returned by the topup endpoint")
+	status := flag.String("status", helper.PaymentSettled, "settled, failed or expired")
+	reason := flag.String("reason", "", "failure reason sent with failed or expired payments")
+	flag.Parse()
+
+	if *externalID == "" {
+		log.Fatal("-id is required")
+	}
+
+	body, err := json.Marshal(map[string]string{
+		"external_id": *externalID,
+		"status":      *status,
+		"reason":      *reason,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	paymentConfig := config.GetPaymentConfig()
+	if paymentConfig.MockWebhookSecret == "" {
+		log.Fatal("MOCK_PAYMENT_SECRET is not set")
+	}
+	secret := []byte(paymentConfig.MockWebhookSecret)
+	req, err := http.NewRequest(http.MethodPost, *url, bytes.NewReader(body))
+	if err != nil {
+		log.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(helper.MockSignatureHeader, hex.EncodeToString(helper.SignMockWebhook(secret, body)))
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	response, _ := io.ReadAll(resp.Body)
+	fmt.Println(resp.Status, string(response))
+}
@@ -0,0 +1,94 @@
+// Command purchaseload fires many parallel purchases of one product at a
+// running server and checks that stock was never oversold, e.g.
+//
+//	go run ./cmd/purchaseload -token "$TOKEN" -product 1 -n 50
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+)
+
+func main() {
+	baseURL := flag.String("url", "http://localhost:8080", "base URL of the server")
+	token := flag.String("token", "", "token of the customer making the purchases")
+	productID := flag.Uint("product", 0, "ID of the product to buy")
+	quantity := flag.Int("quantity", 1, "quantity bought by each request")
+	n := flag.Int("n", 50, "number of parallel purchases")
+	flag.Parse()
+
+	if *token == "" || *productID == 0 {
+		log.Fatal("-token and -product are required")
+	}
+
+	before := productStock(*baseURL, *token, *productID)
+
+	body, _ := json.Marshal(map[string]interface{}{"product_id": *productID, "quantity": *quantity})
+	statuses := make(chan int, *n)
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < *n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			req, _ := http.NewRequest(http.MethodPost, *baseURL+"/transactions", bytes.NewReader(body))
+			req.Header.Set("Authorization", *token)
+			req.Header.Set("Content-Type", "application/json")
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				log.Println("request failed:", err)
+				statuses <- 0
+				return
+			}
+			resp.Body.Close()
+			statuses <- resp.StatusCode
+		}()
+	}
+	close(start)
+	wg.Wait()
+	close(statuses)
+
+	counts := map[int]int{}
+	for status := range statuses {
+		counts[status]++
+	}
+	after := productStock(*baseURL, *token, *productID)
+
+	sold := counts[http.StatusCreated] * *quantity
+	fmt.Printf("responses: %v\n", counts)
+	fmt.Printf("stock before %d, after %d, sold %d\n", before, after, sold)
+	if after < 0 || before-after != sold {
+		fmt.Println("FAIL: stock does not match the successful purchases")
+		os.Exit(1)
+	}
+	fmt.Println("OK")
+}
+
+func productStock(baseURL, token string, productID uint) int {
+	req, _ := http.NewRequest(http.MethodGet, fmt.Sprintf("%s/products/%d", baseURL, productID), nil)
+	req.Header.Set("Authorization", token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		log.Fatalf("product %d not found", productID)
+	}
+
+	var product struct {
+		Stock int `json:"stock"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&product); err != nil {
+		log.Fatal("Failed to decode product: ", err)
+	}
+	return product.Stock
+}
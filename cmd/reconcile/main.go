@@ -0,0 +1,82 @@
+// Command reconcile replays every user's wallet ledger and reports users whose
+// stored balance or journal account has drifted from it, and journal entries
+// that do not balance. With -fix, users created before the ledger existed get
+// an opening entry and drifted cached balances are reset to the ledger
+// balance. Broken ledger chains and journal differences are only reported.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"main/config"
+	"main/helper"
+	"main/models"
+	"os"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+func main() {
+	fix := flag.Bool("fix", false, "repair drifted balances instead of only reporting them")
+	flag.Parse()
+
+	dbConfig := config.GetDbConfig()
+	db, err := gorm.Open(postgres.Open(dbConfig.GetDBURL()), &gorm.Config{})
+	if err != nil {
+		log.Fatal("Failed to connect database", err)
+	}
+
+	var users []models.User
+	if err := db.Order("id").Find(&users).Error; err != nil {
+		log.Fatal("Failed to fetch users", err)
+	}
+
+	drifted := 0
+	for _, user := range users {
+		report, err := helper.VerifyWallet(db, user)
+		if err != nil {
+			log.Fatal("Failed to verify wallet of user ", user.ID, ": ", err)
+		}
+		if !report.Drifted() {
+			continue
+		}
+
+		drifted++
+		fmt.Printf("user %d: stored balance %d, ledger balance %d over %d entries, journal balance %d",
+			report.UserID, report.StoredBalance, report.LedgerBalance, report.Entries, report.JournalBalance)
+		if report.BrokenSequence != 0 {
+			fmt.Printf(", chain broken at entry %d", report.BrokenSequence)
+		}
+		fmt.Println()
+
+		if !*fix || report.BrokenSequence != 0 || (report.Entries > 0 && report.JournalBalance != report.LedgerBalance) {
+			continue
+		}
+		err = db.Transaction(func(tx *gorm.DB) error {
+			if report.Entries == 0 {
+				return helper.OpenWalletLedger(tx, user.ID)
+			}
+			return tx.Model(&user).UpdateColumn("balance", report.LedgerBalance).Error
+		})
+		if err != nil {
+			log.Fatal("Failed to fix wallet of user ", user.ID, ": ", err)
+		}
+		fmt.Printf("user %d: fixed\n", user.ID)
+	}
+
+	fmt.Printf("%d of %d wallets drifted\n", drifted, len(users))
+
+	unbalanced, err := helper.UnbalancedJournalEntries(db)
+	if err != nil {
+		log.Fatal("Failed to check journal", err)
+	}
+	for _, id := range unbalanced {
+		fmt.Printf("journal entry %d does not balance\n", id)
+	}
+
+	if (drifted > 0 && !*fix) || len(unbalanced) > 0 {
+		os.Exit(1)
+	}
+}
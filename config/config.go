@@ -1,6 +1,11 @@
 package config
 
-import "fmt"
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
 
 type DBConfig struct {
 	Host     string
@@ -26,3 +31,245 @@ func (config *DBConfig) GetDBURL() string {
 		config.Host, config.Port, config.User, config.DBName, config.Password,
 	)
 }
+
+type PasswordPolicyConfig struct {
+	MinLength     int
+	MaxLength     int
+	RequireUpper  bool
+	RequireLower  bool
+	RequireDigit  bool
+	RequireSymbol bool
+	// BreachedPasswordsFile optionally points to a newline separated list of
+	// passwords to reject on top of the bundled common password list.
+	BreachedPasswordsFile string
+	ResetTokenTTL         time.Duration
+}
+
+func GetPasswordPolicyConfig() *PasswordPolicyConfig {
+	return &PasswordPolicyConfig{
+		MinLength:             8,
+		MaxLength:             72, // bcrypt ignores anything past 72 bytes
+		RequireUpper:          true,
+		RequireLower:          true,
+		RequireDigit:          true,
+		RequireSymbol:         false,
+		BreachedPasswordsFile: os.Getenv("BREACHED_PASSWORDS_FILE"),
+		ResetTokenTTL:         time.Hour,
+	}
+}
+
+type MailConfig struct {
+	// Provider is "smtp" to send emails or "noop" to drop them in development.
+	Provider string
+	SMTPAddr string // host:port
+	Username string
+	Password string
+	From     string
+}
+
+func GetMailConfig() *MailConfig {
+	provider := os.Getenv("MAIL_PROVIDER")
+	if provider == "" {
+		provider = "noop"
+	}
+	return &MailConfig{
+		Provider: provider,
+		SMTPAddr: os.Getenv("SMTP_ADDR"),
+		Username: os.Getenv("SMTP_USERNAME"),
+		Password: os.Getenv("SMTP_PASSWORD"),
+		From:     os.Getenv("MAIL_FROM"),
+	}
+}
+
+type PaymentConfig struct {
+	// Provider selects the PaymentProvider used for topups.
+	Provider string
+	// MockWebhookSecret signs the webhooks of the mock provider. It has no
+	// default: anyone who knows it can credit any wallet.
+	MockWebhookSecret string
+	IntentTTL         time.Duration
+	SweepInterval     time.Duration
+}
+
+// GetPaymentConfig reads the provider from PAYMENT_PROVIDER and its secret
+// from the environment. Check it with Validate before use.
+func GetPaymentConfig() *PaymentConfig {
+	return &PaymentConfig{
+		Provider:          os.Getenv("PAYMENT_PROVIDER"),
+		MockWebhookSecret: os.Getenv("MOCK_PAYMENT_SECRET"),
+		IntentTTL:         30 * time.Minute,
+		SweepInterval:     time.Minute,
+	}
+}
+
+// Validate reports a missing provider or webhook secret.
+func (config *PaymentConfig) Validate() error {
+	switch config.Provider {
+	case "":
+		return fmt.Errorf("PAYMENT_PROVIDER is not set")
+	case "mock":
+		if config.MockWebhookSecret == "" {
+			return fmt.Errorf("MOCK_PAYMENT_SECRET is not set")
+		}
+	}
+	return nil
+}
+
+type IdempotencyConfig struct {
+	// Window is how long a stored response is replayed for its key.
+	Window time.Duration
+	// ProcessingLease is how long a key is held for a request that has not
+	// answered yet. A server killed mid request frees its keys after this.
+	ProcessingLease time.Duration
+	SweepInterval   time.Duration
+}
+
+func GetIdempotencyConfig() *IdempotencyConfig {
+	return &IdempotencyConfig{
+		Window:          24 * time.Hour,
+		ProcessingLease: 5 * time.Minute,
+		SweepInterval:   time.Hour,
+	}
+}
+
+type RefundConfig struct {
+	// CustomerWindow is how long after a purchase customers may refund it
+	// themselves. Zero disables customer refunds; admins can always refund.
+	CustomerWindow time.Duration
+}
+
+func GetRefundConfig() *RefundConfig {
+	return &RefundConfig{
+		CustomerWindow: 7 * 24 * time.Hour,
+	}
+}
+
+type OrderConfig struct {
+	// CustomerCancelWindow is how long after ordering customers may cancel an
+	// order that has not shipped. Admins can cancel unshipped orders any time.
+	CustomerCancelWindow time.Duration
+}
+
+func GetOrderConfig() *OrderConfig {
+	return &OrderConfig{
+		CustomerCancelWindow: 24 * time.Hour,
+	}
+}
+
+// StoreConfig holds the seller details printed on invoices.
+type StoreConfig struct {
+	Name    string
+	Address string
+	Email   string
+	TaxID   string
+}
+
+func GetStoreConfig() *StoreConfig {
+	return &StoreConfig{
+		Name:    "Toko Belanja",
+		Address: "Jl. Jenderal Sudirman No. 1, Jakarta 10220",
+		Email:   "finance@tokobelanja.id",
+		TaxID:   "NPWP 00.000.000.0-000.000",
+	}
+}
+
+type TaxConfig struct {
+	// Name is printed on receipts, e.g. PPN.
+	Name string
+	// DefaultRate applies to categories without a tax class, in basis points
+	// (1100 is 11%).
+	DefaultRate int
+	// PricesIncludeTax says whether product prices already contain the tax
+	// or have it added on top at checkout.
+	PricesIncludeTax bool
+}
+
+func GetTaxConfig() *TaxConfig {
+	return &TaxConfig{
+		Name:             "PPN",
+		DefaultRate:      1100,
+		PricesIncludeTax: os.Getenv("PRICES_INCLUDE_TAX") == "true",
+	}
+}
+
+type LoyaltyConfig struct {
+	// SpendPerPoint is how much has to be spent on products, before tax, in
+	// the base currency to earn one point.
+	SpendPerPoint int
+	// PointValue is the discount one point is worth in the base currency.
+	PointValue int
+	// MaxRedeemPercent caps the share of a purchase that points can pay for.
+	MaxRedeemPercent int
+	ExpiresAfter     time.Duration
+	SweepInterval    time.Duration
+}
+
+func GetLoyaltyConfig() *LoyaltyConfig {
+	return &LoyaltyConfig{
+		SpendPerPoint:    10000,
+		PointValue:       100,
+		MaxRedeemPercent: 50,
+		ExpiresAfter:     365 * 24 * time.Hour,
+		SweepInterval:    time.Hour,
+	}
+}
+
+type ReservationConfig struct {
+	// TTL is how long stock is held once checkout starts.
+	TTL           time.Duration
+	SweepInterval time.Duration
+}
+
+func GetReservationConfig() *ReservationConfig {
+	return &ReservationConfig{
+		TTL:           15 * time.Minute,
+		SweepInterval: time.Minute,
+	}
+}
+
+type GiftCardConfig struct {
+	// MaxBatch caps how many cards one request may generate.
+	MaxBatch int
+	// MaxFailedAttempts wrong codes within AttemptWindow lock a user or IP
+	// out of redeeming until the window has passed.
+	MaxFailedAttempts int
+	AttemptWindow     time.Duration
+}
+
+func GetGiftCardConfig() *GiftCardConfig {
+	return &GiftCardConfig{
+		MaxBatch:          1000,
+		MaxFailedAttempts: 5,
+		AttemptWindow:     15 * time.Minute,
+	}
+}
+
+type SubscriptionConfig struct {
+	// SweepInterval is how often due subscriptions are looked for.
+	SweepInterval time.Duration
+}
+
+func GetSubscriptionConfig() *SubscriptionConfig {
+	return &SubscriptionConfig{
+		SweepInterval: 5 * time.Minute,
+	}
+}
+
+type ServerConfig struct {
+	// TrustedProxies are the addresses or CIDRs of proxies whose
+	// X-Forwarded-For header is believed. Without any, the client IP is
+	// always the address of the connection, so it cannot be spoofed.
+	TrustedProxies []string
+}
+
+// GetServerConfig reads the trusted proxies as a comma separated list from
+// TRUSTED_PROXIES.
+func GetServerConfig() *ServerConfig {
+	var proxies []string
+	for _, proxy := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			proxies = append(proxies, proxy)
+		}
+	}
+	return &ServerConfig{TrustedProxies: proxies}
+}
@@ -0,0 +1,258 @@
+package handlers
+
+import (
+	"main/helper"
+	"main/models"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type AddressInput struct {
+	Label         string `json:"label" validate:"max=50"`
+	RecipientName string `json:"recipient_name" validate:"required"`
+	Phone         string `json:"phone" validate:"required,max=20"`
+	Street        string `json:"street" validate:"required"`
+	City          string `json:"city" validate:"required"`
+	Province      string `json:"province" validate:"required"`
+	PostalCode    string `json:"postal_code" validate:"required,max=10"`
+	IsDefault     bool   `json:"is_default"`
+}
+
+func (input AddressInput) apply(address *models.Address) {
+	address.Label = input.Label
+	address.RecipientName = input.RecipientName
+	address.Phone = input.Phone
+	address.Street = input.Street
+	address.City = input.City
+	address.Province = helper.NormalizeProvince(input.Province)
+	address.PostalCode = input.PostalCode
+}
+
+func addressResponse(address models.Address) map[string]interface{} {
+	return map[string]interface{}{
+		"id":             address.ID,
+		"label":          address.Label,
+		"recipient_name": address.RecipientName,
+		"phone":          address.Phone,
+		"street":         address.Street,
+		"city":           address.City,
+		"province":       address.Province,
+		"postal_code":    address.PostalCode,
+		"is_default":     address.IsDefault,
+		"created_at":     address.CreatedAt,
+		"updated_at":     address.UpdatedAt,
+	}
+}
+
+// makeDefaultAddress clears the default flag on the user's other addresses
+// and sets it on addressID.
+func makeDefaultAddress(tx *gorm.DB, userID uint, addressID uint) error {
+	err := tx.Model(&models.Address{}).
+		Where("user_id = ? AND id <> ?", userID, addressID).
+		Update("is_default", false).Error
+	if err != nil {
+		return err
+	}
+	return tx.Model(&models.Address{}).Where("id = ?", addressID).Update("is_default", true).Error
+}
+
+func GetAddresses(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, exists := c.Get("userID")
+		if !exists {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "User detail not found"})
+			return
+		}
+
+		var addresses []models.Address
+		if err := db.Where("user_id = ?", userID).Order("is_default DESC, id").Find(&addresses).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch addresses"})
+			return
+		}
+
+		transformedAddresses := make([]map[string]interface{}, len(addresses))
+		for i, address := range addresses {
+			transformedAddresses[i] = addressResponse(address)
+		}
+		c.JSON(http.StatusOK, transformedAddresses)
+	}
+}
+
+func CreateAddress(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userIDParam, exists := c.Get("userID")
+		if !exists {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "User detail not found"})
+			return
+		}
+		userID := userIDParam.(uint)
+
+		var input AddressInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := helper.Validate(input); err != nil {
+			c.JSON(http.StatusBadRequest, err)
+			return
+		}
+
+		address := models.Address{UserID: userID}
+		input.apply(&address)
+
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Create(&address).Error; err != nil {
+				return err
+			}
+
+			// The first address always becomes the default one
+			var count int64
+			if err := tx.Model(&models.Address{}).Where("user_id = ?", userID).Count(&count).Error; err != nil {
+				return err
+			}
+			if input.IsDefault || count == 1 {
+				address.IsDefault = true
+				return makeDefaultAddress(tx, userID, address.ID)
+			}
+			return nil
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create address"})
+			return
+		}
+
+		c.JSON(http.StatusCreated, addressResponse(address))
+	}
+}
+
+func UpdateAddress(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userIDParam, exists := c.Get("userID")
+		if !exists {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "User detail not found"})
+			return
+		}
+		userID := userIDParam.(uint)
+
+		id, err := strconv.ParseUint(c.Param("addressId"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid address ID"})
+			return
+		}
+
+		var address models.Address
+		if err := db.Where("user_id = ?", userID).First(&address, id).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Address not found"})
+			return
+		}
+
+		var input AddressInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := helper.Validate(input); err != nil {
+			c.JSON(http.StatusBadRequest, err)
+			return
+		}
+
+		input.apply(&address)
+		err = db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Save(&address).Error; err != nil {
+				return err
+			}
+			if input.IsDefault && !address.IsDefault {
+				address.IsDefault = true
+				return makeDefaultAddress(tx, userID, address.ID)
+			}
+			return nil
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update address"})
+			return
+		}
+
+		c.JSON(http.StatusOK, addressResponse(address))
+	}
+}
+
+func SetDefaultAddress(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userIDParam, exists := c.Get("userID")
+		if !exists {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "User detail not found"})
+			return
+		}
+		userID := userIDParam.(uint)
+
+		id, err := strconv.ParseUint(c.Param("addressId"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid address ID"})
+			return
+		}
+
+		var address models.Address
+		if err := db.Where("user_id = ?", userID).First(&address, id).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Address not found"})
+			return
+		}
+
+		if err := db.Transaction(func(tx *gorm.DB) error { return makeDefaultAddress(tx, userID, address.ID) }); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update address"})
+			return
+		}
+		address.IsDefault = true
+
+		c.JSON(http.StatusOK, addressResponse(address))
+	}
+}
+
+func DeleteAddress(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userIDParam, exists := c.Get("userID")
+		if !exists {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "User detail not found"})
+			return
+		}
+		userID := userIDParam.(uint)
+
+		id, err := strconv.ParseUint(c.Param("addressId"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid address ID"})
+			return
+		}
+
+		var address models.Address
+		if err := db.Where("user_id = ?", userID).First(&address, id).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Address not found"})
+			return
+		}
+
+		err = db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Delete(&address).Error; err != nil {
+				return err
+			}
+			if !address.IsDefault {
+				return nil
+			}
+
+			// Hand the default over to the oldest remaining address
+			var next models.Address
+			if err := tx.Where("user_id = ?", userID).Order("id").Limit(1).Find(&next).Error; err != nil || next.ID == 0 {
+				return err
+			}
+			return makeDefaultAddress(tx, userID, next.ID)
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete address"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Address has been successfully deleted"})
+	}
+}
@@ -0,0 +1,402 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"main/config"
+	"main/helper"
+	"main/models"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type CartItemInput struct {
+	ProductID uint `json:"product_id" validate:"required"`
+	Quantity  int  `json:"quantity" validate:"required,min=1"`
+}
+
+type UpdateCartItemInput struct {
+	Quantity int `json:"quantity" validate:"required,min=1"`
+}
+
+func GetCart(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userIDParam, exists := c.Get("userID")
+		if !exists {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "User detail not found"})
+			return
+		}
+
+		var items []models.CartItem
+		if err := db.Joins("Product").Where("cart_items.user_id = ?", userIDParam).Order("cart_items.id").Find(&items).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch cart"})
+			return
+		}
+
+		sales, err := helper.ActiveSales(db, time.Now())
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch sales"})
+			return
+		}
+
+		// Stock the user holds counts as available to them
+		var reservations []models.Reservation
+		err = db.Where("user_id = ? AND status = ? AND expires_at > ?", userIDParam, helper.ReservationActive, time.Now()).
+			Find(&reservations).Error
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch reservations"})
+			return
+		}
+		reserved := make(map[uint]int)
+		var reservedUntil *time.Time
+		for i, reservation := range reservations {
+			reserved[reservation.ProductID] += reservation.Quantity
+			if reservedUntil == nil || reservation.ExpiresAt.Before(*reservedUntil) {
+				reservedUntil = &reservations[i].ExpiresAt
+			}
+		}
+
+		subtotal := models.NewMoney(0, models.BaseCurrency)
+		transformedItems := make([]map[string]interface{}, len(items))
+		for i, item := range items {
+			unitPrice, sale := sales.Price(item.Product)
+			lineTotal, err := helper.ConvertMoney(db, unitPrice.Mul(item.Quantity), models.BaseCurrency)
+			if err != nil {
+				c.JSON(http.StatusServiceUnavailable, gin.H{"error": "The product currency cannot be converted right now"})
+				return
+			}
+			subtotal = subtotal.Add(lineTotal)
+
+			transformedItems[i] = map[string]interface{}{
+				"product_id":    item.ProductID,
+				"title":         item.Product.Title,
+				"quantity":      item.Quantity,
+				"list_price":    item.Product.PriceMoney(),
+				"unit_price":    unitPrice,
+				"sale":          saleResponse(sale),
+				"line_total":    lineTotal,
+				"in_stock":      item.Quantity <= item.Product.AvailableStock()+reserved[item.ProductID],
+				"current_stock": item.Product.AvailableStock() + reserved[item.ProductID],
+				"reserved":      reserved[item.ProductID],
+			}
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"items":          transformedItems,
+			"subtotal":       subtotal,
+			"reserved_until": reservedUntil,
+		})
+	}
+}
+
+func AddCartItem(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userIDParam, exists := c.Get("userID")
+		if !exists {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "User detail not found"})
+			return
+		}
+
+		var input CartItemInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := helper.Validate(input); err != nil {
+			c.JSON(http.StatusBadRequest, err)
+			return
+		}
+
+		var product models.Product
+		if err := db.First(&product, input.ProductID).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+			return
+		}
+
+		// Adding a product that is already in the cart increases its quantity
+		item := models.CartItem{
+			UserID:    userIDParam.(uint),
+			ProductID: input.ProductID,
+			Quantity:  input.Quantity,
+		}
+		err := db.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "user_id"}, {Name: "product_id"}},
+			DoUpdates: clause.Assignments(map[string]interface{}{"quantity": gorm.Expr("cart_items.quantity + ?", input.Quantity), "updated_at": gorm.Expr("CURRENT_TIMESTAMP")}),
+		}).Create(&item).Error
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add product to cart"})
+			return
+		}
+
+		c.JSON(http.StatusCreated, gin.H{"message": "Product has been added to your cart"})
+	}
+}
+
+func UpdateCartItem(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userIDParam, exists := c.Get("userID")
+		if !exists {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "User detail not found"})
+			return
+		}
+
+		productID, err := strconv.ParseUint(c.Param("productId"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+			return
+		}
+
+		var input UpdateCartItemInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := helper.Validate(input); err != nil {
+			c.JSON(http.StatusBadRequest, err)
+			return
+		}
+
+		result := db.Model(&models.CartItem{}).
+			Where("user_id = ? AND product_id = ?", userIDParam, productID).
+			Update("quantity", input.Quantity)
+		if result.Error != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update cart"})
+			return
+		}
+		if result.RowsAffected == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Product is not in your cart"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Your cart has been successfully updated"})
+	}
+}
+
+func RemoveCartItem(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userIDParam, exists := c.Get("userID")
+		if !exists {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "User detail not found"})
+			return
+		}
+
+		productID, err := strconv.ParseUint(c.Param("productId"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+			return
+		}
+
+		result := db.Where("user_id = ? AND product_id = ?", userIDParam, productID).Delete(&models.CartItem{})
+		if result.Error != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update cart"})
+			return
+		}
+		if result.RowsAffected == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Product is not in your cart"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Product has been removed from your cart"})
+	}
+}
+
+var errEmptyCart = errors.New("cart is empty")
+
+// StartCheckout holds the stock of everything in the cart for the
+// reservation TTL, so it cannot be bought by someone else while the customer
+// pays. Starting again renews the hold.
+func StartCheckout(db *gorm.DB, ttl time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userIDParam, exists := c.Get("userID")
+		if !exists {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "User detail not found"})
+			return
+		}
+
+		userID, ok := userIDParam.(uint)
+		if !ok {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID"})
+			return
+		}
+
+		var reservations []models.Reservation
+		err := db.Transaction(func(tx *gorm.DB) error {
+			var items []models.CartItem
+			if err := tx.Where("user_id = ?", userID).Find(&items).Error; err != nil {
+				return err
+			}
+			if len(items) == 0 {
+				return errEmptyCart
+			}
+
+			lines := make([]helper.PurchaseLine, len(items))
+			for i, item := range items {
+				lines[i] = helper.PurchaseLine{ProductID: item.ProductID, Quantity: item.Quantity}
+			}
+
+			var err error
+			reservations, err = helper.ReserveStock(tx, userID, lines, time.Now(), ttl)
+			return err
+		})
+		if errors.Is(err, errEmptyCart) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Your cart is empty"})
+			return
+		}
+		if err != nil {
+			respondPurchaseError(c, err)
+			return
+		}
+
+		// Backordered and preordered lines have nothing on the shelf to hold
+		var reservedUntil *time.Time
+		if len(reservations) > 0 {
+			reservedUntil = &reservations[0].ExpiresAt
+		}
+		c.JSON(http.StatusCreated, gin.H{
+			"message":        "The products in your cart are reserved for you",
+			"reservations":   reservations,
+			"reserved_until": reservedUntil,
+		})
+	}
+}
+
+// CancelCheckout gives back the stock held for the user's checkout.
+func CancelCheckout(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userIDParam, exists := c.Get("userID")
+		if !exists {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "User detail not found"})
+			return
+		}
+
+		userID, ok := userIDParam.(uint)
+		if !ok {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID"})
+			return
+		}
+
+		err := db.Transaction(func(tx *gorm.DB) error {
+			return helper.ReleaseUserReservations(tx, userID, time.Now())
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to release reservations"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Your reserved products have been released"})
+	}
+}
+
+type CheckoutInput struct {
+	AddressID    uint   `json:"address_id"`
+	CouponCode   string `json:"coupon_code" validate:"max=64"`
+	RedeemPoints int    `json:"redeem_points" validate:"min=0"`
+}
+
+func CheckoutCart(db *gorm.DB, taxConfig *config.TaxConfig, loyaltyConfig *config.LoyaltyConfig) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userIDParam, exists := c.Get("userID")
+		if !exists {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "User detail not found"})
+			return
+		}
+
+		userID, ok := userIDParam.(uint)
+		if !ok {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID"})
+			return
+		}
+
+		var input CheckoutInput
+		if err := c.ShouldBindJSON(&input); err != nil && !errors.Is(err, io.EOF) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := helper.Validate(input); err != nil {
+			c.JSON(http.StatusBadRequest, err)
+			return
+		}
+
+		// Every line is bought in one database transaction so the order
+		// either goes through completely or not at all.
+		var result *helper.PurchaseResult
+		err := db.Transaction(func(tx *gorm.DB) error {
+			var items []models.CartItem
+			if err := tx.Where("user_id = ?", userID).Find(&items).Error; err != nil {
+				return err
+			}
+			if len(items) == 0 {
+				return errEmptyCart
+			}
+
+			lines := make([]helper.PurchaseLine, len(items))
+			for i, item := range items {
+				lines[i] = helper.PurchaseLine{ProductID: item.ProductID, Quantity: item.Quantity}
+			}
+
+			var err error
+			result, err = helper.Purchase(tx, helper.PurchaseRequest{
+				UserID:       userID,
+				Lines:        lines,
+				AddressID:    input.AddressID,
+				CouponCode:   input.CouponCode,
+				RedeemPoints: input.RedeemPoints,
+				Tax:          taxConfig,
+				Loyalty:      loyaltyConfig,
+			})
+			if err != nil {
+				return err
+			}
+			return tx.Where("user_id = ?", userID).Delete(&models.CartItem{}).Error
+		})
+		if errors.Is(err, errEmptyCart) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Your cart is empty"})
+			return
+		}
+		if err != nil {
+			respondPurchaseError(c, err)
+			return
+		}
+
+		items := make([]gin.H, len(result.Transactions))
+		for i, transaction := range result.Transactions {
+			items[i] = gin.H{
+				"product_title":        result.Products[i].Title,
+				"quantity":             transaction.Quantity,
+				"backordered_quantity": transaction.BackorderedQuantity,
+				"discount":             transaction.Discount,
+				"tax":                  transaction.Tax,
+				"tax_rate":             transaction.TaxRate,
+				"total_price":          transaction.TotalPrice,
+			}
+		}
+
+		c.JSON(http.StatusCreated, gin.H{
+			"message": "You have successfully purchased the products in your cart",
+			"transaction_bill": gin.H{
+				"order_id":              result.Order.ID,
+				"order_status":          result.Order.Status,
+				"invoice_number":        result.Order.InvoiceNumber,
+				"items":                 items,
+				"subtotal":              result.Subtotal,
+				"discount":              result.Discount,
+				"coupon_code":           result.Order.CouponCode,
+				"tax":                   result.Tax,
+				"tax_included":          taxConfig.PricesIncludeTax,
+				"points_used":           result.Order.PointsUsed,
+				"points_earned":         result.PointsEarned,
+				"shipping_cost":         result.ShippingCost,
+				"total_price":           result.TotalPrice,
+				"total_price_formatted": models.NewMoney(result.TotalPrice, models.BaseCurrency).String(),
+			},
+		})
+	}
+}
@@ -0,0 +1,175 @@
+package handlers
+
+import (
+	"fmt"
+	"main/config"
+	"main/helper"
+	"main/models"
+	"main/testdb"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+func newCartRouter(db *gorm.DB) *gin.Engine {
+	r := newTestRouter(db)
+	r.GET("/cart", GetCart(db))
+	r.POST("/cart/items", AddCartItem(db))
+	r.PATCH("/cart/items/:productId", UpdateCartItem(db))
+	r.DELETE("/cart/items/:productId", RemoveCartItem(db))
+	r.POST("/cart/checkout/start", StartCheckout(db, 10*time.Minute))
+	r.POST("/cart/checkout", CheckoutCart(db, &config.TaxConfig{Name: "PPN"}, config.GetLoyaltyConfig()))
+	return r
+}
+
+func TestCheckoutCart(t *testing.T) {
+	db := testdb.Open(t)
+	r := newCartRouter(db)
+	pen := testdb.CreateProduct(t, db, models.Product{Title: "Pen", Price: 2000, Stock: 10})
+	book := testdb.CreateProduct(t, db, models.Product{Title: "Book", Price: 15000, Stock: 5})
+	user := testdb.CreateUser(t, db, "cart@example.com", "customer")
+	topUp(t, db, user.ID, 50000)
+
+	for _, item := range []CartItemInput{{ProductID: pen.ID, Quantity: 2}, {ProductID: book.ID, Quantity: 1}, {ProductID: pen.ID, Quantity: 1}} {
+		if w := serve(t, r, http.MethodPost, "/cart/items", user, item); w.Code != http.StatusCreated {
+			t.Fatalf("adding %+v: %d %s", item, w.Code, w.Body)
+		}
+	}
+
+	var cart struct {
+		Items []struct {
+			ProductID uint `json:"product_id"`
+			Quantity  int  `json:"quantity"`
+		} `json:"items"`
+		Subtotal models.Money `json:"subtotal"`
+	}
+	w := serve(t, r, http.MethodGet, "/cart", user, nil)
+	decode(t, w, &cart)
+	if len(cart.Items) != 2 || cart.Items[0].Quantity != 3 || cart.Items[1].Quantity != 1 {
+		t.Fatalf("cart items = %+v, want the pen added twice merged into one line", cart.Items)
+	}
+	if cart.Subtotal.Amount != 21000 {
+		t.Errorf("cart subtotal = %d, want 21000", cart.Subtotal.Amount)
+	}
+
+	w = serve(t, r, http.MethodPost, "/cart/checkout", user, nil)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("checkout: %d %s", w.Code, w.Body)
+	}
+	var response struct {
+		Bill struct {
+			OrderID    uint                     `json:"order_id"`
+			Items      []struct{ Quantity int } `json:"items"`
+			TotalPrice int                      `json:"total_price"`
+		} `json:"transaction_bill"`
+	}
+	decode(t, w, &response)
+	if response.Bill.TotalPrice != 21000 || len(response.Bill.Items) != 2 {
+		t.Errorf("bill = %+v, want both lines for 21000", response.Bill)
+	}
+
+	var transactions int64
+	if err := db.Model(&models.TransactionHistory{}).Where("order_id = ?", response.Bill.OrderID).Count(&transactions).Error; err != nil {
+		t.Fatal(err)
+	}
+	if transactions != 2 {
+		t.Errorf("order %d has %d transactions, want 2", response.Bill.OrderID, transactions)
+	}
+	assertStock(t, db, pen.ID, 7)
+	assertStock(t, db, book.ID, 4)
+	assertBalance(t, db, user.ID, 29000)
+	assertCartSize(t, db, user.ID, 0)
+
+	if w := serve(t, r, http.MethodPost, "/cart/checkout", user, nil); w.Code != http.StatusBadRequest {
+		t.Errorf("checking out an empty cart: %d %s, want 400", w.Code, w.Body)
+	}
+	assertWalletsBalanced(t, db)
+}
+
+func TestCheckoutCartAllOrNothing(t *testing.T) {
+	db := testdb.Open(t)
+	r := newCartRouter(db)
+	pen := testdb.CreateProduct(t, db, models.Product{Title: "Pen", Price: 2000, Stock: 10})
+	book := testdb.CreateProduct(t, db, models.Product{Title: "Book", Price: 15000, Stock: 1})
+	user := testdb.CreateUser(t, db, "cart@example.com", "customer")
+	topUp(t, db, user.ID, 50000)
+
+	// The pens are in stock but the second book is not, so nothing is bought.
+	serve(t, r, http.MethodPost, "/cart/items", user, CartItemInput{ProductID: pen.ID, Quantity: 2})
+	serve(t, r, http.MethodPost, "/cart/items", user, CartItemInput{ProductID: book.ID, Quantity: 2})
+	w := serve(t, r, http.MethodPost, "/cart/checkout", user, nil)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("checkout beyond stock: %d %s, want 400", w.Code, w.Body)
+	}
+
+	var orders int64
+	if err := db.Model(&models.Order{}).Count(&orders).Error; err != nil {
+		t.Fatal(err)
+	}
+	if orders != 0 {
+		t.Errorf("%d orders created by a failed checkout", orders)
+	}
+	assertStock(t, db, pen.ID, 10)
+	assertStock(t, db, book.ID, 1)
+	assertBalance(t, db, user.ID, 50000)
+	assertCartSize(t, db, user.ID, 2)
+
+	// Lowering the quantity to what is in stock lets the order through.
+	if w := serve(t, r, http.MethodPatch, fmt.Sprintf("/cart/items/%d", book.ID), user, UpdateCartItemInput{Quantity: 1}); w.Code != http.StatusOK {
+		t.Fatalf("updating quantity: %d %s", w.Code, w.Body)
+	}
+	if w := serve(t, r, http.MethodPost, "/cart/checkout", user, nil); w.Code != http.StatusCreated {
+		t.Fatalf("checkout: %d %s", w.Code, w.Body)
+	}
+	assertStock(t, db, book.ID, 0)
+	assertBalance(t, db, user.ID, 31000)
+	assertWalletsBalanced(t, db)
+}
+
+func assertCartSize(t *testing.T, db *gorm.DB, userID uint, want int64) {
+	t.Helper()
+	var items int64
+	if err := db.Model(&models.CartItem{}).Where("user_id = ?", userID).Count(&items).Error; err != nil {
+		t.Fatal(err)
+	}
+	if items != want {
+		t.Errorf("cart has %d items, want %d", items, want)
+	}
+}
+
+func TestStartCheckout(t *testing.T) {
+	db := testdb.Open(t)
+	r := newCartRouter(db)
+	pen := testdb.CreateProduct(t, db, models.Product{Title: "Pen", Price: 2000, Stock: 10})
+	waiting := testdb.CreateProduct(t, db, models.Product{Title: "Waiting", Price: 2000, BackorderMode: helper.BackorderBackorder})
+	user := testdb.CreateUser(t, db, "cart@example.com", "customer")
+
+	var response struct {
+		Reservations  []models.Reservation `json:"reservations"`
+		ReservedUntil *time.Time           `json:"reserved_until"`
+	}
+
+	// Nothing of a backordered product is on the shelf to hold.
+	serve(t, r, http.MethodPost, "/cart/items", user, CartItemInput{ProductID: waiting.ID, Quantity: 2})
+	w := serve(t, r, http.MethodPost, "/cart/checkout/start", user, nil)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("start checkout of backordered items: %d %s", w.Code, w.Body)
+	}
+	decode(t, w, &response)
+	if len(response.Reservations) != 0 || response.ReservedUntil != nil {
+		t.Errorf("backordered cart holds %v until %v, want nothing", response.Reservations, response.ReservedUntil)
+	}
+
+	serve(t, r, http.MethodPost, "/cart/items", user, CartItemInput{ProductID: pen.ID, Quantity: 3})
+	w = serve(t, r, http.MethodPost, "/cart/checkout/start", user, nil)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("start checkout: %d %s", w.Code, w.Body)
+	}
+	decode(t, w, &response)
+	if len(response.Reservations) != 1 || response.Reservations[0].Quantity != 3 || response.ReservedUntil == nil {
+		t.Errorf("cart holds %+v until %v, want 3 pens", response.Reservations, response.ReservedUntil)
+	}
+}
@@ -12,7 +12,17 @@ import (
 )
 
 type CreateCategoryInput struct {
-	Type string `json:"type" validate:"required"`
+	Type       string `json:"type" validate:"required"`
+	TaxClassID *uint  `json:"tax_class_id"`
+}
+
+// taxClassExists reports whether id, when given, names a tax class.
+func taxClassExists(db *gorm.DB, id *uint) bool {
+	if id == nil {
+		return true
+	}
+	var taxClass models.TaxClass
+	return db.First(&taxClass, *id).Error == nil
 }
 
 func CreateCategory(db *gorm.DB) gin.HandlerFunc {
@@ -27,9 +37,15 @@ func CreateCategory(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
+		if !taxClassExists(db, input.TaxClassID) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Tax class not found"})
+			return
+		}
+
 		// Create a new category
 		newCategory := models.Category{
 			Type:              input.Type,
+			TaxClassID:        input.TaxClassID,
 			CreatedAt:         time.Now(),
 			UpdatedAt:         time.Now(),
 			SoldProductAmount: 0,
@@ -44,6 +60,7 @@ func CreateCategory(db *gorm.DB) gin.HandlerFunc {
 			"id":                  newCategory.ID,
 			"type":                newCategory.Type,
 			"sold_product_amount": newCategory.SoldProductAmount,
+			"tax_class_id":        newCategory.TaxClassID,
 			"created_at":          newCategory.CreatedAt,
 		})
 	}
@@ -58,18 +75,28 @@ func GetCategories(db *gorm.DB) gin.HandlerFunc {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch categories"})
 			return
 		}
+
+		sales, err := helper.ActiveSales(db, time.Now())
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch sales"})
+			return
+		}
+
 		transformedCategories := make([]map[string]interface{}, len(categories))
 		for i, t := range categories {
 			products := make([]map[string]interface{}, len(t.Products))
 			for j, p := range t.Products {
+				salePrice, _ := sales.Price(p)
 				product := map[string]interface{}{
-					"id":          p.ID,
-					"title":       p.Title,
-					"price":       p.Price,
-					"stock":       p.Stock,
-					"category_id": p.CategoryID,
-					"created_at":  p.CreatedAt,
-					"updated_at":  p.UpdatedAt,
+					"id":              p.ID,
+					"title":           p.Title,
+					"price":           p.Price,
+					"sale_price":      salePrice.Amount,
+					"stock":           p.Stock,
+					"available_stock": p.AvailableStock(),
+					"category_id":     p.CategoryID,
+					"created_at":      p.CreatedAt,
+					"updated_at":      p.UpdatedAt,
 				}
 				products[j] = product
 			}
@@ -78,6 +105,7 @@ func GetCategories(db *gorm.DB) gin.HandlerFunc {
 				"id":                  t.ID,
 				"type":                t.Type,
 				"sold_product_amount": t.SoldProductAmount,
+				"tax_class_id":        t.TaxClassID,
 				"created_at":          t.CreatedAt,
 				"updated_at":          t.UpdatedAt,
 				"Products":            products,
@@ -90,7 +118,8 @@ func GetCategories(db *gorm.DB) gin.HandlerFunc {
 }
 
 type UpdateCategoryInput struct {
-	Type string `json:"type" validate:"required"`
+	Type       string `json:"type" validate:"required"`
+	TaxClassID *uint  `json:"tax_class_id"`
 }
 
 func UpdateCategory(db *gorm.DB) gin.HandlerFunc {
@@ -119,8 +148,14 @@ func UpdateCategory(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
+		if !taxClassExists(db, input.TaxClassID) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Tax class not found"})
+			return
+		}
+
 		// Update category details
 		category.Type = input.Type
+		category.TaxClassID = input.TaxClassID
 		category.UpdatedAt = time.Now()
 
 		if err := db.Save(&category).Error; err != nil {
@@ -132,6 +167,7 @@ func UpdateCategory(db *gorm.DB) gin.HandlerFunc {
 			"id":                  category.ID,
 			"type":                category.Type,
 			"sold_product_amount": category.SoldProductAmount,
+			"tax_class_id":        category.TaxClassID,
 			"updated_at":          category.UpdatedAt,
 		})
 	}
@@ -0,0 +1,232 @@
+package handlers
+
+import (
+	"main/helper"
+	"main/models"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type CouponInput struct {
+	Code         string     `json:"code" validate:"required,max=64"`
+	Type         string     `json:"type" validate:"required,oneof=percentage fixed"`
+	Value        int        `json:"value" validate:"required,min=1"`
+	MinPurchase  int        `json:"min_purchase" validate:"min=0"`
+	MaxDiscount  int        `json:"max_discount" validate:"min=0"`
+	StartsAt     *time.Time `json:"starts_at"`
+	EndsAt       *time.Time `json:"ends_at"`
+	UsageLimit   int        `json:"usage_limit" validate:"min=0"`
+	PerUserLimit int        `json:"per_user_limit" validate:"min=0"`
+	CategoryIDs  []uint     `json:"category_ids"`
+	ProductIDs   []uint     `json:"product_ids"`
+}
+
+func couponResponse(coupon models.Coupon) map[string]interface{} {
+	categoryIDs := make([]uint, len(coupon.Categories))
+	for i, category := range coupon.Categories {
+		categoryIDs[i] = category.ID
+	}
+	productIDs := make([]uint, len(coupon.Products))
+	for i, product := range coupon.Products {
+		productIDs[i] = product.ID
+	}
+
+	return map[string]interface{}{
+		"id":             coupon.ID,
+		"code":           coupon.Code,
+		"type":           coupon.Type,
+		"value":          coupon.Value,
+		"min_purchase":   coupon.MinPurchase,
+		"max_discount":   coupon.MaxDiscount,
+		"starts_at":      coupon.StartsAt,
+		"ends_at":        coupon.EndsAt,
+		"usage_limit":    coupon.UsageLimit,
+		"per_user_limit": coupon.PerUserLimit,
+		"used_count":     coupon.UsedCount,
+		"category_ids":   categoryIDs,
+		"product_ids":    productIDs,
+		"created_at":     coupon.CreatedAt,
+		"updated_at":     coupon.UpdatedAt,
+	}
+}
+
+// bindCouponInput reads and validates a coupon and loads the categories and
+// products it is restricted to. It writes the error response itself.
+func bindCouponInput(c *gin.Context, db *gorm.DB) (*CouponInput, []models.Category, []models.Product, bool) {
+	var input CouponInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, nil, nil, false
+	}
+
+	if err := helper.Validate(input); err != nil {
+		c.JSON(http.StatusBadRequest, err)
+		return nil, nil, nil, false
+	}
+
+	if input.Type == helper.CouponPercentage && input.Value > 100 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Percentage coupons cannot take off more than 100%"})
+		return nil, nil, nil, false
+	}
+	if input.StartsAt != nil && input.EndsAt != nil && !input.EndsAt.After(*input.StartsAt) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Coupon must end after it starts"})
+		return nil, nil, nil, false
+	}
+
+	var categories []models.Category
+	if len(input.CategoryIDs) > 0 {
+		if err := db.Find(&categories, input.CategoryIDs).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch categories"})
+			return nil, nil, nil, false
+		}
+		if len(categories) != len(input.CategoryIDs) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Category not found"})
+			return nil, nil, nil, false
+		}
+	}
+
+	var products []models.Product
+	if len(input.ProductIDs) > 0 {
+		if err := db.Find(&products, input.ProductIDs).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch products"})
+			return nil, nil, nil, false
+		}
+		if len(products) != len(input.ProductIDs) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+			return nil, nil, nil, false
+		}
+	}
+
+	return &input, categories, products, true
+}
+
+func GetCoupons(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var coupons []models.Coupon
+		if err := db.Preload("Categories").Preload("Products").Order("id DESC").Find(&coupons).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch coupons"})
+			return
+		}
+
+		transformedCoupons := make([]map[string]interface{}, len(coupons))
+		for i, coupon := range coupons {
+			transformedCoupons[i] = couponResponse(coupon)
+		}
+		c.JSON(http.StatusOK, transformedCoupons)
+	}
+}
+
+func CreateCoupon(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		input, categories, products, ok := bindCouponInput(c, db)
+		if !ok {
+			return
+		}
+
+		coupon := models.Coupon{
+			Code:         helper.NormalizeCouponCode(input.Code),
+			Type:         input.Type,
+			Value:        input.Value,
+			MinPurchase:  input.MinPurchase,
+			MaxDiscount:  input.MaxDiscount,
+			StartsAt:     input.StartsAt,
+			EndsAt:       input.EndsAt,
+			UsageLimit:   input.UsageLimit,
+			PerUserLimit: input.PerUserLimit,
+			Categories:   categories,
+			Products:     products,
+		}
+		// Skip upserting the associated rows, only the join rows are new
+		if err := db.Omit("Categories.*", "Products.*").Create(&coupon).Error; err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "A coupon with this code already exists"})
+			return
+		}
+
+		c.JSON(http.StatusCreated, couponResponse(coupon))
+	}
+}
+
+func UpdateCoupon(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.ParseUint(c.Param("couponId"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid coupon ID"})
+			return
+		}
+
+		var coupon models.Coupon
+		if err := db.First(&coupon, id).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Coupon not found"})
+			return
+		}
+
+		input, categories, products, ok := bindCouponInput(c, db)
+		if !ok {
+			return
+		}
+
+		err = db.Transaction(func(tx *gorm.DB) error {
+			// used_count is left alone, it is only ever changed atomically by purchases
+			err := tx.Model(&coupon).Select(
+				"code", "type", "value", "min_purchase", "max_discount",
+				"starts_at", "ends_at", "usage_limit", "per_user_limit",
+			).Updates(models.Coupon{
+				Code:         helper.NormalizeCouponCode(input.Code),
+				Type:         input.Type,
+				Value:        input.Value,
+				MinPurchase:  input.MinPurchase,
+				MaxDiscount:  input.MaxDiscount,
+				StartsAt:     input.StartsAt,
+				EndsAt:       input.EndsAt,
+				UsageLimit:   input.UsageLimit,
+				PerUserLimit: input.PerUserLimit,
+			}).Error
+			if err != nil {
+				return err
+			}
+			if err := tx.Model(&coupon).Omit("Categories.*").Association("Categories").Replace(categories); err != nil {
+				return err
+			}
+			return tx.Model(&coupon).Omit("Products.*").Association("Products").Replace(products)
+		})
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "A coupon with this code already exists"})
+			return
+		}
+
+		if err := db.Preload("Categories").Preload("Products").First(&coupon, id).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch coupon"})
+			return
+		}
+
+		c.JSON(http.StatusOK, couponResponse(coupon))
+	}
+}
+
+func DeleteCoupon(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.ParseUint(c.Param("couponId"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid coupon ID"})
+			return
+		}
+
+		var coupon models.Coupon
+		if err := db.First(&coupon, id).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Coupon not found"})
+			return
+		}
+
+		// Soft delete, orders and redemptions keep pointing at the coupon
+		if err := db.Delete(&coupon).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete coupon"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Coupon has been successfully deleted"})
+	}
+}
@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"main/helper"
+	"main/models"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type ExchangeRateInput struct {
+	From string `json:"from" validate:"required,len=3"`
+	To   string `json:"to" validate:"required,len=3"`
+	Rate string `json:"rate" validate:"required"`
+}
+
+func GetExchangeRates(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var rates []models.ExchangeRate
+		if err := db.Order(`"from", "to"`).Find(&rates).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch exchange rates"})
+			return
+		}
+
+		c.JSON(http.StatusOK, rates)
+	}
+}
+
+func SetExchangeRate(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input ExchangeRateInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := helper.Validate(input); err != nil {
+			c.JSON(http.StatusBadRequest, err)
+			return
+		}
+
+		from, fromOK := models.LookupCurrency(input.From)
+		to, toOK := models.LookupCurrency(input.To)
+		if !fromOK || !toOK {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unsupported currency"})
+			return
+		}
+		if from.Code == to.Code {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Currencies must be different"})
+			return
+		}
+
+		rate, err := helper.ParseRate(input.Rate)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Rate must be a positive decimal number"})
+			return
+		}
+
+		exchangeRate := models.ExchangeRate{
+			From: from.Code,
+			To:   to.Code,
+			Rate: rate.FloatString(12),
+		}
+		err = db.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "from"}, {Name: "to"}},
+			DoUpdates: clause.AssignmentColumns([]string{"rate", "updated_at"}),
+		}).Create(&exchangeRate).Error
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save exchange rate"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"from": exchangeRate.From,
+			"to":   exchangeRate.To,
+			"rate": exchangeRate.Rate,
+		})
+	}
+}
@@ -0,0 +1,197 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"main/config"
+	"main/helper"
+	"main/models"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type IssueGiftCardsInput struct {
+	Count     int        `json:"count" validate:"required,min=1"`
+	Amount    int        `json:"amount" validate:"required,min=1,max=100000000"`
+	Currency  string     `json:"currency" validate:"omitempty,len=3"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+type RedeemGiftCardInput struct {
+	Code string `json:"code" validate:"required,max=64"`
+}
+
+func giftCardResponse(card models.GiftCard) map[string]interface{} {
+	return map[string]interface{}{
+		"id":          card.ID,
+		"batch_id":    card.BatchID,
+		"last4":       card.Last4,
+		"value":       models.NewMoney(card.Amount, card.Currency),
+		"expires_at":  card.ExpiresAt,
+		"redeemed_by": card.RedeemedBy,
+		"redeemed_at": card.RedeemedAt,
+		"created_at":  card.CreatedAt,
+	}
+}
+
+func IssueGiftCards(db *gorm.DB, giftCardConfig *config.GiftCardConfig) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userIDParam, exists := c.Get("userID")
+		if !exists {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "User detail not found"})
+			return
+		}
+
+		var input IssueGiftCardsInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := helper.Validate(input); err != nil {
+			c.JSON(http.StatusBadRequest, err)
+			return
+		}
+
+		if input.Count > giftCardConfig.MaxBatch {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("At most %d gift cards can be issued at once", giftCardConfig.MaxBatch)})
+			return
+		}
+		if input.ExpiresAt != nil && !input.ExpiresAt.After(time.Now()) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Gift cards must expire in the future"})
+			return
+		}
+
+		currency := models.BaseCurrency
+		if input.Currency != "" {
+			supported, ok := models.LookupCurrency(input.Currency)
+			if !ok {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Unsupported currency"})
+				return
+			}
+			currency = supported.Code
+		}
+
+		var cards []models.GiftCard
+		var codes []string
+		err := db.Transaction(func(tx *gorm.DB) error {
+			var err error
+			cards, codes, err = helper.IssueGiftCards(tx, input.Count, input.Amount, currency, input.ExpiresAt, userIDParam.(uint))
+			return err
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to issue gift cards"})
+			return
+		}
+
+		// The codes are only ever shown here, the database keeps their hashes
+		issued := make([]map[string]interface{}, len(cards))
+		for i, card := range cards {
+			issued[i] = giftCardResponse(card)
+			issued[i]["code"] = codes[i]
+		}
+
+		c.JSON(http.StatusCreated, gin.H{
+			"batch_id":   cards[0].BatchID,
+			"gift_cards": issued,
+		})
+	}
+}
+
+func GetGiftCards(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		page, limit := helper.GetPagination(c)
+
+		query := db.Model(&models.GiftCard{})
+		if batchID := c.Query("batch_id"); batchID != "" {
+			query = query.Where("batch_id = ?", batchID)
+		}
+		switch c.Query("status") {
+		case "redeemed":
+			query = query.Where("redeemed_at IS NOT NULL")
+		case "unredeemed":
+			query = query.Where("redeemed_at IS NULL")
+		}
+
+		var total int64
+		if err := query.Count(&total).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch gift cards"})
+			return
+		}
+
+		var cards []models.GiftCard
+		err := query.Order("id DESC").
+			Offset((page - 1) * limit).
+			Limit(limit).
+			Find(&cards).Error
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch gift cards"})
+			return
+		}
+
+		transformedCards := make([]map[string]interface{}, len(cards))
+		for i, card := range cards {
+			transformedCards[i] = giftCardResponse(card)
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"gift_cards": transformedCards,
+			"page":       page,
+			"limit":      limit,
+			"total":      total,
+		})
+	}
+}
+
+func RedeemGiftCard(db *gorm.DB, giftCardConfig *config.GiftCardConfig) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userIDParam, exists := c.Get("userID")
+		if !exists {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "User detail not found"})
+			return
+		}
+
+		var input RedeemGiftCardInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := helper.Validate(input); err != nil {
+			c.JSON(http.StatusBadRequest, err)
+			return
+		}
+
+		card, entry, err := helper.RedeemGiftCard(db, giftCardConfig, userIDParam.(uint), c.ClientIP(), strings.TrimSpace(input.Code), time.Now())
+		switch {
+		case errors.Is(err, helper.ErrTooManyGiftCardAttempts):
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many wrong gift card codes, try again later"})
+			return
+		case errors.Is(err, helper.ErrGiftCardNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Gift card not found"})
+			return
+		case errors.Is(err, helper.ErrGiftCardRedeemed):
+			c.JSON(http.StatusConflict, gin.H{"error": "Gift card has already been redeemed"})
+			return
+		case errors.Is(err, helper.ErrGiftCardExpired):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Gift card has expired"})
+			return
+		case errors.Is(err, helper.ErrNoExchangeRate):
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "The gift card currency cannot be converted right now"})
+			return
+		case err != nil:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to redeem gift card"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"message":   fmt.Sprintf("%s has been added to your balance", models.NewMoney(entry.Amount, models.BaseCurrency)),
+			"gift_card": giftCardResponse(*card),
+			"balance":   entry.BalanceAfter,
+		})
+	}
+}
@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"main/helper"
+	"main/models"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// testUserHeader carries the ID of the user a test request is made as.
+const testUserHeader = "X-Test-User"
+
+// newTestRouter returns a router that authenticates requests as the user in
+// testUserHeader, standing in for TokenAuthMiddleware.
+func newTestRouter(db *gorm.DB) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		id, err := strconv.ParseUint(c.GetHeader(testUserHeader), 10, 64)
+		if err != nil {
+			c.Next()
+			return
+		}
+		var user models.User
+		if err := db.First(&user, id).Error; err != nil {
+			c.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+		c.Set("userID", user.ID)
+		c.Set("user", user.Email)
+		c.Set("role", user.Role)
+		c.Next()
+	})
+	return r
+}
+
+// newTestRequest builds a request made as user, with body encoded as JSON
+// unless it is nil.
+func newTestRequest(t testing.TB, method, path string, user models.User, body interface{}) *http.Request {
+	t.Helper()
+	var encoded []byte
+	if body != nil {
+		var err error
+		if encoded, err = json.Marshal(body); err != nil {
+			t.Fatal(err)
+		}
+	}
+	req := httptest.NewRequest(method, path, bytes.NewReader(encoded))
+	req.Header.Set("Content-Type", "application/json")
+	if user.ID != 0 {
+		req.Header.Set(testUserHeader, strconv.FormatUint(uint64(user.ID), 10))
+	}
+	return req
+}
+
+// serve records the response of r to a request made as user.
+func serve(t testing.TB, r http.Handler, method, path string, user models.User, body interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, newTestRequest(t, method, path, user, body))
+	return w
+}
+
+// decode unmarshals the JSON body of w into v.
+func decode(t testing.TB, w *httptest.ResponseRecorder, v interface{}) {
+	t.Helper()
+	if err := json.Unmarshal(w.Body.Bytes(), v); err != nil {
+		t.Fatalf("decoding %q: %v", w.Body.String(), err)
+	}
+}
+
+// topUp credits amount to the user's wallet through the ledger.
+func topUp(t testing.TB, db *gorm.DB, userID uint, amount int) {
+	t.Helper()
+	err := db.Transaction(func(tx *gorm.DB) error {
+		_, err := helper.PostWalletEntry(tx, userID, helper.WalletEntryTopup, amount, helper.AccountPaymentsClearing, "", 0, "Test topup")
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// assertWalletsBalanced fails the test when a user's balance has drifted
+// from their ledger or the journal does not balance.
+func assertWalletsBalanced(t testing.TB, db *gorm.DB) {
+	t.Helper()
+	var users []models.User
+	if err := db.Find(&users).Error; err != nil {
+		t.Fatal(err)
+	}
+	for _, user := range users {
+		report, err := helper.VerifyWallet(db, user)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if report.Drifted() {
+			t.Errorf("wallet of user %d drifted: %+v", user.ID, report)
+		}
+	}
+	unbalanced, err := helper.UnbalancedJournalEntries(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(unbalanced) > 0 {
+		t.Errorf("unbalanced journal entries %v", unbalanced)
+	}
+}
+
+// assertStock fails the test unless the product has want units in stock.
+func assertStock(t testing.TB, db *gorm.DB, productID uint, want int) {
+	t.Helper()
+	var product models.Product
+	if err := db.First(&product, productID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if product.Stock != want {
+		t.Errorf("stock of product %d = %d, want %d", productID, product.Stock, want)
+	}
+}
+
+// assertBalance fails the test unless the user's wallet holds want.
+func assertBalance(t testing.TB, db *gorm.DB, userID uint, want int) {
+	t.Helper()
+	var user models.User
+	if err := db.First(&user, userID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if user.Balance != want {
+		t.Errorf("balance of user %d = %d, want %d", userID, user.Balance, want)
+	}
+}
@@ -0,0 +1,303 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"main/helper"
+	"main/models"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+func orderResponse(order models.Order) map[string]interface{} {
+	items := make([]map[string]interface{}, len(order.Items))
+	for i, item := range order.Items {
+		items[i] = map[string]interface{}{
+			"id":             item.ID,
+			"product_id":     item.ProductID,
+			"transaction_id": item.TransactionHistoryID,
+			"title":          item.Title,
+			"quantity":       item.Quantity,
+			"unit_price":     item.UnitPriceMoney(),
+			"total_price":    item.TotalPrice,
+		}
+	}
+
+	history := make([]map[string]interface{}, len(order.StatusHistory))
+	for i, change := range order.StatusHistory {
+		history[i] = map[string]interface{}{
+			"from_status": change.FromStatus,
+			"to_status":   change.ToStatus,
+			"note":        change.Note,
+			"created_at":  change.CreatedAt,
+		}
+	}
+
+	return map[string]interface{}{
+		"id":                    order.ID,
+		"user_id":               order.UserID,
+		"status":                order.Status,
+		"invoice_number":        order.InvoiceNumber,
+		"subtotal":              order.Subtotal,
+		"discount":              order.Discount,
+		"coupon_code":           order.CouponCode,
+		"tax":                   order.Tax,
+		"points_used":           order.PointsUsed,
+		"points_earned":         order.PointsEarned,
+		"shipping_cost":         order.ShippingCost,
+		"ship_to":               order.ShipTo,
+		"total_price":           order.TotalPrice,
+		"total_price_formatted": order.TotalPriceMoney().String(),
+		"paid_at":               order.PaidAt,
+		"processing_at":         order.ProcessingAt,
+		"shipped_at":            order.ShippedAt,
+		"delivered_at":          order.DeliveredAt,
+		"cancelled_at":          order.CancelledAt,
+		"refunded_at":           order.RefundedAt,
+		"cancel_reason":         order.CancelReason,
+		"created_at":            order.CreatedAt,
+		"updated_at":            order.UpdatedAt,
+		"items":                 items,
+		"status_history":        history,
+	}
+}
+
+func preloadOrder(db *gorm.DB) *gorm.DB {
+	return db.Preload("Items").Preload("StatusHistory", func(db *gorm.DB) *gorm.DB {
+		return db.Order("id")
+	})
+}
+
+func GetOrdersForUser(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, exists := c.Get("userID")
+		if !exists {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "User detail not found"})
+			return
+		}
+
+		query := preloadOrder(db).Where("user_id = ?", userID).Order("id DESC")
+		if invoiceNumber := c.Query("invoice_number"); invoiceNumber != "" {
+			query = query.Where("invoice_number LIKE ?", invoiceNumberPattern(invoiceNumber))
+		}
+
+		var orders []models.Order
+		if err := query.Find(&orders).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch orders"})
+			return
+		}
+
+		transformedOrders := make([]map[string]interface{}, len(orders))
+		for i, order := range orders {
+			transformedOrders[i] = orderResponse(order)
+		}
+		c.JSON(http.StatusOK, transformedOrders)
+	}
+}
+
+func GetAllOrders(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		query := preloadOrder(db).Order("id DESC")
+		if status := c.Query("status"); status != "" {
+			query = query.Where("status = ?", status)
+		}
+		if invoiceNumber := c.Query("invoice_number"); invoiceNumber != "" {
+			query = query.Where("invoice_number LIKE ?", invoiceNumberPattern(invoiceNumber))
+		}
+
+		var orders []models.Order
+		if err := query.Find(&orders).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch orders"})
+			return
+		}
+
+		transformedOrders := make([]map[string]interface{}, len(orders))
+		for i, order := range orders {
+			transformedOrders[i] = orderResponse(order)
+		}
+		c.JSON(http.StatusOK, gin.H{"orders": transformedOrders})
+	}
+}
+
+func GetOrder(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, exists := c.Get("userID")
+		if !exists {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "User detail not found"})
+			return
+		}
+
+		id, err := strconv.ParseUint(c.Param("orderId"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order ID"})
+			return
+		}
+
+		var order models.Order
+		if err := preloadOrder(db).First(&order, id).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+			return
+		}
+
+		if role, _ := c.Get("role"); role != "admin" && order.UserID != userID {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+			return
+		}
+
+		c.JSON(http.StatusOK, orderResponse(order))
+	}
+}
+
+type UpdateOrderStatusInput struct {
+	Status string `json:"status" validate:"required,oneof=processing shipped delivered"`
+	Note   string `json:"note" validate:"max=255"`
+}
+
+// UpdateOrderStatus advances the fulfilment of an order. Cancelling and
+// refunding move money and stock, so they have their own endpoints.
+func UpdateOrderStatus(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		adminID, exists := c.Get("userID")
+		if !exists {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "User detail not found"})
+			return
+		}
+
+		id, err := strconv.ParseUint(c.Param("orderId"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order ID"})
+			return
+		}
+
+		var input UpdateOrderStatusInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := helper.Validate(input); err != nil {
+			c.JSON(http.StatusBadRequest, err)
+			return
+		}
+
+		err = db.Transaction(func(tx *gorm.DB) error {
+			_, err := helper.TransitionOrder(tx, uint(id), input.Status, adminID.(uint), input.Note)
+			return err
+		})
+		if err != nil {
+			switch {
+			case errors.Is(err, helper.ErrOrderNotFound):
+				c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+			case errors.Is(err, helper.ErrInvalidOrderTransition):
+				c.JSON(http.StatusConflict, gin.H{"error": "Order cannot move to that status"})
+			default:
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update order status"})
+			}
+			return
+		}
+
+		var order models.Order
+		if err := preloadOrder(db).First(&order, id).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch order"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"order": orderResponse(order)})
+	}
+}
+
+type CancelOrderInput struct {
+	// ReasonCode is required from admins, customers always cancel on request.
+	ReasonCode string `json:"reason_code" validate:"omitempty,oneof=customer_request out_of_stock payment_issue fraud_suspected other"`
+	Note       string `json:"note" validate:"max=255"`
+}
+
+func CancelOrder(db *gorm.DB, customerWindow time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userIDParam, exists := c.Get("userID")
+		if !exists {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "User detail not found"})
+			return
+		}
+
+		userID, ok := userIDParam.(uint)
+		if !ok {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID"})
+			return
+		}
+
+		id, err := strconv.ParseUint(c.Param("orderId"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order ID"})
+			return
+		}
+
+		var input CancelOrderInput
+		if err := c.ShouldBindJSON(&input); err != nil && !errors.Is(err, io.EOF) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := helper.Validate(input); err != nil {
+			c.JSON(http.StatusBadRequest, err)
+			return
+		}
+
+		var order models.Order
+		if err := db.First(&order, id).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+			return
+		}
+
+		if role, _ := c.Get("role"); role == "admin" {
+			if input.ReasonCode == "" {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "reason_code is required"})
+				return
+			}
+		} else {
+			if order.UserID != userID {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+				return
+			}
+			// Orders waiting for stock can be cancelled until it arrives
+			if order.Status != helper.OrderBackordered && time.Since(order.CreatedAt) > customerWindow {
+				c.JSON(http.StatusForbidden, gin.H{"error": "The cancellation window for this order has passed"})
+				return
+			}
+			input.ReasonCode = "customer_request"
+		}
+
+		reason := input.ReasonCode
+		if input.Note != "" {
+			reason += ": " + input.Note
+		}
+
+		err = db.Transaction(func(tx *gorm.DB) error {
+			_, err := helper.CancelOrder(tx, order.ID, userID, reason)
+			return err
+		})
+		if err != nil {
+			switch {
+			case errors.Is(err, helper.ErrOrderNotFound):
+				c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+			case errors.Is(err, helper.ErrInvalidOrderTransition):
+				c.JSON(http.StatusConflict, gin.H{"error": "Orders that have shipped can no longer be cancelled"})
+			default:
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel order"})
+			}
+			return
+		}
+
+		if err := preloadOrder(db).First(&order, id).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch order"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"message": "The order has been successfully cancelled",
+			"order":   orderResponse(order),
+		})
+	}
+}
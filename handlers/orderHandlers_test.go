@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"fmt"
+	"main/helper"
+	"main/models"
+	"main/testdb"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+func newOrderRouter(db *gorm.DB) *gin.Engine {
+	r := newTestRouter(db)
+	r.PATCH("/orders/:orderId/status", UpdateOrderStatus(db))
+	r.POST("/orders/:orderId/cancel", CancelOrder(db, time.Hour))
+	return r
+}
+
+// placeOrder buys quantity units of each product for user in one order.
+func placeOrder(t *testing.T, db *gorm.DB, user models.User, quantities map[uint]int) models.Order {
+	t.Helper()
+	var lines []helper.PurchaseLine
+	for productID, quantity := range quantities {
+		lines = append(lines, helper.PurchaseLine{ProductID: productID, Quantity: quantity})
+	}
+	var result *helper.PurchaseResult
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		result, err = helper.Purchase(tx, helper.PurchaseRequest{UserID: user.ID, Lines: lines})
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return result.Order
+}
+
+func TestCancelOrderRestocks(t *testing.T) {
+	db := testdb.Open(t)
+	r := newOrderRouter(db)
+	pen := testdb.CreateProduct(t, db, models.Product{Title: "Pen", Price: 2000, Stock: 10})
+	book := testdb.CreateProduct(t, db, models.Product{Title: "Book", Price: 15000, Stock: 5})
+	user := testdb.CreateUser(t, db, "cancel@example.com", "customer")
+	topUp(t, db, user.ID, 50000)
+
+	order := placeOrder(t, db, user, map[uint]int{pen.ID: 3, book.ID: 2})
+	assertStock(t, db, pen.ID, 7)
+	assertStock(t, db, book.ID, 3)
+	assertBalance(t, db, user.ID, 14000)
+
+	w := serve(t, r, http.MethodPost, fmt.Sprintf("/orders/%d/cancel", order.ID), user, CancelOrderInput{Note: "changed my mind"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("cancel: %d %s", w.Code, w.Body)
+	}
+	assertStock(t, db, pen.ID, 10)
+	assertStock(t, db, book.ID, 5)
+	assertBalance(t, db, user.ID, 50000)
+
+	if err := db.First(&order, order.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if order.Status != helper.OrderCancelled || order.CancelledAt == nil || order.CancelReason != "customer_request: changed my mind" {
+		t.Errorf("order = status %q, cancelled at %v, reason %q", order.Status, order.CancelledAt, order.CancelReason)
+	}
+	for _, product := range []models.Product{pen, book} {
+		var category models.Category
+		if err := db.First(&category, product.CategoryID).Error; err != nil {
+			t.Fatal(err)
+		}
+		if category.SoldProductAmount != 0 {
+			t.Errorf("category %q still counts %d sold", category.Type, category.SoldProductAmount)
+		}
+	}
+	var open int64
+	if err := db.Model(&models.TransactionHistory{}).Where("order_id = ? AND refunded_quantity < quantity", order.ID).Count(&open).Error; err != nil {
+		t.Fatal(err)
+	}
+	if open != 0 {
+		t.Errorf("%d purchases of the cancelled order are not refunded", open)
+	}
+
+	// Cancelling again neither restocks nor refunds twice.
+	if w := serve(t, r, http.MethodPost, fmt.Sprintf("/orders/%d/cancel", order.ID), user, nil); w.Code != http.StatusConflict {
+		t.Errorf("second cancel: %d %s, want 409", w.Code, w.Body)
+	}
+	assertStock(t, db, pen.ID, 10)
+	assertBalance(t, db, user.ID, 50000)
+	assertWalletsBalanced(t, db)
+}
+
+func TestCancelOrderRules(t *testing.T) {
+	db := testdb.Open(t)
+	r := newOrderRouter(db)
+	pen := testdb.CreateProduct(t, db, models.Product{Title: "Pen", Price: 2000, Stock: 10})
+	user := testdb.CreateUser(t, db, "cancel@example.com", "customer")
+	other := testdb.CreateUser(t, db, "other@example.com", "customer")
+	admin := testdb.CreateUser(t, db, "admin@example.com", "admin")
+	topUp(t, db, user.ID, 50000)
+	cancel := func(order models.Order, as models.User, input interface{}) int {
+		return serve(t, r, http.MethodPost, fmt.Sprintf("/orders/%d/cancel", order.ID), as, input).Code
+	}
+
+	order := placeOrder(t, db, user, map[uint]int{pen.ID: 1})
+	if code := cancel(order, other, nil); code != http.StatusNotFound {
+		t.Errorf("cancelling someone else's order: %d, want 404", code)
+	}
+	if code := cancel(order, admin, nil); code != http.StatusBadRequest {
+		t.Errorf("admin cancel without a reason code: %d, want 400", code)
+	}
+
+	old := placeOrder(t, db, user, map[uint]int{pen.ID: 1})
+	if err := db.Model(&old).Update("created_at", time.Now().Add(-2*time.Hour)).Error; err != nil {
+		t.Fatal(err)
+	}
+	if code := cancel(old, user, nil); code != http.StatusForbidden {
+		t.Errorf("customer cancel after the window: %d, want 403", code)
+	}
+	if code := cancel(old, admin, CancelOrderInput{ReasonCode: "out_of_stock"}); code != http.StatusOK {
+		t.Errorf("admin cancel after the window: %d, want 200", code)
+	}
+
+	for _, status := range []string{helper.OrderProcessing, helper.OrderShipped} {
+		w := serve(t, r, http.MethodPatch, fmt.Sprintf("/orders/%d/status", order.ID), admin, UpdateOrderStatusInput{Status: status})
+		if w.Code != http.StatusOK {
+			t.Fatalf("moving to %s: %d %s", status, w.Code, w.Body)
+		}
+	}
+	if code := cancel(order, user, nil); code != http.StatusConflict {
+		t.Errorf("cancelling a shipped order: %d, want 409", code)
+	}
+	assertStock(t, db, pen.ID, 9)
+	assertWalletsBalanced(t, db)
+}
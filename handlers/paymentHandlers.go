@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"main/helper"
+	"main/models"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+func PaymentWebhook(db *gorm.DB, provider helper.PaymentProvider) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read request body"})
+			return
+		}
+
+		event, err := provider.ParseWebhook(c.Request.Header, body)
+		if err != nil {
+			if errors.Is(err, helper.ErrInvalidWebhookSignature) {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid signature"})
+				return
+			}
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid webhook payload"})
+			return
+		}
+
+		intent, err := helper.ApplyPaymentEvent(db, provider.Name(), event)
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Payment not found"})
+				return
+			}
+			if errors.Is(err, helper.ErrUnknownPaymentStatus) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown payment status"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process payment"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"id": intent.ID, "status": intent.Status})
+	}
+}
+
+func GetPayment(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, exists := c.Get("userID")
+		if !exists {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "User detail not found"})
+			return
+		}
+
+		id, err := strconv.ParseUint(c.Param("paymentId"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid payment ID"})
+			return
+		}
+
+		var intent models.PaymentIntent
+		if err := db.Where("user_id = ?", userID).First(&intent, id).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Payment not found"})
+			return
+		}
+
+		c.JSON(http.StatusOK, paymentResponse(intent))
+	}
+}
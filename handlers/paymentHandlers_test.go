@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/hex"
+	"main/config"
+	"main/helper"
+	"main/models"
+	"main/testdb"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestPaymentWebhook(t *testing.T) {
+	db := testdb.Open(t)
+	provider, err := helper.NewPaymentProvider(&config.PaymentConfig{Provider: "mock", MockWebhookSecret: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := newTestRouter(db)
+	r.POST("/payments/webhook", PaymentWebhook(db, provider))
+
+	user := testdb.CreateUser(t, db, "payer@example.com", "customer")
+	for _, externalID := range []string{"mock_1", "mock_2"} {
+		intent := models.PaymentIntent{
+			UserID:     user.ID,
+			Provider:   "mock",
+			ExternalID: externalID,
+			Amount:     5000,
+			Status:     helper.PaymentPending,
+			ExpiresAt:  time.Now().Add(time.Hour),
+		}
+		if err := db.Create(&intent).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	post := func(body, secret string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/payments/webhook", bytes.NewBufferString(body))
+		req.Header.Set(helper.MockSignatureHeader, hex.EncodeToString(helper.SignMockWebhook([]byte(secret), []byte(body))))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	balance := func() int {
+		var current models.User
+		if err := db.First(&current, user.ID).Error; err != nil {
+			t.Fatal(err)
+		}
+		return current.Balance
+	}
+	settled := `{"external_id":"mock_1","status":"settled"}`
+
+	if w := post(settled, "guess"); w.Code != http.StatusUnauthorized {
+		t.Errorf("forged webhook: %d %s, want 401", w.Code, w.Body)
+	}
+	if got := balance(); got != 0 {
+		t.Fatalf("balance after a forged webhook = %d, want 0", got)
+	}
+
+	for i := 0; i < 2; i++ {
+		w := post(settled, "secret")
+		if w.Code != http.StatusOK {
+			t.Fatalf("delivery %d: %d %s", i+1, w.Code, w.Body)
+		}
+	}
+	if got := balance(); got != 5000 {
+		t.Errorf("balance after a redelivered webhook = %d, want 5000", got)
+	}
+
+	if w := post(`{"external_id":"mock_1","status":"chargeback"}`, "secret"); w.Code != http.StatusOK {
+		t.Errorf("event for a settled intent: %d %s, want 200", w.Code, w.Body)
+	}
+	if w := post(`{"external_id":"mock_2","status":"chargeback"}`, "secret"); w.Code != http.StatusBadRequest {
+		t.Errorf("unknown status: %d %s, want 400", w.Code, w.Body)
+	}
+	if w := post(`{"external_id":"mock_3","status":"settled"}`, "secret"); w.Code != http.StatusNotFound {
+		t.Errorf("unknown intent: %d %s, want 404", w.Code, w.Body)
+	}
+	if w := post(`not json`, "secret"); w.Code != http.StatusBadRequest {
+		t.Errorf("malformed body: %d %s, want 400", w.Code, w.Body)
+	}
+}
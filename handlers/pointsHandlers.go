@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"main/config"
+	"main/helper"
+	"main/models"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+func GetPoints(db *gorm.DB, loyaltyConfig *config.LoyaltyConfig) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userIDParam, exists := c.Get("userID")
+		if !exists {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "User detail not found"})
+			return
+		}
+
+		userID, ok := userIDParam.(uint)
+		if !ok {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID"})
+			return
+		}
+
+		// Expire anything that ran out since the last sweep so the balance shown is spendable
+		var user models.User
+		err := db.Transaction(func(tx *gorm.DB) error {
+			locked, err := helper.ExpireUserPoints(tx, userID, time.Now())
+			if err != nil {
+				return err
+			}
+			user = *locked
+			return nil
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch points"})
+			return
+		}
+
+		page, limit := helper.GetPagination(c)
+
+		var total int64
+		if err := db.Model(&models.PointEntry{}).Where("user_id = ?", userID).Count(&total).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch point entries"})
+			return
+		}
+
+		var entries []models.PointEntry
+		err = db.Where("user_id = ?", userID).
+			Order("sequence DESC").
+			Offset((page - 1) * limit).
+			Limit(limit).
+			Find(&entries).Error
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch point entries"})
+			return
+		}
+
+		// Lots still holding points, soonest to expire first
+		var lots []models.PointEntry
+		if err := db.Where("user_id = ? AND remaining > 0", userID).Order("expires_at").Find(&lots).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch point entries"})
+			return
+		}
+		expiring := make([]gin.H, len(lots))
+		for i, lot := range lots {
+			expiring[i] = gin.H{"points": lot.Remaining, "expires_at": lot.ExpiresAt}
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"balance":     user.Points,
+			"point_value": models.NewMoney(loyaltyConfig.PointValue, models.BaseCurrency),
+			"expiring":    expiring,
+			"entries":     entries,
+			"page":        page,
+			"limit":       limit,
+			"total":       total,
+		})
+	}
+}
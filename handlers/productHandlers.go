@@ -1,21 +1,45 @@
 package handlers
 
 import (
+	"errors"
 	"main/helper"
 	"main/models"
+	"math"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type CreateProductInput struct {
-	Title      string `json:"title" validate:"required"`
-	Price      int    `json:"price" validate:"required,min=0,max=50000000"`
-	Stock      int    `json:"stock" validate:"required,min=5"`
-	CategoryID uint   `json:"category_id" validate:"required"`
+	Title       string `json:"title" validate:"required"`
+	Description string `json:"description" validate:"max=5000"`
+	Price       int    `json:"price" validate:"required,min=0,max=50000000"`
+	Currency    string `json:"currency" validate:"omitempty,len=3"`
+	Stock       int    `json:"stock" validate:"required,min=5"`
+	CategoryID  uint   `json:"category_id" validate:"required"`
+	WeightGrams int    `json:"weight_grams" validate:"min=0"`
+	LengthCm    int    `json:"length_cm" validate:"min=0"`
+	WidthCm     int    `json:"width_cm" validate:"min=0"`
+	HeightCm    int    `json:"height_cm" validate:"min=0"`
+	// BackorderMode is "backorder" or "preorder" to sell beyond stock,
+	// preorders need AvailableAt as their release date
+	BackorderMode string     `json:"backorder_mode" validate:"omitempty,oneof=backorder preorder"`
+	AvailableAt   *time.Time `json:"available_at" validate:"required_if=BackorderMode preorder"`
+}
+
+// currency returns the upper cased currency of the input, defaulting to the
+// base currency, and whether it is supported.
+func (input CreateProductInput) currency() (string, bool) {
+	if input.Currency == "" {
+		return models.BaseCurrency, true
+	}
+	currency, ok := models.LookupCurrency(input.Currency)
+	return currency.Code, ok
 }
 
 func CreateProduct(db *gorm.DB) gin.HandlerFunc {
@@ -33,19 +57,33 @@ func CreateProduct(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
-		// Create a new product
-		newProduct := models.Product{
-			Title:      input.Title,
-			Price:      input.Price,
-			Stock:      input.Stock,
-			CategoryID: input.CategoryID,
-		}
-
 		if err := helper.Validate(input); err != nil {
 			c.JSON(http.StatusBadRequest, err)
 			return
 		}
 
+		currency, ok := input.currency()
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unsupported currency"})
+			return
+		}
+
+		// Create a new product
+		newProduct := models.Product{
+			Title:         input.Title,
+			Description:   input.Description,
+			Price:         input.Price,
+			Currency:      currency,
+			Stock:         input.Stock,
+			CategoryID:    input.CategoryID,
+			WeightGrams:   input.WeightGrams,
+			LengthCm:      input.LengthCm,
+			WidthCm:       input.WidthCm,
+			HeightCm:      input.HeightCm,
+			BackorderMode: input.BackorderMode,
+			AvailableAt:   input.AvailableAt,
+		}
+
 		// Save the new product to the database
 		if err := db.Create(&newProduct).Error; err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create product"})
@@ -53,44 +91,284 @@ func CreateProduct(db *gorm.DB) gin.HandlerFunc {
 		}
 
 		c.JSON(http.StatusCreated, gin.H{
-			"id":          newProduct.ID,
-			"title":       newProduct.Title,
-			"stock":       newProduct.Stock,
-			"price":       newProduct.Price,
-			"category_Id": newProduct.CategoryID,
-			"created_at":  newProduct.CreatedAt,
+			"id":              newProduct.ID,
+			"title":           newProduct.Title,
+			"stock":           newProduct.Stock,
+			"price":           newProduct.Price,
+			"currency":        newProduct.PriceMoney().Currency,
+			"price_formatted": newProduct.PriceMoney().String(),
+			"category_Id":     newProduct.CategoryID,
+			"weight_grams":    newProduct.WeightGrams,
+			"backorder_mode":  newProduct.BackorderMode,
+			"available_at":    newProduct.AvailableAt,
+			"created_at":      newProduct.CreatedAt,
 		})
 	}
 }
 
+// saleResponse describes the sale a product is priced by, nil when there is none.
+func saleResponse(sale *models.Sale) map[string]interface{} {
+	if sale == nil {
+		return nil
+	}
+	return map[string]interface{}{
+		"id":        sale.ID,
+		"name":      sale.Name,
+		"percent":   sale.Percent,
+		"starts_at": sale.StartsAt,
+		"ends_at":   sale.EndsAt,
+	}
+}
+
+// parseProductFilter reads the listing filters from the query string. It
+// writes the error response itself.
+func parseProductFilter(c *gin.Context) (helper.ProductFilter, bool) {
+	var filter helper.ProductFilter
+
+	if categoryID := c.Query("category_id"); categoryID != "" {
+		id, err := strconv.ParseUint(categoryID, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid category ID"})
+			return filter, false
+		}
+		filter.CategoryID = uint(id)
+	}
+
+	for name, target := range map[string]**int{"min_price": &filter.MinPrice, "max_price": &filter.MaxPrice} {
+		if value := c.Query(name); value != "" {
+			price, err := strconv.Atoi(value)
+			if err != nil || price < 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + name})
+				return filter, false
+			}
+			*target = &price
+		}
+	}
+
+	for name, target := range map[string]**time.Time{"created_after": &filter.CreatedAfter, "created_before": &filter.CreatedBefore} {
+		if value := c.Query(name); value != "" {
+			date, err := parseDateQuery(value)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + name + ", use YYYY-MM-DD or RFC 3339"})
+				return filter, false
+			}
+			*target = &date
+		}
+	}
+
+	filter.InStock = c.Query("in_stock") == "true"
+	return filter, true
+}
+
+func parseDateQuery(value string) (time.Time, error) {
+	if date, err := time.Parse("2006-01-02", value); err == nil {
+		return date, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// pageLink returns the URL of the current request with its query parameters
+// replaced by params.
+func pageLink(c *gin.Context, params map[string]string) string {
+	link := *c.Request.URL
+	query := link.Query()
+	for name, value := range params {
+		if value == "" {
+			query.Del(name)
+		} else {
+			query.Set(name, value)
+		}
+	}
+	link.RawQuery = query.Encode()
+	return link.RequestURI()
+}
+
+// GetAllProducts lists products a page at a time. Pages are chosen either by
+// page number or, for stable scrolling while products change, by the cursor
+// returned with the previous page.
 func GetAllProducts(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		var products []models.Product
+		page, limit := helper.GetPagination(c)
+		cursor := c.Query("cursor")
+
+		sort := c.DefaultQuery("sort", "created_at")
+		if _, ok := helper.ProductSorts[sort]; !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Sort must be one of price, created_at, title or popularity"})
+			return
+		}
+		order := c.DefaultQuery("order", "desc")
+		if order != "asc" && order != "desc" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Order must be asc or desc"})
+			return
+		}
+		descending := order == "desc"
+
+		filter, ok := parseProductFilter(c)
+		if !ok {
+			return
+		}
+
+		var total int64
+		if err := helper.ProductListQuery(db, filter).Count(&total).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch products"})
+			return
+		}
 
-		// Retrieve all products from the database
-		if err := db.Find(&products).Error; err != nil {
+		query, err := helper.OrderProducts(helper.ProductListQuery(db, filter), sort, descending, cursor)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cursor"})
+			return
+		}
+		if cursor == "" {
+			query = query.Offset((page - 1) * limit)
+		}
+
+		var products []helper.ListedProduct
+		err = query.Select("products.*, COALESCE(product_sales.sold, 0) AS sold").
+			Limit(limit).
+			Find(&products).Error
+		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch products"})
 			return
 		}
 
+		sales, err := helper.ActiveSales(db, time.Now())
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch sales"})
+			return
+		}
+
 		transformedProducts := make([]map[string]interface{}, len(products))
 		for i, p := range products {
+			salePrice, sale := sales.Price(p.Product)
 			transformedProduct := map[string]interface{}{
-				"id":          p.ID,
-				"title":       p.Title,
-				"stock":       p.Stock,
-				"price":       p.Price,
-				"category_Id": p.CategoryID,
-				"created_at":  p.CreatedAt,
+				"id":                   p.ID,
+				"title":                p.Title,
+				"stock":                p.Stock,
+				"available_stock":      p.AvailableStock(),
+				"stock_status":         helper.StockStatus(p.Product, time.Now()),
+				"price":                p.Price,
+				"currency":             p.PriceMoney().Currency,
+				"price_formatted":      p.PriceMoney().String(),
+				"sale_price":           salePrice.Amount,
+				"sale_price_formatted": salePrice.String(),
+				"sale":                 saleResponse(sale),
+				"sold_count":           p.Sold,
+				"category_Id":          p.CategoryID,
+				"weight_grams":         p.WeightGrams,
+				"backorder_mode":       p.BackorderMode,
+				"available_at":         p.AvailableAt,
+				"created_at":           p.CreatedAt,
 			}
 			transformedProducts[i] = transformedProduct
 		}
 
-		c.JSON(http.StatusOK, transformedProducts)
+		// A full page may have more after it; the cursor picks up from its last product
+		nextCursor := ""
+		if len(products) == limit {
+			nextCursor = helper.EncodeProductCursor(products[len(products)-1], sort)
+		}
+
+		limitParam := strconv.Itoa(limit)
+		lastPage := int((total + int64(limit) - 1) / int64(limit))
+		if lastPage < 1 {
+			lastPage = 1
+		}
+		links := gin.H{
+			"self":  pageLink(c, map[string]string{}),
+			"first": pageLink(c, map[string]string{"page": "1", "limit": limitParam, "cursor": ""}),
+			"last":  pageLink(c, map[string]string{"page": strconv.Itoa(lastPage), "limit": limitParam, "cursor": ""}),
+			"next":  nil,
+			"prev":  nil,
+		}
+		if cursor != "" {
+			if nextCursor != "" {
+				links["next"] = pageLink(c, map[string]string{"cursor": nextCursor, "limit": limitParam, "page": ""})
+			}
+		} else {
+			if page < lastPage {
+				links["next"] = pageLink(c, map[string]string{"page": strconv.Itoa(page + 1), "limit": limitParam})
+			}
+			if page > 1 {
+				links["prev"] = pageLink(c, map[string]string{"page": strconv.Itoa(page - 1), "limit": limitParam})
+			}
+		}
+
+		response := gin.H{
+			"products":    transformedProducts,
+			"limit":       limit,
+			"total":       total,
+			"next_cursor": nil,
+			"links":       links,
+		}
+		if cursor == "" {
+			response["page"] = page
+		}
+		if nextCursor != "" {
+			response["next_cursor"] = nextCursor
+		}
+		c.JSON(http.StatusOK, response)
 	}
 }
 
-func UpdateProduct(db *gorm.DB) gin.HandlerFunc {
+// SearchProducts finds products by title, category and description, best
+// match first.
+func SearchProducts(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		query := strings.TrimSpace(c.Query("q"))
+		if query == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Search query q is required"})
+			return
+		}
+		if len(query) > 200 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Search query is too long"})
+			return
+		}
+
+		page, limit := helper.GetPagination(c)
+
+		results, total, err := helper.SearchProducts(db, query, (page-1)*limit, limit)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to search products"})
+			return
+		}
+
+		sales, err := helper.ActiveSales(db, time.Now())
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch sales"})
+			return
+		}
+
+		transformedProducts := make([]map[string]interface{}, len(results))
+		for i, result := range results {
+			p := result.Product
+			salePrice, sale := sales.Price(p)
+			transformedProducts[i] = map[string]interface{}{
+				"id":                   p.ID,
+				"title":                p.Title,
+				"stock_status":         helper.StockStatus(p, time.Now()),
+				"price":                p.Price,
+				"currency":             p.PriceMoney().Currency,
+				"price_formatted":      p.PriceMoney().String(),
+				"sale_price":           salePrice.Amount,
+				"sale_price_formatted": salePrice.String(),
+				"sale":                 saleResponse(sale),
+				"category_Id":          p.CategoryID,
+				"rank":                 math.Round(result.Rank*1000) / 1000,
+			}
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"query":    query,
+			"products": transformedProducts,
+			"page":     page,
+			"limit":    limit,
+			"total":    total,
+		})
+	}
+}
+
+func GetProduct(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		productID := c.Param("productId")
 		id, err := strconv.ParseUint(productID, 10, 64)
@@ -100,11 +378,83 @@ func UpdateProduct(db *gorm.DB) gin.HandlerFunc {
 		}
 
 		var product models.Product
-		if err := db.First(&product, id).Error; err != nil {
+		if err := db.Joins("Category").First(&product, id).Error; err != nil {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
 			return
 		}
 
+		sales, err := helper.ActiveSales(db, time.Now())
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch sales"})
+			return
+		}
+
+		var rating struct {
+			Average float64
+			Count   int64
+		}
+		err = db.Model(&models.ProductReview{}).
+			Select("COALESCE(AVG(rating), 0) AS average, COUNT(*) AS count").
+			Where("product_id = ?", product.ID).
+			Scan(&rating).Error
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch ratings"})
+			return
+		}
+
+		// Units refunded since were not sold after all
+		var sold int64
+		err = db.Model(&models.TransactionHistory{}).
+			Select("COALESCE(SUM(quantity - refunded_quantity), 0)").
+			Where("product_id = ?", product.ID).
+			Scan(&sold).Error
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch sold count"})
+			return
+		}
+
+		salePrice, sale := sales.Price(product)
+		c.JSON(http.StatusOK, gin.H{
+			"id":                   product.ID,
+			"title":                product.Title,
+			"description":          product.Description,
+			"price":                product.Price,
+			"currency":             product.PriceMoney().Currency,
+			"price_formatted":      product.PriceMoney().String(),
+			"sale_price":           salePrice.Amount,
+			"sale_price_formatted": salePrice.String(),
+			"sale":                 saleResponse(sale),
+			"stock":                product.Stock,
+			"available_stock":      product.AvailableStock(),
+			"stock_status":         helper.StockStatus(product, time.Now()),
+			"backorder_mode":       product.BackorderMode,
+			"available_at":         product.AvailableAt,
+			"category": gin.H{
+				"id":   product.Category.ID,
+				"type": product.Category.Type,
+			},
+			"average_rating": math.Round(rating.Average*10) / 10,
+			"rating_count":   rating.Count,
+			"sold_count":     sold,
+			"weight_grams":   product.WeightGrams,
+			"length_cm":      product.LengthCm,
+			"width_cm":       product.WidthCm,
+			"height_cm":      product.HeightCm,
+			"created_at":     product.CreatedAt,
+			"updated_at":     product.UpdatedAt,
+		})
+	}
+}
+
+func UpdateProduct(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		productID := c.Param("productId")
+		id, err := strconv.ParseUint(productID, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+			return
+		}
+
 		var input CreateProductInput
 		if err := c.ShouldBindJSON(&input); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
@@ -116,26 +466,78 @@ func UpdateProduct(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
-		// Update product details
-		product.Title = input.Title
-		product.Price = input.Price
-		product.Stock = input.Stock
-		product.CategoryID = input.CategoryID
-		product.UpdatedAt = time.Now()
+		currency, ok := input.currency()
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unsupported currency"})
+			return
+		}
 
-		if err := db.Save(&product).Error; err != nil {
+		// The row is locked so purchases and reservations cannot change it
+		// between reading it and writing it back. Only the editable columns
+		// are written, which leaves reserved to the reservations. Wishlist
+		// alerts are only sent when the change is saved, and added stock goes
+		// to backordered purchases before it is shown as back.
+		var product models.Product
+		err = db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&product, id).Error; err != nil {
+				return err
+			}
+			oldPrice, oldStock := product.PriceMoney(), product.Stock
+
+			product.Title = input.Title
+			product.Description = input.Description
+			product.Price = input.Price
+			product.Currency = currency
+			product.Stock = input.Stock
+			product.CategoryID = input.CategoryID
+			product.WeightGrams = input.WeightGrams
+			product.LengthCm = input.LengthCm
+			product.WidthCm = input.WidthCm
+			product.HeightCm = input.HeightCm
+			product.BackorderMode = input.BackorderMode
+			product.AvailableAt = input.AvailableAt
+			product.UpdatedAt = time.Now()
+			err := tx.Model(&product).
+				Select("title", "description", "price", "currency", "stock", "category_id",
+					"weight_grams", "length_cm", "width_cm", "height_cm",
+					"backorder_mode", "available_at", "updated_at").
+				Updates(&product).Error
+			if err != nil {
+				return err
+			}
+
+			allocated, err := helper.AllocateBackorders(tx, product.ID)
+			if err != nil {
+				return err
+			}
+			product = *allocated
+			if err := helper.NotifyPriceDrop(tx, product, oldPrice); err != nil {
+				return err
+			}
+			return helper.NotifyBackInStock(tx, product, oldStock)
+		})
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+			return
+		}
+		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update product"})
 			return
 		}
 
 		dataProduct := map[string]interface{}{
-			"id":         product.ID,
-			"title":      product.Title,
-			"stock":      product.Stock,
-			"price":      product.Price,
-			"CategoryId": product.CategoryID,
-			"createdAt":  product.CreatedAt,
-			"updatedAt":  product.UpdatedAt,
+			"id":              product.ID,
+			"title":           product.Title,
+			"stock":           product.Stock,
+			"price":           product.Price,
+			"currency":        product.PriceMoney().Currency,
+			"price_formatted": product.PriceMoney().String(),
+			"CategoryId":      product.CategoryID,
+			"weight_grams":    product.WeightGrams,
+			"backorder_mode":  product.BackorderMode,
+			"available_at":    product.AvailableAt,
+			"createdAt":       product.CreatedAt,
+			"updatedAt":       product.UpdatedAt,
 		}
 
 		c.JSON(http.StatusOK, gin.H{"product": dataProduct})
@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"main/models"
+	"main/testdb"
+	"net/http"
+	"testing"
+)
+
+func TestGetAllProductsOrder(t *testing.T) {
+	db := testdb.Open(t)
+	r := newTestRouter(db)
+	r.GET("/products", GetAllProducts(db))
+
+	for _, title := range []string{"Apple", "Banana", "Cherry"} {
+		testdb.CreateProduct(t, db, models.Product{Title: title, Price: 1000, Stock: 5})
+	}
+
+	tests := []struct {
+		query string
+		code  int
+		first string
+	}{
+		{"?sort=title", http.StatusOK, "Cherry"},
+		{"?sort=title&order=desc", http.StatusOK, "Cherry"},
+		{"?sort=title&order=asc", http.StatusOK, "Apple"},
+		{"?sort=title&order=ascending", http.StatusBadRequest, ""},
+		{"?sort=title&order=", http.StatusBadRequest, ""},
+		{"?sort=name", http.StatusBadRequest, ""},
+	}
+	for _, tt := range tests {
+		w := serve(t, r, http.MethodGet, "/products"+tt.query, models.User{}, nil)
+		if w.Code != tt.code {
+			t.Errorf("GET /products%s: %d %s, want %d", tt.query, w.Code, w.Body, tt.code)
+			continue
+		}
+		if tt.code != http.StatusOK {
+			continue
+		}
+		var page struct {
+			Products []struct {
+				Title string `json:"title"`
+			} `json:"products"`
+		}
+		decode(t, w, &page)
+		if len(page.Products) != 3 || page.Products[0].Title != tt.first {
+			t.Errorf("GET /products%s = %+v, want %s first", tt.query, page.Products, tt.first)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"main/helper"
+	"main/models"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type ProductReviewInput struct {
+	Rating  int    `json:"rating" validate:"required,min=1,max=5"`
+	Comment string `json:"comment" validate:"max=2000"`
+}
+
+func GetProductReviews(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		productID, err := strconv.ParseUint(c.Param("productId"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+			return
+		}
+
+		var product models.Product
+		if err := db.First(&product, productID).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+			return
+		}
+
+		page, limit := helper.GetPagination(c)
+
+		query := db.Model(&models.ProductReview{}).Where("product_id = ?", product.ID)
+
+		var total int64
+		if err := query.Count(&total).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch reviews"})
+			return
+		}
+
+		var reviews []models.ProductReview
+		err = query.Order("id DESC").
+			Offset((page - 1) * limit).
+			Limit(limit).
+			Find(&reviews).Error
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch reviews"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"reviews": reviews,
+			"page":    page,
+			"limit":   limit,
+			"total":   total,
+		})
+	}
+}
+
+// ReviewProduct rates a product the customer has bought. Reviewing it again
+// replaces their earlier review.
+func ReviewProduct(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userIDParam, exists := c.Get("userID")
+		if !exists {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "User detail not found"})
+			return
+		}
+
+		productID, err := strconv.ParseUint(c.Param("productId"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+			return
+		}
+
+		var product models.Product
+		if err := db.First(&product, productID).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+			return
+		}
+
+		var input ProductReviewInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := helper.Validate(input); err != nil {
+			c.JSON(http.StatusBadRequest, err)
+			return
+		}
+
+		var bought int64
+		err = db.Model(&models.TransactionHistory{}).
+			Where("user_id = ? AND product_id = ? AND refunded_quantity < quantity", userIDParam, product.ID).
+			Count(&bought).Error
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save review"})
+			return
+		}
+		if bought == 0 {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Only customers who bought this product can review it"})
+			return
+		}
+
+		review := models.ProductReview{
+			UserID:    userIDParam.(uint),
+			ProductID: product.ID,
+			Rating:    input.Rating,
+			Comment:   input.Comment,
+		}
+		err = db.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "user_id"}, {Name: "product_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"rating", "comment", "updated_at"}),
+		}).Create(&review).Error
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save review"})
+			return
+		}
+
+		c.JSON(http.StatusOK, review)
+	}
+}
@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"fmt"
+	"main/models"
+	"main/testdb"
+	"net/http"
+	"testing"
+)
+
+func TestProductReviews(t *testing.T) {
+	db := testdb.Open(t)
+	r := newTestRouter(db)
+	r.GET("/products/:productId/reviews", GetProductReviews(db))
+	r.POST("/products/:productId/reviews", ReviewProduct(db))
+
+	product := testdb.CreateProduct(t, db, models.Product{Title: "Kettle", Price: 15000, Stock: 5})
+	deleted := testdb.CreateProduct(t, db, models.Product{Title: "Gone", Price: 15000, Stock: 5})
+	if err := db.Delete(&deleted).Error; err != nil {
+		t.Fatal(err)
+	}
+	buyer := testdb.CreateUser(t, db, "buyer@example.com", "customer")
+	browser := testdb.CreateUser(t, db, "browser@example.com", "customer")
+	purchase := models.TransactionHistory{ProductID: product.ID, UserID: buyer.ID, Quantity: 1, TotalPrice: 15000}
+	if err := db.Create(&purchase).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	missing := fmt.Sprintf("/products/%d/reviews", deleted.ID+100)
+	for _, path := range []string{missing, fmt.Sprintf("/products/%d/reviews", deleted.ID)} {
+		if w := serve(t, r, http.MethodGet, path, models.User{}, nil); w.Code != http.StatusNotFound {
+			t.Errorf("GET %s: %d %s, want 404", path, w.Code, w.Body)
+		}
+		if w := serve(t, r, http.MethodPost, path, buyer, ProductReviewInput{Rating: 5}); w.Code != http.StatusNotFound {
+			t.Errorf("POST %s: %d %s, want 404", path, w.Code, w.Body)
+		}
+	}
+	if w := serve(t, r, http.MethodGet, "/products/abc/reviews", models.User{}, nil); w.Code != http.StatusBadRequest {
+		t.Errorf("invalid product ID: %d, want 400", w.Code)
+	}
+
+	path := fmt.Sprintf("/products/%d/reviews", product.ID)
+	var page struct {
+		Reviews []models.ProductReview `json:"reviews"`
+		Total   int64                  `json:"total"`
+	}
+	w := serve(t, r, http.MethodGet, path, models.User{}, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("reviews of a product without any: %d %s", w.Code, w.Body)
+	}
+	decode(t, w, &page)
+	if page.Total != 0 || len(page.Reviews) != 0 {
+		t.Errorf("reviews = %+v, want none", page)
+	}
+
+	if w := serve(t, r, http.MethodPost, path, browser, ProductReviewInput{Rating: 1}); w.Code != http.StatusForbidden {
+		t.Errorf("review without buying: %d %s, want 403", w.Code, w.Body)
+	}
+	for _, rating := range []int{2, 4} {
+		if w := serve(t, r, http.MethodPost, path, buyer, ProductReviewInput{Rating: rating, Comment: "ok"}); w.Code != http.StatusOK {
+			t.Fatalf("review: %d %s", w.Code, w.Body)
+		}
+	}
+	decode(t, serve(t, r, http.MethodGet, path, models.User{}, nil), &page)
+	if page.Total != 1 || len(page.Reviews) != 1 || page.Reviews[0].Rating != 4 {
+		t.Errorf("reviews = %+v, want the second review replacing the first", page)
+	}
+}
@@ -0,0 +1,174 @@
+package handlers
+
+import (
+	"main/helper"
+	"main/models"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type SaleInput struct {
+	Name       string    `json:"name" validate:"required,max=255"`
+	Percent    int       `json:"percent" validate:"required,min=1,max=100"`
+	CategoryID uint      `json:"category_id"`
+	ProductID  uint      `json:"product_id"`
+	StartsAt   time.Time `json:"starts_at" validate:"required"`
+	EndsAt     time.Time `json:"ends_at" validate:"required"`
+}
+
+func saleAdminResponse(sale models.Sale, now time.Time) map[string]interface{} {
+	return map[string]interface{}{
+		"id":          sale.ID,
+		"name":        sale.Name,
+		"percent":     sale.Percent,
+		"category_id": sale.CategoryID,
+		"product_id":  sale.ProductID,
+		"starts_at":   sale.StartsAt,
+		"ends_at":     sale.EndsAt,
+		"active":      !now.Before(sale.StartsAt) && now.Before(sale.EndsAt),
+		"created_at":  sale.CreatedAt,
+		"updated_at":  sale.UpdatedAt,
+	}
+}
+
+// bindSaleInput reads and validates a sale, writing the error response itself.
+func bindSaleInput(c *gin.Context, db *gorm.DB) (*SaleInput, bool) {
+	var input SaleInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, false
+	}
+
+	if err := helper.Validate(input); err != nil {
+		c.JSON(http.StatusBadRequest, err)
+		return nil, false
+	}
+
+	if (input.CategoryID == 0) == (input.ProductID == 0) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A sale covers either a category or a product"})
+		return nil, false
+	}
+	if !input.EndsAt.After(input.StartsAt) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Sale must end after it starts"})
+		return nil, false
+	}
+
+	if input.CategoryID != 0 {
+		var category models.Category
+		if err := db.First(&category, input.CategoryID).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Category not found"})
+			return nil, false
+		}
+	}
+	if input.ProductID != 0 {
+		var product models.Product
+		if err := db.First(&product, input.ProductID).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+			return nil, false
+		}
+	}
+
+	return &input, true
+}
+
+func GetSales(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var sales []models.Sale
+		if err := db.Order("starts_at DESC").Find(&sales).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch sales"})
+			return
+		}
+
+		now := time.Now()
+		transformedSales := make([]map[string]interface{}, len(sales))
+		for i, sale := range sales {
+			transformedSales[i] = saleAdminResponse(sale, now)
+		}
+		c.JSON(http.StatusOK, transformedSales)
+	}
+}
+
+func CreateSale(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		input, ok := bindSaleInput(c, db)
+		if !ok {
+			return
+		}
+
+		sale := models.Sale{
+			Name:       input.Name,
+			Percent:    input.Percent,
+			CategoryID: input.CategoryID,
+			ProductID:  input.ProductID,
+			StartsAt:   input.StartsAt,
+			EndsAt:     input.EndsAt,
+		}
+		if err := db.Create(&sale).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create sale"})
+			return
+		}
+
+		c.JSON(http.StatusCreated, saleAdminResponse(sale, time.Now()))
+	}
+}
+
+func UpdateSale(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.ParseUint(c.Param("saleId"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid sale ID"})
+			return
+		}
+
+		var sale models.Sale
+		if err := db.First(&sale, id).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Sale not found"})
+			return
+		}
+
+		input, ok := bindSaleInput(c, db)
+		if !ok {
+			return
+		}
+
+		sale.Name = input.Name
+		sale.Percent = input.Percent
+		sale.CategoryID = input.CategoryID
+		sale.ProductID = input.ProductID
+		sale.StartsAt = input.StartsAt
+		sale.EndsAt = input.EndsAt
+		if err := db.Save(&sale).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update sale"})
+			return
+		}
+
+		c.JSON(http.StatusOK, saleAdminResponse(sale, time.Now()))
+	}
+}
+
+func DeleteSale(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.ParseUint(c.Param("saleId"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid sale ID"})
+			return
+		}
+
+		var sale models.Sale
+		if err := db.First(&sale, id).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Sale not found"})
+			return
+		}
+
+		if err := db.Delete(&sale).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete sale"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Sale has been successfully deleted"})
+	}
+}
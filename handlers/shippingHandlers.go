@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"main/helper"
+	"main/models"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type ShippingRateInput struct {
+	Province       string `json:"province" validate:"required"`
+	MaxWeightGrams int    `json:"max_weight_grams" validate:"required,min=1"`
+	Cost           int    `json:"cost" validate:"min=0"`
+	ExtraPerKg     int    `json:"extra_per_kg" validate:"min=0"`
+}
+
+func shippingRateResponse(rate models.ShippingRate) map[string]interface{} {
+	return map[string]interface{}{
+		"id":               rate.ID,
+		"province":         rate.Province,
+		"max_weight_grams": rate.MaxWeightGrams,
+		"cost":             rate.Cost,
+		"extra_per_kg":     rate.ExtraPerKg,
+		"created_at":       rate.CreatedAt,
+		"updated_at":       rate.UpdatedAt,
+	}
+}
+
+func GetShippingRates(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var rates []models.ShippingRate
+		if err := db.Order("province, max_weight_grams").Find(&rates).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch shipping rates"})
+			return
+		}
+
+		transformedRates := make([]map[string]interface{}, len(rates))
+		for i, rate := range rates {
+			transformedRates[i] = shippingRateResponse(rate)
+		}
+		c.JSON(http.StatusOK, transformedRates)
+	}
+}
+
+func CreateShippingRate(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input ShippingRateInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := helper.Validate(input); err != nil {
+			c.JSON(http.StatusBadRequest, err)
+			return
+		}
+
+		rate := models.ShippingRate{
+			Province:       helper.NormalizeProvince(input.Province),
+			MaxWeightGrams: input.MaxWeightGrams,
+			Cost:           input.Cost,
+			ExtraPerKg:     input.ExtraPerKg,
+		}
+		if err := db.Create(&rate).Error; err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "A rate for this province and weight already exists"})
+			return
+		}
+
+		c.JSON(http.StatusCreated, shippingRateResponse(rate))
+	}
+}
+
+func DeleteShippingRate(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.ParseUint(c.Param("rateId"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid shipping rate ID"})
+			return
+		}
+
+		var rate models.ShippingRate
+		if err := db.First(&rate, id).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Shipping rate not found"})
+			return
+		}
+
+		// Hard delete so the province and weight can be priced again
+		if err := db.Unscoped().Delete(&rate).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete shipping rate"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Shipping rate has been successfully deleted"})
+	}
+}
@@ -0,0 +1,330 @@
+package handlers
+
+import (
+	"errors"
+	"main/helper"
+	"main/models"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type SubscriptionPlanInput struct {
+	ProductID    uint   `json:"product_id" validate:"required"`
+	Name         string `json:"name" validate:"required,max=100"`
+	IntervalDays int    `json:"interval_days" validate:"required,min=1,max=365"`
+	Quantity     int    `json:"quantity" validate:"required,min=1"`
+	Active       *bool  `json:"active"`
+}
+
+type SubscribeInput struct {
+	PlanID uint `json:"plan_id" validate:"required"`
+	// AddressID selects the shipping address, 0 uses the default one.
+	AddressID uint `json:"address_id"`
+	// StartsAt is when the first order is placed, now when left out.
+	StartsAt *time.Time `json:"starts_at"`
+}
+
+func subscriptionResponse(subscription models.Subscription) map[string]interface{} {
+	return map[string]interface{}{
+		"id":            subscription.ID,
+		"plan_id":       subscription.PlanID,
+		"product_id":    subscription.ProductID,
+		"quantity":      subscription.Quantity,
+		"interval_days": subscription.IntervalDays,
+		"address_id":    subscription.AddressID,
+		"status":        subscription.Status,
+		"next_run_at":   subscription.NextRunAt,
+		"last_run_at":   subscription.LastRunAt,
+		"last_order_id": subscription.LastOrderID,
+		"last_error":    subscription.LastError,
+		"cancelled_at":  subscription.CancelledAt,
+		"created_at":    subscription.CreatedAt,
+	}
+}
+
+func GetSubscriptionPlans(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		query := db.Where("active = ?", true)
+		if productID := c.Query("product_id"); productID != "" {
+			query = query.Where("product_id = ?", productID)
+		}
+
+		var plans []models.SubscriptionPlan
+		if err := query.Order("product_id, interval_days").Find(&plans).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch subscription plans"})
+			return
+		}
+
+		c.JSON(http.StatusOK, plans)
+	}
+}
+
+func CreateSubscriptionPlan(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input SubscriptionPlanInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := helper.Validate(input); err != nil {
+			c.JSON(http.StatusBadRequest, err)
+			return
+		}
+
+		var product models.Product
+		if err := db.First(&product, input.ProductID).Error; err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Product ID not found"})
+			return
+		}
+
+		plan := models.SubscriptionPlan{
+			ProductID:    input.ProductID,
+			Name:         input.Name,
+			IntervalDays: input.IntervalDays,
+			Quantity:     input.Quantity,
+			Active:       input.Active == nil || *input.Active,
+		}
+		if err := db.Create(&plan).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create subscription plan"})
+			return
+		}
+
+		c.JSON(http.StatusCreated, plan)
+	}
+}
+
+// UpdateSubscriptionPlan changes a plan for new subscribers. Running
+// subscriptions keep the terms they signed up with.
+func UpdateSubscriptionPlan(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.ParseUint(c.Param("planId"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid plan ID"})
+			return
+		}
+
+		var plan models.SubscriptionPlan
+		if err := db.First(&plan, id).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Subscription plan not found"})
+			return
+		}
+
+		var input SubscriptionPlanInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := helper.Validate(input); err != nil {
+			c.JSON(http.StatusBadRequest, err)
+			return
+		}
+
+		var product models.Product
+		if err := db.First(&product, input.ProductID).Error; err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Product ID not found"})
+			return
+		}
+
+		plan.ProductID = input.ProductID
+		plan.Name = input.Name
+		plan.IntervalDays = input.IntervalDays
+		plan.Quantity = input.Quantity
+		if input.Active != nil {
+			plan.Active = *input.Active
+		}
+		if err := db.Save(&plan).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update subscription plan"})
+			return
+		}
+
+		c.JSON(http.StatusOK, plan)
+	}
+}
+
+func GetSubscriptions(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userIDParam, exists := c.Get("userID")
+		if !exists {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "User detail not found"})
+			return
+		}
+
+		var subscriptions []models.Subscription
+		if err := db.Where("user_id = ?", userIDParam).Order("id DESC").Find(&subscriptions).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch subscriptions"})
+			return
+		}
+
+		transformedSubscriptions := make([]map[string]interface{}, len(subscriptions))
+		for i, subscription := range subscriptions {
+			transformedSubscriptions[i] = subscriptionResponse(subscription)
+		}
+
+		c.JSON(http.StatusOK, transformedSubscriptions)
+	}
+}
+
+func CreateSubscription(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userIDParam, exists := c.Get("userID")
+		if !exists {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "User detail not found"})
+			return
+		}
+		userID := userIDParam.(uint)
+
+		var input SubscribeInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := helper.Validate(input); err != nil {
+			c.JSON(http.StatusBadRequest, err)
+			return
+		}
+
+		var plan models.SubscriptionPlan
+		if err := db.Where("id = ? AND active = ?", input.PlanID, true).First(&plan).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Subscription plan not found"})
+			return
+		}
+
+		// Check the address now rather than on the first order. Like
+		// purchases, subscribers without an address who did not pick one
+		// get their orders unshipped.
+		_, err := helper.ShippingAddress(db, userID, input.AddressID)
+		if err != nil && !(errors.Is(err, helper.ErrAddressRequired) && input.AddressID == 0) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Shipping address not found, add one before subscribing"})
+			return
+		}
+
+		now := time.Now()
+		nextRunAt := now
+		if input.StartsAt != nil {
+			if input.StartsAt.Before(now) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Subscriptions cannot start in the past"})
+				return
+			}
+			nextRunAt = *input.StartsAt
+		}
+
+		subscription := models.Subscription{
+			UserID:       userID,
+			PlanID:       plan.ID,
+			ProductID:    plan.ProductID,
+			Quantity:     plan.Quantity,
+			IntervalDays: plan.IntervalDays,
+			AddressID:    input.AddressID,
+			Status:       helper.SubscriptionActive,
+			NextRunAt:    nextRunAt,
+		}
+		if err := db.Create(&subscription).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create subscription"})
+			return
+		}
+
+		c.JSON(http.StatusCreated, subscriptionResponse(subscription))
+	}
+}
+
+// changeSubscription loads the customer's subscription and applies change to
+// it, which returns an error message when the subscription cannot be changed
+// that way. It writes the response itself.
+func changeSubscription(db *gorm.DB, change func(subscription *models.Subscription, now time.Time) string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userIDParam, exists := c.Get("userID")
+		if !exists {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "User detail not found"})
+			return
+		}
+
+		id, err := strconv.ParseUint(c.Param("subscriptionId"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid subscription ID"})
+			return
+		}
+
+		var subscription models.Subscription
+		var conflict string
+		err = db.Transaction(func(tx *gorm.DB) error {
+			err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+				Where("id = ? AND user_id = ?", id, userIDParam).
+				First(&subscription).Error
+			if err != nil {
+				return err
+			}
+			if conflict = change(&subscription, time.Now()); conflict != "" {
+				return nil
+			}
+			return tx.Save(&subscription).Error
+		})
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Subscription not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update subscription"})
+			return
+		}
+		if conflict != "" {
+			c.JSON(http.StatusConflict, gin.H{"error": conflict})
+			return
+		}
+
+		c.JSON(http.StatusOK, subscriptionResponse(subscription))
+	}
+}
+
+func PauseSubscription(db *gorm.DB) gin.HandlerFunc {
+	return changeSubscription(db, func(subscription *models.Subscription, now time.Time) string {
+		if subscription.Status != helper.SubscriptionActive {
+			return "Only active subscriptions can be paused"
+		}
+		subscription.Status = helper.SubscriptionPaused
+		return ""
+	})
+}
+
+// ResumeSubscription picks the schedule up again at its next run after now,
+// without placing the orders missed while paused.
+func ResumeSubscription(db *gorm.DB) gin.HandlerFunc {
+	return changeSubscription(db, func(subscription *models.Subscription, now time.Time) string {
+		if subscription.Status != helper.SubscriptionPaused {
+			return "Only paused subscriptions can be resumed"
+		}
+		subscription.Status = helper.SubscriptionActive
+		subscription.NextRunAt = helper.NextSubscriptionRun(*subscription, now)
+		return ""
+	})
+}
+
+// SkipSubscription moves the next order one interval further out.
+func SkipSubscription(db *gorm.DB) gin.HandlerFunc {
+	return changeSubscription(db, func(subscription *models.Subscription, now time.Time) string {
+		if subscription.Status != helper.SubscriptionActive {
+			return "Only active subscriptions can skip an order"
+		}
+		subscription.NextRunAt = subscription.NextRunAt.AddDate(0, 0, subscription.IntervalDays)
+		subscription.NextRunAt = helper.NextSubscriptionRun(*subscription, now)
+		return ""
+	})
+}
+
+func CancelSubscription(db *gorm.DB) gin.HandlerFunc {
+	return changeSubscription(db, func(subscription *models.Subscription, now time.Time) string {
+		if subscription.Status == helper.SubscriptionCancelled {
+			return "Subscription is already cancelled"
+		}
+		subscription.Status = helper.SubscriptionCancelled
+		subscription.CancelledAt = &now
+		return ""
+	})
+}
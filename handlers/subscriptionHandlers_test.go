@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"main/config"
+	"main/helper"
+	"main/models"
+	"main/testdb"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestCreateSubscriptionAddress(t *testing.T) {
+	db := testdb.Open(t)
+	r := newTestRouter(db)
+	r.POST("/subscriptions", CreateSubscription(db))
+
+	product := testdb.CreateProduct(t, db, models.Product{Title: "E-book club", Price: 5000, Stock: 100})
+	plan := models.SubscriptionPlan{ProductID: product.ID, Name: "Monthly", IntervalDays: 30, Quantity: 1}
+	if err := db.Create(&plan).Error; err != nil {
+		t.Fatal(err)
+	}
+	reader := testdb.CreateUser(t, db, "reader@example.com", "customer")
+	topUp(t, db, reader.ID, 20000)
+	shipper := testdb.CreateUser(t, db, "shipper@example.com", "customer")
+	address := models.Address{
+		UserID: shipper.ID, RecipientName: "Ani", Phone: "0812", Street: "Jl. Merdeka 1",
+		City: "Bandung", Province: "JAWA BARAT", PostalCode: "40111",
+	}
+	if err := db.Create(&address).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	var subscription struct {
+		ID        uint `json:"id"`
+		AddressID uint `json:"address_id"`
+	}
+
+	// Products that are not shipped need no address.
+	w := serve(t, r, http.MethodPost, "/subscriptions", reader, SubscribeInput{PlanID: plan.ID})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("subscribing without an address: %d %s", w.Code, w.Body)
+	}
+	decode(t, w, &subscription)
+	if subscription.AddressID != 0 {
+		t.Errorf("subscription ships to address %d, want none", subscription.AddressID)
+	}
+
+	// An address that was asked for has to be the subscriber's own.
+	if w := serve(t, r, http.MethodPost, "/subscriptions", reader, SubscribeInput{PlanID: plan.ID, AddressID: address.ID}); w.Code != http.StatusBadRequest {
+		t.Errorf("subscribing with someone else's address: %d %s, want 400", w.Code, w.Body)
+	}
+	w = serve(t, r, http.MethodPost, "/subscriptions", shipper, SubscribeInput{PlanID: plan.ID, AddressID: address.ID})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("subscribing with an address: %d %s", w.Code, w.Body)
+	}
+	var shipped struct {
+		AddressID uint `json:"address_id"`
+	}
+	decode(t, w, &shipped)
+	if shipped.AddressID != address.ID {
+		t.Errorf("subscription ships to address %d, want %d", shipped.AddressID, address.ID)
+	}
+
+	// The first order of the subscription without an address goes through
+	// without shipping.
+	if err := helper.RunSubscriptions(db, &config.TaxConfig{Name: "PPN"}, nil, time.Now().Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	var orders []models.Order
+	if err := db.Where("user_id = ?", reader.ID).Find(&orders).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(orders) != 1 || orders[0].ShipTo != "" || orders[0].ShippingCost != 0 {
+		t.Errorf("orders of the subscription = %+v, want one without shipping", orders)
+	}
+	assertBalance(t, db, reader.ID, 15000)
+}
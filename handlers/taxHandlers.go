@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"main/helper"
+	"main/models"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type TaxClassInput struct {
+	Name string `json:"name" validate:"required,max=64"`
+	// Rate is in basis points, 1100 is 11%. 0 exempts the class from tax.
+	Rate int `json:"rate" validate:"min=0,max=10000"`
+}
+
+func taxClassResponse(taxClass models.TaxClass) map[string]interface{} {
+	return map[string]interface{}{
+		"id":             taxClass.ID,
+		"name":           taxClass.Name,
+		"rate":           taxClass.Rate,
+		"rate_formatted": helper.FormatTaxRate(taxClass.Rate),
+		"created_at":     taxClass.CreatedAt,
+		"updated_at":     taxClass.UpdatedAt,
+	}
+}
+
+func GetTaxClasses(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var taxClasses []models.TaxClass
+		if err := db.Order("name").Find(&taxClasses).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch tax classes"})
+			return
+		}
+
+		transformedTaxClasses := make([]map[string]interface{}, len(taxClasses))
+		for i, taxClass := range taxClasses {
+			transformedTaxClasses[i] = taxClassResponse(taxClass)
+		}
+		c.JSON(http.StatusOK, transformedTaxClasses)
+	}
+}
+
+func CreateTaxClass(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input TaxClassInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := helper.Validate(input); err != nil {
+			c.JSON(http.StatusBadRequest, err)
+			return
+		}
+
+		taxClass := models.TaxClass{Name: input.Name, Rate: input.Rate}
+		if err := db.Create(&taxClass).Error; err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "A tax class with this name already exists"})
+			return
+		}
+
+		c.JSON(http.StatusCreated, taxClassResponse(taxClass))
+	}
+}
+
+// UpdateTaxClass changes the rate for future purchases, transactions keep the
+// rate they were taxed at.
+func UpdateTaxClass(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.ParseUint(c.Param("taxClassId"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid tax class ID"})
+			return
+		}
+
+		var taxClass models.TaxClass
+		if err := db.First(&taxClass, id).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Tax class not found"})
+			return
+		}
+
+		var input TaxClassInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := helper.Validate(input); err != nil {
+			c.JSON(http.StatusBadRequest, err)
+			return
+		}
+
+		taxClass.Name = input.Name
+		taxClass.Rate = input.Rate
+		if err := db.Save(&taxClass).Error; err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "A tax class with this name already exists"})
+			return
+		}
+
+		c.JSON(http.StatusOK, taxClassResponse(taxClass))
+	}
+}
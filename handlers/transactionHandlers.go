@@ -1,9 +1,17 @@
 package handlers
 
 import (
+	"errors"
+	"fmt"
+	"io"
+	"main/config"
 	"main/helper"
 	"main/models"
 	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
@@ -23,19 +31,32 @@ func GetTransactionHistoriesForUser(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
+		query := db.Joins("Product").Where("user_id = ?", userID)
+		if invoiceNumber := c.Query("invoice_number"); invoiceNumber != "" {
+			query = query.Where("invoice_number LIKE ?", invoiceNumberPattern(invoiceNumber))
+		}
+
 		var transactionHistories []models.TransactionHistory
-		if err := db.Joins("Product").Where("user_id = ?", userID).Find(&transactionHistories).Error; err != nil {
+		if err := query.Find(&transactionHistories).Error; err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch transaction histories"})
 			return
 		}
 		transformedTransactionHistories := make([]map[string]interface{}, len(transactionHistories))
 		for i, t := range transactionHistories {
 			transformedTransaction := map[string]interface{}{
-				"id":          t.ID,
-				"product_id":  t.ProductID,
-				"user_id":     t.UserID,
-				"quantity":    t.Quantity,
-				"total_price": t.TotalPrice,
+				"id":                    t.ID,
+				"product_id":            t.ProductID,
+				"user_id":               t.UserID,
+				"quantity":              t.Quantity,
+				"backordered_quantity":  t.BackorderedQuantity,
+				"subtotal":              t.Subtotal,
+				"tax":                   t.Tax,
+				"tax_rate":              t.TaxRate,
+				"total_price":           t.TotalPrice,
+				"total_price_formatted": t.TotalPriceMoney().String(),
+				"invoice_number":        t.InvoiceNumber,
+				"unit_price":            t.UnitPrice,
+				"currency":              t.Currency,
 				"Product": map[string]interface{}{
 					"id":          t.Product.ID,
 					"title":       t.Product.Title,
@@ -54,8 +75,13 @@ func GetTransactionHistoriesForUser(db *gorm.DB) gin.HandlerFunc {
 
 func GetAllTransactionHistories(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		query := db.Joins("Product").Joins("User")
+		if invoiceNumber := c.Query("invoice_number"); invoiceNumber != "" {
+			query = query.Where("invoice_number LIKE ?", invoiceNumberPattern(invoiceNumber))
+		}
+
 		var transactionHistories []models.TransactionHistory
-		if err := db.Joins("Product").Joins("User").Find(&transactionHistories).Error; err != nil {
+		if err := query.Find(&transactionHistories).Error; err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch transaction histories"})
 			return
 		}
@@ -63,11 +89,19 @@ func GetAllTransactionHistories(db *gorm.DB) gin.HandlerFunc {
 		transformedTransactionHistories := make([]map[string]interface{}, len(transactionHistories))
 		for i, t := range transactionHistories {
 			transformedTransaction := map[string]interface{}{
-				"id":          t.ID,
-				"product_id":  t.ProductID,
-				"user_id":     t.UserID,
-				"quantity":    t.Quantity,
-				"total_price": t.TotalPrice,
+				"id":                    t.ID,
+				"product_id":            t.ProductID,
+				"user_id":               t.UserID,
+				"quantity":              t.Quantity,
+				"backordered_quantity":  t.BackorderedQuantity,
+				"subtotal":              t.Subtotal,
+				"tax":                   t.Tax,
+				"tax_rate":              t.TaxRate,
+				"total_price":           t.TotalPrice,
+				"total_price_formatted": t.TotalPriceMoney().String(),
+				"invoice_number":        t.InvoiceNumber,
+				"unit_price":            t.UnitPrice,
+				"currency":              t.Currency,
 				"Product": map[string]interface{}{
 					"id":          t.Product.ID,
 					"title":       t.Product.Title,
@@ -78,12 +112,13 @@ func GetAllTransactionHistories(db *gorm.DB) gin.HandlerFunc {
 					"updated_at":  t.Product.UpdatedAt,
 				},
 				"User": map[string]interface{}{
-					"id":         t.User.ID,
-					"email":      t.User.Email,
-					"full_name":  t.User.FullName,
-					"balance":    t.User.Balance,
-					"created_at": t.User.CreatedAt,
-					"updated_at": t.User.UpdatedAt,
+					"id":                t.User.ID,
+					"email":             t.User.Email,
+					"full_name":         t.User.FullName,
+					"balance":           t.User.Balance,
+					"balance_formatted": t.User.BalanceMoney().String(),
+					"created_at":        t.User.CreatedAt,
+					"updated_at":        t.User.UpdatedAt,
 				},
 			}
 			transformedTransactionHistories[i] = transformedTransaction
@@ -94,11 +129,14 @@ func GetAllTransactionHistories(db *gorm.DB) gin.HandlerFunc {
 }
 
 type CreateTransactionInput struct {
-	ProductID uint `json:"product_id" validate:"required"`
-	Quantity  int  `json:"quantity" validate:"required"`
+	ProductID    uint   `json:"product_id" validate:"required"`
+	Quantity     int    `json:"quantity" validate:"required,min=1"`
+	AddressID    uint   `json:"address_id"`
+	CouponCode   string `json:"coupon_code" validate:"max=64"`
+	RedeemPoints int    `json:"redeem_points" validate:"min=0"`
 }
 
-func CreateTransaction(db *gorm.DB) gin.HandlerFunc {
+func CreateTransaction(db *gorm.DB, taxConfig *config.TaxConfig, loyaltyConfig *config.LoyaltyConfig) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		userIDParam, exists := c.Get("userID")
 		if !exists {
@@ -122,91 +160,277 @@ func CreateTransaction(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
-		var product models.Product
-		if err := db.First(&product, input.ProductID).Error; err != nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+		var result *helper.PurchaseResult
+		err := db.Transaction(func(tx *gorm.DB) error {
+			var err error
+			result, err = helper.Purchase(tx, helper.PurchaseRequest{
+				UserID:       userID,
+				Lines:        []helper.PurchaseLine{{ProductID: input.ProductID, Quantity: input.Quantity}},
+				AddressID:    input.AddressID,
+				CouponCode:   input.CouponCode,
+				RedeemPoints: input.RedeemPoints,
+				Tax:          taxConfig,
+				Loyalty:      loyaltyConfig,
+			})
+			return err
+		})
+		if err != nil {
+			respondPurchaseError(c, err)
 			return
 		}
 
-		// Check stock availability
-		if input.Quantity > product.Stock {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Insufficient stock"})
+		transaction := result.Transactions[0]
+		c.JSON(http.StatusCreated, gin.H{
+			"message": "You have successfully purchased the product",
+			"transaction_bill": gin.H{
+				"order_id":              result.Order.ID,
+				"order_status":          result.Order.Status,
+				"invoice_number":        result.Order.InvoiceNumber,
+				"subtotal":              result.Subtotal,
+				"discount":              result.Discount,
+				"coupon_code":           result.Order.CouponCode,
+				"tax":                   result.Tax,
+				"tax_rate":              transaction.TaxRate,
+				"tax_included":          transaction.TaxIncluded,
+				"points_used":           result.Order.PointsUsed,
+				"points_earned":         result.PointsEarned,
+				"shipping_cost":         result.ShippingCost,
+				"total_price":           result.TotalPrice,
+				"total_price_formatted": models.NewMoney(result.TotalPrice, models.BaseCurrency).String(),
+				"quantity":              transaction.Quantity,
+				"backordered_quantity":  transaction.BackorderedQuantity,
+				"product_title":         result.Products[0].Title,
+			},
+		})
+	}
+}
+
+func respondPurchaseError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, helper.ErrProductNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+	case errors.Is(err, helper.ErrInsufficientStock):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Insufficient stock"})
+	case errors.Is(err, helper.ErrInsufficientBalance):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Insufficient balance"})
+	case errors.Is(err, helper.ErrAddressRequired):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Shipping address not found, add one before checking out"})
+	case errors.Is(err, helper.ErrNoShippingRate):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "We do not ship to this province yet"})
+	case errors.Is(err, helper.ErrCouponNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Coupon not found"})
+	case errors.Is(err, helper.ErrCouponNotActive):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Coupon is not active"})
+	case errors.Is(err, helper.ErrCouponUsedUp):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Coupon usage limit has been reached"})
+	case errors.Is(err, helper.ErrCouponMinPurchase):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Purchase does not reach the coupon minimum"})
+	case errors.Is(err, helper.ErrCouponNotEligible):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Coupon does not apply to these products"})
+	case errors.Is(err, helper.ErrInsufficientPoints):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Insufficient points"})
+	case errors.Is(err, helper.ErrPointsLimit):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Points cannot pay for that much of the purchase"})
+	case errors.Is(err, helper.ErrNoExchangeRate):
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "The product currency cannot be converted right now"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create transaction"})
+	}
+}
+
+type RefundTransactionInput struct {
+	// Quantity defaults to everything not refunded yet when left out.
+	Quantity int    `json:"quantity" validate:"min=0"`
+	Reason   string `json:"reason" validate:"max=255"`
+}
+
+func RefundTransaction(db *gorm.DB, customerWindow time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userIDParam, exists := c.Get("userID")
+		if !exists {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "User detail not found"})
+			return
+		}
+
+		userID, ok := userIDParam.(uint)
+		if !ok {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID"})
 			return
 		}
 
-		var user models.User
-		if err := db.First(&user, userID).Error; err != nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		id, err := strconv.ParseUint(c.Param("transactionId"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid transaction ID"})
 			return
 		}
 
-		totalPrice := input.Quantity * product.Price
+		// An empty body asks for a full refund
+		var input RefundTransactionInput
+		if err := c.ShouldBindJSON(&input); err != nil && !errors.Is(err, io.EOF) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 
-		// Check user balance
-		if totalPrice > user.Balance {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Insufficient balance"})
+		if err := helper.Validate(input); err != nil {
+			c.JSON(http.StatusBadRequest, err)
 			return
 		}
 
-		// Deduct stock from product and balance from user
-		product.Stock -= input.Quantity
-		user.Balance -= totalPrice
+		var transaction models.TransactionHistory
+		if err := db.First(&transaction, id).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Transaction not found"})
+			return
+		}
 
-		tx := db.Begin()
-		defer func() {
-			if r := recover(); r != nil {
-				tx.Rollback()
+		// Customers may only refund their own recent purchases
+		if role, _ := c.Get("role"); role != "admin" {
+			if transaction.UserID != userID {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Transaction not found"})
+				return
 			}
-		}()
+			if customerWindow <= 0 || time.Since(transaction.CreatedAt) > customerWindow {
+				c.JSON(http.StatusForbidden, gin.H{"error": "The refund window for this transaction has passed"})
+				return
+			}
+		}
 
-		if err := tx.Save(&product).Error; err != nil {
-			tx.Rollback()
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update product stock"})
+		var refund *models.Refund
+		err = db.Transaction(func(tx *gorm.DB) error {
+			var err error
+			refund, err = helper.RefundTransaction(tx, transaction.ID, input.Quantity, userID, input.Reason)
+			return err
+		})
+		if err != nil {
+			if errors.Is(err, helper.ErrInvalidRefund) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Refund quantity exceeds what is left to refund"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to refund transaction"})
 			return
 		}
 
-		if err := tx.Save(&user).Error; err != nil {
-			tx.Rollback()
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update user balance"})
+		c.JSON(http.StatusCreated, gin.H{
+			"message": "The transaction has been successfully refunded",
+			"refund": gin.H{
+				"id":             refund.ID,
+				"transaction_id": refund.TransactionHistoryID,
+				"quantity":       refund.Quantity,
+				"amount":         refund.Amount,
+				"reason":         refund.Reason,
+				"created_at":     refund.CreatedAt,
+			},
+		})
+	}
+}
+
+// GetTransactionInvoice renders the invoice of a purchase as a PDF. A
+// purchase that was part of a multi-item order is invoiced with the whole order.
+func GetTransactionInvoice(db *gorm.DB, store *config.StoreConfig, taxConfig *config.TaxConfig) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, exists := c.Get("userID")
+		if !exists {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "User detail not found"})
 			return
 		}
 
-		// Increment sold_product_amount in category
-		var category models.Category
-		if err := tx.First(&category, product.CategoryID).Error; err != nil {
-			tx.Rollback()
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to find category"})
+		id, err := strconv.ParseUint(c.Param("transactionId"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid transaction ID"})
 			return
 		}
-		category.SoldProductAmount += input.Quantity
-		if err := tx.Save(&category).Error; err != nil {
-			tx.Rollback()
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update category"})
+
+		var transaction models.TransactionHistory
+		if err := db.Joins("User").First(&transaction, id).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Transaction not found"})
 			return
 		}
 
-		// Create transaction history
-		transaction := models.TransactionHistory{
-			UserID:     userID,
-			ProductID:  input.ProductID,
-			Quantity:   input.Quantity,
-			TotalPrice: totalPrice,
-		}
-		if err := tx.Create(&transaction).Error; err != nil {
-			tx.Rollback()
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create transaction history"})
+		if role, _ := c.Get("role"); role != "admin" && transaction.UserID != userID {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Transaction not found"})
 			return
 		}
 
-		tx.Commit()
+		transactions := []models.TransactionHistory{transaction}
+		var order models.Order
+		if transaction.OrderID != 0 {
+			if err := db.First(&order, transaction.OrderID).Error; err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch order"})
+				return
+			}
+			if err := db.Where("order_id = ?", order.ID).Order("id").Find(&transactions).Error; err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch transactions"})
+				return
+			}
+		}
 
-		c.JSON(http.StatusCreated, gin.H{
-			"message": "You have successfully purchased the product",
-			"transaction_bill": gin.H{
-				"total_price":   transaction.TotalPrice,
-				"quantity":      transaction.Quantity,
-				"product_title": product.Title,
-			},
-		})
+		invoice := helper.Invoice{
+			Number:      transaction.InvoiceNumber,
+			IssuedAt:    transaction.CreatedAt,
+			Store:       store,
+			BuyerName:   transaction.User.FullName,
+			BuyerEmail:  transaction.User.Email,
+			ShipTo:      order.ShipTo,
+			Subtotal:    models.NewMoney(0, models.BaseCurrency),
+			Discount:    models.NewMoney(0, models.BaseCurrency),
+			Shipping:    order.ShippingCostMoney(),
+			Tax:         models.NewMoney(0, models.BaseCurrency),
+			TaxLabel:    taxConfig.Name,
+			TaxIncluded: transaction.TaxIncluded,
+			Refunded:    models.NewMoney(0, models.BaseCurrency),
+		}
+		for _, t := range transactions {
+			// Lines show the price before the coupon, the discount is listed once below
+			gross := t.GrossMoney()
+
+			var product models.Product
+			if err := db.Unscoped().First(&product, t.ProductID).Error; err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch product"})
+				return
+			}
+
+			invoice.Lines = append(invoice.Lines, helper.InvoiceLine{
+				Title:     product.Title,
+				Quantity:  t.Quantity,
+				UnitPrice: t.UnitPriceMoney(),
+				Total:     gross,
+			})
+			invoice.Subtotal = invoice.Subtotal.Add(gross)
+			invoice.Discount = invoice.Discount.Add(models.NewMoney(t.Discount, models.BaseCurrency))
+			invoice.Tax = invoice.Tax.Add(models.NewMoney(t.Tax, models.BaseCurrency))
+			if t.TaxRate != 0 {
+				invoice.TaxRates = appendTaxRate(invoice.TaxRates, t.TaxRate)
+			}
+			invoice.Refunded = invoice.Refunded.Add(models.NewMoney(t.RefundedAmount, models.BaseCurrency))
+		}
+		invoice.Total = invoice.Subtotal.Add(invoice.Shipping).Sub(invoice.Discount)
+		if !invoice.TaxIncluded {
+			invoice.Total = invoice.Total.Add(invoice.Tax)
+		}
+		if invoice.Number == "" {
+			// Purchases made before invoices were numbered
+			invoice.Number = fmt.Sprintf("TRX-%06d", transaction.ID)
+		}
+		if order.Status == helper.OrderCancelled || order.Status == helper.OrderRefunded {
+			invoice.Refunded = invoice.Refunded.Add(order.ShippingCostMoney())
+		}
+
+		c.Header("Content-Disposition", fmt.Sprintf(`inline; filename="invoice-%d.pdf"`, transaction.ID))
+		c.Data(http.StatusOK, "application/pdf", helper.RenderInvoicePDF(invoice))
 	}
 }
+
+// appendTaxRate adds rate to the sorted rates unless it is already there.
+func appendTaxRate(rates []int, rate int) []int {
+	i := sort.SearchInts(rates, rate)
+	if i < len(rates) && rates[i] == rate {
+		return rates
+	}
+	return append(rates[:i], append([]int{rate}, rates[i:]...)...)
+}
+
+// invoiceNumberPattern turns a full or partial invoice number into a LIKE
+// prefix pattern, escaping the wildcard characters.
+func invoiceNumberPattern(invoiceNumber string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+	return replacer.Replace(strings.ToUpper(strings.TrimSpace(invoiceNumber))) + "%"
+}
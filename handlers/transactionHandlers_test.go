@@ -0,0 +1,181 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"main/config"
+	"main/helper"
+	"main/models"
+	"main/testdb"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+// TestCreateTransactionConcurrent hammers POST /transactions from many
+// clients at once. Run against Postgres with TEST_DATABASE_URL to have the
+// purchases contend for the row locks.
+func TestCreateTransactionConcurrent(t *testing.T) {
+	db := testdb.Open(t)
+
+	const (
+		price   = 1000
+		stock   = 10
+		buyers  = 4
+		workers = 24
+	)
+	// Every buyer can pay for three units, so both the stock and the
+	// balances run out while purchases are still coming in.
+	taxConfig := &config.TaxConfig{Name: "PPN", DefaultRate: 1100}
+	unitTotal := helper.ApplyTax(price, taxConfig.DefaultRate, false).Total
+	funds := 3 * unitTotal
+	product := testdb.CreateProduct(t, db, models.Product{Title: "Limited", Price: price, Stock: stock})
+	users := make([]models.User, buyers)
+	for i := range users {
+		users[i] = testdb.CreateUser(t, db, fmt.Sprintf("buyer%d@example.com", i), "customer")
+		topUp(t, db, users[i].ID, funds)
+	}
+
+	r := newTestRouter(db)
+	r.POST("/transactions", CreateTransaction(db, taxConfig, config.GetLoyaltyConfig()))
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	bought := make(map[uint]int)
+	spent := make(map[uint]int)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(user models.User) {
+			defer wg.Done()
+			body, _ := json.Marshal(CreateTransactionInput{ProductID: product.ID, Quantity: 1})
+			req, err := http.NewRequest(http.MethodPost, server.URL+"/transactions", bytes.NewReader(body))
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set(testUserHeader, strconv.FormatUint(uint64(user.ID), 10))
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			defer resp.Body.Close()
+
+			var response struct {
+				Error string `json:"error"`
+				Bill  struct {
+					TotalPrice int `json:"total_price"`
+				} `json:"transaction_bill"`
+			}
+			if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+				t.Error(err)
+				return
+			}
+			switch {
+			case resp.StatusCode == http.StatusCreated:
+				mu.Lock()
+				bought[user.ID]++
+				spent[user.ID] += response.Bill.TotalPrice
+				mu.Unlock()
+			case resp.StatusCode == http.StatusBadRequest &&
+				(response.Error == "Insufficient stock" || response.Error == "Insufficient balance"):
+			default:
+				t.Errorf("purchase answered %d %q", resp.StatusCode, response.Error)
+			}
+		}(users[i%buyers])
+	}
+	wg.Wait()
+
+	sold := 0
+	for _, user := range users {
+		if bought[user.ID] > 3 {
+			t.Errorf("user %d bought %d units with balance for 3", user.ID, bought[user.ID])
+		}
+		if spent[user.ID] != bought[user.ID]*unitTotal {
+			t.Errorf("user %d paid %d for %d units, want %d", user.ID, spent[user.ID], bought[user.ID], bought[user.ID]*unitTotal)
+		}
+		sold += bought[user.ID]
+	}
+	if sold != stock {
+		t.Errorf("sold %d units, want all %d in stock", sold, stock)
+	}
+
+	if err := db.First(&product, product.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if product.Stock != stock-sold || product.Stock < 0 {
+		t.Errorf("stock = %d, want %d", product.Stock, stock-sold)
+	}
+
+	var category models.Category
+	if err := db.First(&category, product.CategoryID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if category.SoldProductAmount != sold {
+		t.Errorf("sold product amount = %d, want %d", category.SoldProductAmount, sold)
+	}
+
+	var transactions int64
+	if err := db.Model(&models.TransactionHistory{}).Where("product_id = ?", product.ID).Count(&transactions).Error; err != nil {
+		t.Fatal(err)
+	}
+	if transactions != int64(sold) {
+		t.Errorf("%d transactions recorded, want %d", transactions, sold)
+	}
+
+	for _, user := range users {
+		if err := db.First(&user, user.ID).Error; err != nil {
+			t.Fatal(err)
+		}
+		if want := funds - spent[user.ID]; user.Balance != want || user.Balance < 0 {
+			t.Errorf("balance of user %d = %d, want %d", user.ID, user.Balance, want)
+		}
+	}
+	assertWalletsBalanced(t, db)
+}
+
+func TestGetTransactionInvoice(t *testing.T) {
+	db := testdb.Open(t)
+	taxConfig := &config.TaxConfig{Name: "PPN", DefaultRate: 1100}
+	r := newTestRouter(db)
+	r.POST("/transactions", CreateTransaction(db, taxConfig, config.GetLoyaltyConfig()))
+	r.GET("/transactions/:transactionId/invoice.pdf", GetTransactionInvoice(db, &config.StoreConfig{Name: "Toko Test"}, taxConfig))
+
+	product := testdb.CreateProduct(t, db, models.Product{Title: "Kettle", Price: 15000, Stock: 5})
+	buyer := testdb.CreateUser(t, db, "buyer@example.com", "customer")
+	other := testdb.CreateUser(t, db, "other@example.com", "customer")
+	admin := testdb.CreateUser(t, db, "admin@example.com", "admin")
+	topUp(t, db, buyer.ID, 100000)
+
+	w := serve(t, r, http.MethodPost, "/transactions", buyer, CreateTransactionInput{ProductID: product.ID, Quantity: 2})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("purchase: %d %s", w.Code, w.Body)
+	}
+	var transaction models.TransactionHistory
+	if err := db.Where("user_id = ?", buyer.ID).First(&transaction).Error; err != nil {
+		t.Fatal(err)
+	}
+	path := fmt.Sprintf("/transactions/%d/invoice.pdf", transaction.ID)
+
+	for _, user := range []models.User{buyer, admin} {
+		w := serve(t, r, http.MethodGet, path, user, nil)
+		if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/pdf" {
+			t.Fatalf("invoice for %s: %d %s", user.Email, w.Code, w.Header().Get("Content-Type"))
+		}
+		pdf := w.Body.Bytes()
+		for _, want := range []string{"(" + transaction.InvoiceNumber + ")", "(Kettle)", "(Rp 30.000)", "(PPN 11%)", "(Rp 3.300)", "(Rp 33.300)"} {
+			if !bytes.Contains(pdf, []byte(want)) {
+				t.Errorf("invoice does not contain %q", want)
+			}
+		}
+	}
+	if w := serve(t, r, http.MethodGet, path, other, nil); w.Code != http.StatusNotFound {
+		t.Errorf("invoice of someone else's purchase: %d, want 404", w.Code)
+	}
+}
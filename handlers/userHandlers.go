@@ -2,17 +2,19 @@ package handlers
 
 import (
 	"fmt"
+	"log"
 	"main/helper"
 	"main/middleware"
 
 	"main/models"
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 )
 
-func CreateUser(db *gorm.DB) gin.HandlerFunc {
+func CreateUser(db *gorm.DB, policy *helper.PasswordPolicy) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var newUser models.User
 		if err := c.ShouldBindJSON(&newUser); err != nil {
@@ -33,6 +35,11 @@ func CreateUser(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
+		if problems := policy.Check(newUser.Password, newUser.Email, newUser.FullName); problems != nil {
+			c.JSON(http.StatusBadRequest, problems)
+			return
+		}
+
 		newUser.Balance = 0
 
 		hashed, err := helper.HashPassword(newUser.Password)
@@ -87,7 +94,7 @@ func UserLogin(db *gorm.DB) gin.HandlerFunc {
 	}
 }
 
-func UpdateBalance(db *gorm.DB) gin.HandlerFunc {
+func UpdateBalance(db *gorm.DB, provider helper.PaymentProvider, intentTTL time.Duration) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		userEmail, exists := c.Get("user")
 		if !exists {
@@ -101,7 +108,7 @@ func UpdateBalance(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
-		// Get the new balance value from the request body
+		// Get the topup amount from the request body
 		var updateData struct {
 			Balance int `json:"balance" validate:"min=0,max=100000000,required"`
 		}
@@ -116,13 +123,220 @@ func UpdateBalance(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
-		// Update the user's balance
-		user.Balance = updateData.Balance + user.Balance
-		if err := db.Save(&user).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update balance"})
+		// The balance is only credited once the provider confirms the payment
+		// through the webhook.
+		intent := models.PaymentIntent{
+			UserID:    user.ID,
+			Provider:  provider.Name(),
+			Amount:    updateData.Balance,
+			Status:    helper.PaymentPending,
+			ExpiresAt: time.Now().Add(intentTTL),
+		}
+		payment, err := provider.CreatePayment(intent)
+		if err != nil {
+			c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to create payment"})
+			return
+		}
+		intent.ExternalID = payment.ExternalID
+		intent.PaymentURL = payment.PaymentURL
+
+		if err := db.Create(&intent).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create payment"})
+			return
+		}
+
+		c.JSON(http.StatusAccepted, gin.H{
+			"message": fmt.Sprintf("Complete the payment of %s to top up your balance", models.NewMoney(intent.Amount, models.BaseCurrency)),
+			"payment": paymentResponse(intent),
+		})
+	}
+}
+
+func paymentResponse(intent models.PaymentIntent) gin.H {
+	return gin.H{
+		"id":             intent.ID,
+		"amount":         intent.Amount,
+		"status":         intent.Status,
+		"payment_url":    intent.PaymentURL,
+		"failure_reason": intent.FailureReason,
+		"expires_at":     intent.ExpiresAt,
+		"settled_at":     intent.SettledAt,
+		"created_at":     intent.CreatedAt,
+	}
+}
+
+type ChangePasswordInput struct {
+	OldPassword string `json:"old_password" validate:"required"`
+	NewPassword string `json:"new_password" validate:"required"`
+}
+
+func ChangePassword(db *gorm.DB, policy *helper.PasswordPolicy) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, exists := c.Get("userID")
+		if !exists {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "User detail not found"})
+			return
+		}
+
+		var input ChangePasswordInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := helper.Validate(input); err != nil {
+			c.JSON(http.StatusBadRequest, err)
+			return
+		}
+
+		var user models.User
+		if err := db.First(&user, userID).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+
+		if err := helper.VerifyPassword(user.Password, input.OldPassword); err != nil {
+			c.JSON(http.StatusForbidden, gin.H{"message": "Old password is wrong"})
+			return
+		}
+
+		if problems := policy.Check(input.NewPassword, user.Email, user.FullName); problems != nil {
+			c.JSON(http.StatusBadRequest, problems)
+			return
+		}
+
+		hashed, err := helper.HashPassword(input.NewPassword)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
+			return
+		}
+
+		if err := db.Model(&user).Update("password", hashed).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update password"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Your password has been successfully changed"})
+	}
+}
+
+type ForgotPasswordInput struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+func ForgotPassword(db *gorm.DB, tokenTTL time.Duration, mailer helper.Mailer) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input ForgotPasswordInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := helper.Validate(input); err != nil {
+			c.JSON(http.StatusBadRequest, err)
+			return
+		}
+
+		// Always answer the same way so the endpoint cannot be used to probe for
+		// registered emails.
+		response := gin.H{"message": "If the email is registered, a password reset token has been sent"}
+
+		var user models.User
+		if err := db.Where("email = ?", input.Email).First(&user).Error; err != nil {
+			c.JSON(http.StatusOK, response)
+			return
+		}
+
+		token, err := helper.GenerateToken(32)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate reset token"})
+			return
+		}
+
+		reset := models.PasswordReset{
+			UserID:    user.ID,
+			TokenHash: helper.HashToken(token),
+			ExpiresAt: time.Now().Add(tokenTTL),
+		}
+		if err := db.Create(&reset).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create reset token"})
+			return
+		}
+
+		// A failed delivery is logged rather than reported, which would give
+		// away that the email is registered.
+		body := fmt.Sprintf("Use this token to reset your password within %s:\n\n%s\n\nIf you did not ask for a reset, ignore this email.", tokenTTL, token)
+		if err := mailer.Send(user.Email, "Reset your password", body); err != nil {
+			log.Println("Failed to send password reset email:", err)
+		}
+
+		c.JSON(http.StatusOK, response)
+	}
+}
+
+type ResetPasswordInput struct {
+	Token       string `json:"token" validate:"required"`
+	NewPassword string `json:"new_password" validate:"required"`
+}
+
+func ResetPassword(db *gorm.DB, policy *helper.PasswordPolicy) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input ResetPasswordInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := helper.Validate(input); err != nil {
+			c.JSON(http.StatusBadRequest, err)
+			return
+		}
+
+		var reset models.PasswordReset
+		err := db.Where("token_hash = ? AND used_at IS NULL AND expires_at > ?", helper.HashToken(input.Token), time.Now()).
+			First(&reset).Error
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired reset token"})
+			return
+		}
+
+		var user models.User
+		if err := db.First(&user, reset.UserID).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+
+		if problems := policy.Check(input.NewPassword, user.Email, user.FullName); problems != nil {
+			c.JSON(http.StatusBadRequest, problems)
+			return
+		}
+
+		hashed, err := helper.HashPassword(input.NewPassword)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
+			return
+		}
+
+		err = db.Transaction(func(tx *gorm.DB) error {
+			// Marking the token used with a conditional update stops two requests
+			// from redeeming the same token.
+			now := time.Now()
+			result := tx.Model(&models.PasswordReset{}).
+				Where("id = ? AND used_at IS NULL", reset.ID).
+				Update("used_at", &now)
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return gorm.ErrRecordNotFound
+			}
+			return tx.Model(&user).Update("password", hashed).Error
+		})
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to reset password"})
 			return
 		}
 
-		c.JSON(http.StatusOK, gin.H{"message": fmt.Sprintf("Your balance has been successfully updated to Rp %d", user.Balance)})
+		c.JSON(http.StatusOK, gin.H{"message": "Your password has been successfully reset"})
 	}
 }
@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"main/helper"
+	"main/models"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+func GetWalletEntries(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userIDParam, exists := c.Get("userID")
+		if !exists {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "User detail not found"})
+			return
+		}
+
+		userID, ok := userIDParam.(uint)
+		if !ok {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID"})
+			return
+		}
+
+		page, limit := helper.GetPagination(c)
+
+		var total int64
+		if err := db.Model(&models.WalletEntry{}).Where("user_id = ?", userID).Count(&total).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch wallet entries"})
+			return
+		}
+
+		var entries []models.WalletEntry
+		err := db.Where("user_id = ?", userID).
+			Order("sequence DESC").
+			Offset((page - 1) * limit).
+			Limit(limit).
+			Find(&entries).Error
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch wallet entries"})
+			return
+		}
+
+		var user models.User
+		if err := db.First(&user, userID).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"balance":           user.Balance,
+			"balance_formatted": user.BalanceMoney().String(),
+			"entries":           entries,
+			"page":              page,
+			"limit":             limit,
+			"total":             total,
+		})
+	}
+}
@@ -0,0 +1,193 @@
+package handlers
+
+import (
+	"main/helper"
+	"main/models"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type WishlistItemInput struct {
+	ProductID uint `json:"product_id" validate:"required"`
+}
+
+func GetWishlist(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userIDParam, exists := c.Get("userID")
+		if !exists {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "User detail not found"})
+			return
+		}
+
+		var items []models.WishlistItem
+		if err := db.Joins("Product").Where("wishlist_items.user_id = ?", userIDParam).Order("wishlist_items.id DESC").Find(&items).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch wishlist"})
+			return
+		}
+
+		sales, err := helper.ActiveSales(db, time.Now())
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch sales"})
+			return
+		}
+
+		transformedItems := make([]map[string]interface{}, len(items))
+		for i, item := range items {
+			salePrice, sale := sales.Price(item.Product)
+			transformedItems[i] = map[string]interface{}{
+				"product_id": item.ProductID,
+				"title":      item.Product.Title,
+				"price":      item.Product.PriceMoney(),
+				"sale_price": salePrice,
+				"sale":       saleResponse(sale),
+				"stock":      item.Product.AvailableStock(),
+				"in_stock":   item.Product.AvailableStock() > 0,
+				"added_at":   item.CreatedAt,
+			}
+		}
+
+		c.JSON(http.StatusOK, transformedItems)
+	}
+}
+
+func AddWishlistItem(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userIDParam, exists := c.Get("userID")
+		if !exists {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "User detail not found"})
+			return
+		}
+
+		var input WishlistItemInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := helper.Validate(input); err != nil {
+			c.JSON(http.StatusBadRequest, err)
+			return
+		}
+
+		var product models.Product
+		if err := db.First(&product, input.ProductID).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+			return
+		}
+
+		// Adding a product twice leaves the wishlist as it is
+		item := models.WishlistItem{UserID: userIDParam.(uint), ProductID: input.ProductID}
+		if err := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&item).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add product to wishlist"})
+			return
+		}
+
+		c.JSON(http.StatusCreated, gin.H{"message": "Product has been added to your wishlist"})
+	}
+}
+
+func RemoveWishlistItem(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userIDParam, exists := c.Get("userID")
+		if !exists {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "User detail not found"})
+			return
+		}
+
+		productID, err := strconv.ParseUint(c.Param("productId"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+			return
+		}
+
+		result := db.Where("user_id = ? AND product_id = ?", userIDParam, productID).Delete(&models.WishlistItem{})
+		if result.Error != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update wishlist"})
+			return
+		}
+		if result.RowsAffected == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Product is not in your wishlist"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Product has been removed from your wishlist"})
+	}
+}
+
+func GetNotifications(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userIDParam, exists := c.Get("userID")
+		if !exists {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "User detail not found"})
+			return
+		}
+
+		page, limit := helper.GetPagination(c)
+
+		query := db.Model(&models.Notification{}).Where("user_id = ?", userIDParam)
+		if c.Query("unread") == "true" {
+			query = query.Where("read_at IS NULL")
+		}
+
+		var total int64
+		if err := query.Count(&total).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch notifications"})
+			return
+		}
+
+		var notifications []models.Notification
+		err := query.Order("id DESC").
+			Offset((page - 1) * limit).
+			Limit(limit).
+			Find(&notifications).Error
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch notifications"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"notifications": notifications,
+			"page":          page,
+			"limit":         limit,
+			"total":         total,
+		})
+	}
+}
+
+func MarkNotificationRead(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userIDParam, exists := c.Get("userID")
+		if !exists {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "User detail not found"})
+			return
+		}
+
+		id, err := strconv.ParseUint(c.Param("notificationId"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid notification ID"})
+			return
+		}
+
+		var notification models.Notification
+		if err := db.Where("id = ? AND user_id = ?", id, userIDParam).First(&notification).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Notification not found"})
+			return
+		}
+
+		if notification.ReadAt == nil {
+			now := time.Now()
+			if err := db.Model(&notification).Update("read_at", now).Error; err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update notification"})
+				return
+			}
+			notification.ReadAt = &now
+		}
+
+		c.JSON(http.StatusOK, notification)
+	}
+}
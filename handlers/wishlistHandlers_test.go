@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"fmt"
+	"main/helper"
+	"main/models"
+	"main/testdb"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+func newWishlistRouter(db *gorm.DB) *gin.Engine {
+	r := newTestRouter(db)
+	r.POST("/users/me/wishlist", AddWishlistItem(db))
+	r.DELETE("/users/me/wishlist/:productId", RemoveWishlistItem(db))
+	r.GET("/users/me/notifications", GetNotifications(db))
+	r.PATCH("/users/me/notifications/:notificationId/read", MarkNotificationRead(db))
+	r.PUT("/products/:productId", UpdateProduct(db))
+	return r
+}
+
+// notificationTypes returns the types of the user's notifications, oldest first.
+func notificationTypes(t *testing.T, db *gorm.DB, userID uint) []string {
+	t.Helper()
+	var types []string
+	if err := db.Model(&models.Notification{}).Where("user_id = ?", userID).Order("id").Pluck("type", &types).Error; err != nil {
+		t.Fatal(err)
+	}
+	return types
+}
+
+func TestWishlistNotifications(t *testing.T) {
+	db := testdb.Open(t)
+	r := newWishlistRouter(db)
+	product := testdb.CreateProduct(t, db, models.Product{Title: "Kettle", Price: 20000, Currency: models.BaseCurrency})
+	watcher := testdb.CreateUser(t, db, "watcher@example.com", "customer")
+	leaver := testdb.CreateUser(t, db, "leaver@example.com", "customer")
+	bystander := testdb.CreateUser(t, db, "bystander@example.com", "customer")
+	admin := testdb.CreateUser(t, db, "admin@example.com", "admin")
+
+	for _, user := range []models.User{watcher, leaver} {
+		if w := serve(t, r, http.MethodPost, "/users/me/wishlist", user, WishlistItemInput{ProductID: product.ID}); w.Code != http.StatusCreated {
+			t.Fatalf("wishlisting: %d %s", w.Code, w.Body)
+		}
+	}
+	update := func(price int, currency string, stock int) {
+		t.Helper()
+		input := CreateProductInput{Title: product.Title, Price: price, Currency: currency, Stock: stock, CategoryID: product.CategoryID}
+		if w := serve(t, r, http.MethodPut, fmt.Sprintf("/products/%d", product.ID), admin, input); w.Code != http.StatusOK {
+			t.Fatalf("updating product: %d %s", w.Code, w.Body)
+		}
+	}
+
+	// Cheaper and back from zero stock in one edit.
+	update(15000, "IDR", 5)
+	for _, user := range []models.User{watcher, leaver} {
+		types := notificationTypes(t, db, user.ID)
+		if len(types) != 2 || types[0] != helper.NotificationPriceDrop || types[1] != helper.NotificationBackInStock {
+			t.Errorf("notifications of %s = %v, want a price drop and back in stock", user.Email, types)
+		}
+	}
+	if types := notificationTypes(t, db, bystander.ID); len(types) != 0 {
+		t.Errorf("user without the product on their wishlist got %v", types)
+	}
+	var drop models.Notification
+	if err := db.Where("user_id = ? AND type = ?", watcher.ID, helper.NotificationPriceDrop).First(&drop).Error; err != nil {
+		t.Fatal(err)
+	}
+	if want := "Kettle dropped in price from Rp 20.000 to Rp 15.000"; drop.Message != want || drop.ProductID != product.ID {
+		t.Errorf("price drop = %q for product %d, want %q", drop.Message, drop.ProductID, want)
+	}
+
+	// Neither a price rise, more stock on top of stock, nor a price in
+	// another currency is worth a notification.
+	update(18000, "IDR", 10)
+	update(100, "USD", 10)
+	if types := notificationTypes(t, db, watcher.ID); len(types) != 2 {
+		t.Errorf("notifications after updates without news = %v", types)
+	}
+
+	// Only users who still want the product hear about it.
+	if w := serve(t, r, http.MethodDelete, fmt.Sprintf("/users/me/wishlist/%d", product.ID), leaver, nil); w.Code != http.StatusOK {
+		t.Fatalf("removing from wishlist: %d %s", w.Code, w.Body)
+	}
+	update(50, "USD", 10)
+	if types := notificationTypes(t, db, watcher.ID); len(types) != 3 || types[2] != helper.NotificationPriceDrop {
+		t.Errorf("notifications of the watcher = %v, want a second price drop", types)
+	}
+	if types := notificationTypes(t, db, leaver.ID); len(types) != 2 {
+		t.Errorf("user who removed the product got %v", types)
+	}
+}
+
+func TestNotificationsReadState(t *testing.T) {
+	db := testdb.Open(t)
+	r := newWishlistRouter(db)
+	user := testdb.CreateUser(t, db, "reader@example.com", "customer")
+	other := testdb.CreateUser(t, db, "other@example.com", "customer")
+	notifications := []models.Notification{
+		{UserID: user.ID, Type: helper.NotificationPriceDrop, Message: "first"},
+		{UserID: user.ID, Type: helper.NotificationBackInStock, Message: "second"},
+		{UserID: other.ID, Type: helper.NotificationBackInStock, Message: "not yours"},
+	}
+	if err := db.Create(&notifications).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	list := func(query string) []string {
+		t.Helper()
+		var response struct {
+			Notifications []models.Notification `json:"notifications"`
+		}
+		decode(t, serve(t, r, http.MethodGet, "/users/me/notifications"+query, user, nil), &response)
+		var messages []string
+		for _, notification := range response.Notifications {
+			messages = append(messages, notification.Message)
+		}
+		return messages
+	}
+
+	if got := list(""); len(got) != 2 || got[0] != "second" || got[1] != "first" {
+		t.Errorf("notifications = %v, want the user's own, newest first", got)
+	}
+	if w := serve(t, r, http.MethodPatch, fmt.Sprintf("/users/me/notifications/%d/read", notifications[1].ID), user, nil); w.Code != http.StatusOK {
+		t.Fatalf("marking read: %d %s", w.Code, w.Body)
+	}
+	if got := list("?unread=true"); len(got) != 1 || got[0] != "first" {
+		t.Errorf("unread notifications = %v, want only the first", got)
+	}
+	if w := serve(t, r, http.MethodPatch, fmt.Sprintf("/users/me/notifications/%d/read", notifications[2].ID), user, nil); w.Code != http.StatusNotFound {
+		t.Errorf("marking someone else's notification: %d, want 404", w.Code)
+	}
+}
@@ -0,0 +1,158 @@
+package helper
+
+import (
+	"errors"
+	"main/models"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	BackorderNone      = ""
+	BackorderBackorder = "backorder" // out of stock, more is on the way
+	BackorderPreorder  = "preorder"  // not released yet
+)
+
+// AllowsBackorder reports whether the product may be bought beyond its stock.
+func AllowsBackorder(product models.Product) bool {
+	return product.BackorderMode == BackorderBackorder || product.BackorderMode == BackorderPreorder
+}
+
+// SellableStock is the stock that can be handed out at now. A preorder
+// product keeps all of it back until its release at AvailableAt, so every
+// unit bought before then waits as a backorder.
+func SellableStock(product models.Product, now time.Time) int {
+	if product.BackorderMode == BackorderPreorder && product.AvailableAt != nil && now.Before(*product.AvailableAt) {
+		return 0
+	}
+	return product.AvailableStock()
+}
+
+// AllocateBackorders locks the product and hands its free stock to the
+// purchases waiting for it. Callers that add stock run it afterwards.
+func AllocateBackorders(tx *gorm.DB, productID uint) (*models.Product, error) {
+	product, err := lockReservedProduct(tx, productID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	return &product, nil
+}
+
+// allocateBackorders gives the free stock of the locked product to its
+// backordered purchases, first come first served. An order moves to paid
+// once none of its purchases is waiting any more.
+func allocateBackorders(tx *gorm.DB, product *models.Product, now time.Time) error {
+	available := SellableStock(*product, now)
+	if available <= 0 {
+		return nil
+	}
+
+	var waiting []models.TransactionHistory
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("product_id = ? AND backordered_quantity > 0", product.ID).
+		Order("id").
+		Find(&waiting).Error
+	if err != nil {
+		return err
+	}
+
+	for _, transaction := range waiting {
+		if available == 0 {
+			break
+		}
+		take := transaction.BackorderedQuantity
+		if take > available {
+			take = available
+		}
+
+		err := tx.Model(&models.Product{}).
+			Where("id = ?", product.ID).
+			UpdateColumn("stock", gorm.Expr("stock - ?", take)).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Model(&transaction).UpdateColumn("backordered_quantity", gorm.Expr("backordered_quantity - ?", take)).Error
+		if err != nil {
+			return err
+		}
+		product.Stock -= take
+		available -= take
+
+		if take == transaction.BackorderedQuantity {
+			if err := releaseBackorderedOrder(tx, transaction.OrderID); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// releaseBackorderedOrder moves a backordered order on to paid when all of
+// its purchases have their stock.
+func releaseBackorderedOrder(tx *gorm.DB, orderID uint) error {
+	if orderID == 0 {
+		return nil
+	}
+	var waiting int64
+	err := tx.Model(&models.TransactionHistory{}).
+		Where("order_id = ? AND backordered_quantity > 0", orderID).
+		Count(&waiting).Error
+	if err != nil || waiting > 0 {
+		return err
+	}
+
+	var order models.Order
+	if err := tx.First(&order, orderID).Error; err != nil {
+		return err
+	}
+	if order.Status != OrderBackordered {
+		return nil
+	}
+	_, err = transitionOrder(tx, orderID, OrderPaid, 0, "Backordered items allocated", allocationTransitions)
+	return err
+}
+
+// ReleasePreorders hands the stock of preorder products released by now to
+// the purchases waiting for it. Each product is handled in its own
+// transaction.
+func ReleasePreorders(db *gorm.DB, now time.Time) error {
+	var productIDs []uint
+	err := db.Model(&models.TransactionHistory{}).
+		Joins("JOIN products ON products.id = transaction_histories.product_id").
+		Where("transaction_histories.backordered_quantity > 0").
+		Where("products.backorder_mode = ? AND products.available_at <= ?", BackorderPreorder, now).
+		Distinct().Pluck("transaction_histories.product_id", &productIDs).Error
+	if err != nil {
+		return err
+	}
+
+	for _, productID := range productIDs {
+		err := db.Transaction(func(tx *gorm.DB) error {
+			_, err := lockReservedProduct(tx, productID, now)
+			return err
+		})
+		if err != nil && !errors.Is(err, ErrProductNotFound) {
+			return err
+		}
+	}
+	return nil
+}
+
+const (
+	StockInStock    = "in_stock"
+	StockOutOfStock = "out_of_stock"
+)
+
+// StockStatus describes whether the product can be bought at now: in stock,
+// out of stock, or on backorder or pre-order when it sells beyond its stock.
+func StockStatus(product models.Product, now time.Time) string {
+	if SellableStock(product, now) > 0 {
+		return StockInStock
+	}
+	if AllowsBackorder(product) {
+		return product.BackorderMode
+	}
+	return StockOutOfStock
+}
@@ -0,0 +1,243 @@
+package helper
+
+import (
+	"fmt"
+	"main/models"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+func TestAllocateBackordersFirstComeFirstServed(t *testing.T) {
+	db := openTestDB(t)
+	product := createTestProduct(t, db, models.Product{Title: "Restocked", Price: 1000, Stock: 1, BackorderMode: BackorderBackorder})
+
+	// The first purchase takes the one unit in stock, the rest wait
+	quantities := []int{3, 1, 3}
+	orders := make([]uint, len(quantities))
+	for i, quantity := range quantities {
+		user := createTestUser(t, db, fmt.Sprintf("waiting%d@example.com", i), 10000)
+		result, err := buy(db, user.ID, product.ID, quantity)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Order.Status != OrderBackordered {
+			t.Errorf("order %d is %s, want backordered", i, result.Order.Status)
+		}
+		orders[i] = result.Order.ID
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&product).UpdateColumn("stock", gorm.Expr("stock + ?", 4)).Error; err != nil {
+			return err
+		}
+		_, err := AllocateBackorders(tx, product.ID)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []struct {
+		status      string
+		backordered int
+	}{
+		{OrderPaid, 0},
+		{OrderPaid, 0},
+		{OrderBackordered, 2},
+	}
+	for i, orderID := range orders {
+		var order models.Order
+		if err := db.First(&order, orderID).Error; err != nil {
+			t.Fatal(err)
+		}
+		var transaction models.TransactionHistory
+		if err := db.Where("order_id = ?", orderID).First(&transaction).Error; err != nil {
+			t.Fatal(err)
+		}
+		if order.Status != want[i].status || transaction.BackorderedQuantity != want[i].backordered {
+			t.Errorf("order %d is %s with %d backordered, want %s with %d",
+				i, order.Status, transaction.BackorderedQuantity, want[i].status, want[i].backordered)
+		}
+	}
+	if err := db.First(&product, product.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if product.Stock != 0 {
+		t.Errorf("stock = %d, want 0", product.Stock)
+	}
+	assertWalletsBalanced(t, db)
+}
+
+func TestPreorderWaitsForRelease(t *testing.T) {
+	db := openTestDB(t)
+	release := time.Now().Add(time.Hour)
+	product := createTestProduct(t, db, models.Product{
+		Title: "Upcoming", Price: 1000, Stock: 5, BackorderMode: BackorderPreorder, AvailableAt: &release,
+	})
+	user := createTestUser(t, db, "early@example.com", 10000)
+
+	result, err := buy(db, user.ID, product.ID, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Order.Status != OrderBackordered || result.Transactions[0].BackorderedQuantity != 2 {
+		t.Fatalf("preorder is %s with %d backordered, want backordered with 2",
+			result.Order.Status, result.Transactions[0].BackorderedQuantity)
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		_, err := TransitionOrder(tx, result.Order.ID, OrderPaid, 1, "Paid by hand")
+		return err
+	})
+	if err != ErrInvalidOrderTransition {
+		t.Errorf("moving a backordered order to paid by hand: err = %v, want ErrInvalidOrderTransition", err)
+	}
+
+	if err := ReleasePreorders(db, release.Add(-time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	var order models.Order
+	if err := db.First(&order, result.Order.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if order.Status != OrderBackordered {
+		t.Errorf("order is %s before the release, want backordered", order.Status)
+	}
+
+	if err := ReleasePreorders(db, release); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.First(&order, result.Order.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.First(&product, product.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if order.Status != OrderPaid || product.Stock != 3 {
+		t.Errorf("after the release the order is %s with stock %d, want paid with 3", order.Status, product.Stock)
+	}
+}
+
+func TestUndoPartlyBackorderedPurchase(t *testing.T) {
+	tests := []struct {
+		name string
+		undo func(tx *gorm.DB, result *PurchaseResult, userID uint) error
+	}{
+		{"refund", func(tx *gorm.DB, result *PurchaseResult, userID uint) error {
+			_, err := RefundTransaction(tx, result.Transactions[0].ID, 0, userID, "changed my mind")
+			return err
+		}},
+		{"cancel", func(tx *gorm.DB, result *PurchaseResult, userID uint) error {
+			_, err := CancelOrder(tx, result.Order.ID, userID, "customer_request")
+			return err
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := openTestDB(t)
+			product := createTestProduct(t, db, models.Product{Title: "Scarce", Price: 1000, Stock: 2, BackorderMode: BackorderBackorder})
+			first := createTestUser(t, db, "first@example.com", 10000)
+			second := createTestUser(t, db, "second@example.com", 10000)
+
+			// Two units go out with the first purchase and three wait; the
+			// second purchase waits behind it.
+			undone, err := buy(db, first.ID, product.ID, 5)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if undone.Transactions[0].BackorderedQuantity != 3 {
+				t.Fatalf("%d units backordered, want 3", undone.Transactions[0].BackorderedQuantity)
+			}
+			waiting, err := buy(db, second.ID, product.ID, 2)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := db.Transaction(func(tx *gorm.DB) error { return tt.undo(tx, undone, first.ID) }); err != nil {
+				t.Fatal(err)
+			}
+
+			// The two units that went out come back and go to the second
+			// purchase rather than to the one being undone.
+			var transaction models.TransactionHistory
+			if err := db.First(&transaction, undone.Transactions[0].ID).Error; err != nil {
+				t.Fatal(err)
+			}
+			if transaction.BackorderedQuantity != 0 || transaction.RefundedQuantity != 5 {
+				t.Errorf("undone purchase has %d backordered and %d refunded, want 0 and 5",
+					transaction.BackorderedQuantity, transaction.RefundedQuantity)
+			}
+			var waitingTransaction models.TransactionHistory
+			if err := db.First(&waitingTransaction, waiting.Transactions[0].ID).Error; err != nil {
+				t.Fatal(err)
+			}
+			var order models.Order
+			if err := db.First(&order, waiting.Order.ID).Error; err != nil {
+				t.Fatal(err)
+			}
+			if waitingTransaction.BackorderedQuantity != 0 || order.Status != OrderPaid {
+				t.Errorf("waiting purchase has %d backordered and its order is %s, want 0 and paid",
+					waitingTransaction.BackorderedQuantity, order.Status)
+			}
+
+			if err := db.First(&product, product.ID).Error; err != nil {
+				t.Fatal(err)
+			}
+			var category models.Category
+			if err := db.First(&category, product.CategoryID).Error; err != nil {
+				t.Fatal(err)
+			}
+			if product.Stock != 0 || category.SoldProductAmount != 2 {
+				t.Errorf("stock %d and %d sold, want 0 and 2", product.Stock, category.SoldProductAmount)
+			}
+
+			var user models.User
+			if err := db.First(&user, first.ID).Error; err != nil {
+				t.Fatal(err)
+			}
+			if user.Balance != 10000 {
+				t.Errorf("balance after undoing the purchase = %d, want 10000", user.Balance)
+			}
+			assertWalletsBalanced(t, db)
+		})
+	}
+}
+
+func TestUndoPartlyBackorderedPurchaseAlone(t *testing.T) {
+	db := openTestDB(t)
+	product := createTestProduct(t, db, models.Product{Title: "Scarce", Price: 1000, Stock: 2, BackorderMode: BackorderBackorder})
+	user := createTestUser(t, db, "buyer@example.com", 10000)
+
+	result, err := buy(db, user.ID, product.ID, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		_, err := RefundTransaction(tx, result.Transactions[0].ID, 0, user.ID, "changed my mind")
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var transaction models.TransactionHistory
+	if err := db.First(&transaction, result.Transactions[0].ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.First(&product, product.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if product.Stock != 2 || transaction.BackorderedQuantity != 0 {
+		t.Errorf("stock %d and %d backordered, want 2 and 0", product.Stock, transaction.BackorderedQuantity)
+	}
+	var order models.Order
+	if err := db.First(&order, result.Order.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if order.Status != OrderRefunded {
+		t.Errorf("order is %s, want refunded", order.Status)
+	}
+	assertWalletsBalanced(t, db)
+}
@@ -0,0 +1,151 @@
+package helper
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"main/models"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrInvalidCursor      = errors.New("invalid cursor")
+	ErrUnknownProductSort = errors.New("unknown product sort")
+)
+
+// ProductSorts maps the sort names product listings accept to the column
+// they order by. Popularity is the number of units sold and not refunded.
+var ProductSorts = map[string]string{
+	"price":      "products.price",
+	"created_at": "products.created_at",
+	"title":      "products.title",
+	"popularity": "COALESCE(product_sales.sold, 0)",
+}
+
+// ProductFilter narrows a product listing. Zero values do not filter.
+type ProductFilter struct {
+	CategoryID uint
+	// MinPrice and MaxPrice compare against the price in the product's own
+	// currency.
+	MinPrice      *int
+	MaxPrice      *int
+	InStock       bool
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+}
+
+// ListedProduct is a product with the number of units it has sold.
+type ListedProduct struct {
+	models.Product
+	Sold int
+}
+
+// ProductCursor marks the last product of a page for keyset pagination: the
+// value it was sorted by and its ID to break ties.
+type ProductCursor struct {
+	Value string `json:"v"`
+	ID    uint   `json:"id"`
+}
+
+func EncodeProductCursor(product ListedProduct, sort string) string {
+	cursor := ProductCursor{ID: product.ID}
+	switch sort {
+	case "price":
+		cursor.Value = strconv.Itoa(product.Price)
+	case "created_at":
+		cursor.Value = product.CreatedAt.Format(time.RFC3339Nano)
+	case "title":
+		cursor.Value = product.Title
+	case "popularity":
+		cursor.Value = strconv.Itoa(product.Sold)
+	}
+	raw, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+// decodeProductCursor returns the cursor's sort value typed for the column
+// sort orders by.
+func decodeProductCursor(encoded string, sort string) (interface{}, uint, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, 0, ErrInvalidCursor
+	}
+	var cursor ProductCursor
+	if err := json.Unmarshal(raw, &cursor); err != nil || cursor.ID == 0 {
+		return nil, 0, ErrInvalidCursor
+	}
+
+	switch sort {
+	case "price", "popularity":
+		value, err := strconv.Atoi(cursor.Value)
+		if err != nil {
+			return nil, 0, ErrInvalidCursor
+		}
+		return value, cursor.ID, nil
+	case "created_at":
+		value, err := time.Parse(time.RFC3339Nano, cursor.Value)
+		if err != nil {
+			return nil, 0, ErrInvalidCursor
+		}
+		return value, cursor.ID, nil
+	case "title":
+		return cursor.Value, cursor.ID, nil
+	}
+	return nil, 0, ErrInvalidCursor
+}
+
+// ProductListQuery returns the products matching filter joined with what
+// they sold, ready to be counted or ordered.
+func ProductListQuery(db *gorm.DB, filter ProductFilter) *gorm.DB {
+	sold := db.Model(&models.TransactionHistory{}).
+		Select("product_id, SUM(quantity - refunded_quantity) AS sold").
+		Group("product_id")
+
+	query := db.Model(&models.Product{}).
+		Joins("LEFT JOIN (?) AS product_sales ON product_sales.product_id = products.id", sold)
+	if filter.CategoryID != 0 {
+		query = query.Where("products.category_id = ?", filter.CategoryID)
+	}
+	if filter.MinPrice != nil {
+		query = query.Where("products.price >= ?", *filter.MinPrice)
+	}
+	if filter.MaxPrice != nil {
+		query = query.Where("products.price <= ?", *filter.MaxPrice)
+	}
+	if filter.InStock {
+		query = query.Where("products.stock - products.reserved > 0")
+	}
+	if filter.CreatedAfter != nil {
+		query = query.Where("products.created_at >= ?", *filter.CreatedAfter)
+	}
+	if filter.CreatedBefore != nil {
+		query = query.Where("products.created_at < ?", *filter.CreatedBefore)
+	}
+	return query
+}
+
+// OrderProducts orders a product list query by sort, which must be a key of
+// ProductSorts, with the product ID breaking ties. A cursor from
+// EncodeProductCursor continues after the product it was made from.
+func OrderProducts(query *gorm.DB, sort string, descending bool, cursor string) (*gorm.DB, error) {
+	column, ok := ProductSorts[sort]
+	if !ok {
+		return nil, ErrUnknownProductSort
+	}
+	direction, compare := "ASC", ">"
+	if descending {
+		direction, compare = "DESC", "<"
+	}
+
+	if cursor != "" {
+		value, id, err := decodeProductCursor(cursor, sort)
+		if err != nil {
+			return nil, err
+		}
+		query = query.Where("("+column+" "+compare+" ?) OR ("+column+" = ? AND products.id "+compare+" ?)", value, value, id)
+	}
+	return query.Order(column + " " + direction).Order("products.id " + direction), nil
+}
@@ -0,0 +1,68 @@
+package helper
+
+import (
+	"encoding/base64"
+	"errors"
+	"main/models"
+	"testing"
+	"time"
+)
+
+func TestProductCursorRoundTrip(t *testing.T) {
+	createdAt := time.Date(2026, 3, 14, 15, 9, 26, 535897000, time.UTC)
+	product := ListedProduct{
+		Product: models.Product{ID: 42, Title: "Kopi, \"Arabica\"", Price: 125000, CreatedAt: createdAt},
+		Sold:    17,
+	}
+
+	tests := []struct {
+		sort string
+		want interface{}
+	}{
+		{"price", 125000},
+		{"popularity", 17},
+		{"title", "Kopi, \"Arabica\""},
+		{"created_at", createdAt},
+	}
+	for _, tt := range tests {
+		value, id, err := decodeProductCursor(EncodeProductCursor(product, tt.sort), tt.sort)
+		if err != nil {
+			t.Errorf("%s: %v", tt.sort, err)
+			continue
+		}
+		if id != product.ID {
+			t.Errorf("%s: id = %d, want %d", tt.sort, id, product.ID)
+		}
+		if at, ok := value.(time.Time); ok {
+			if !at.Equal(createdAt) {
+				t.Errorf("%s: value = %v, want %v", tt.sort, at, createdAt)
+			}
+		} else if value != tt.want {
+			t.Errorf("%s: value = %#v, want %#v", tt.sort, value, tt.want)
+		}
+	}
+}
+
+func TestDecodeProductCursorInvalid(t *testing.T) {
+	encode := func(raw string) string { return base64.RawURLEncoding.EncodeToString([]byte(raw)) }
+
+	tests := []struct {
+		name   string
+		cursor string
+		sort   string
+	}{
+		{"not base64", "not a cursor!", "price"},
+		{"not json", encode("price=10"), "price"},
+		{"missing id", encode(`{"v":"10"}`), "price"},
+		{"price not a number", encode(`{"v":"ten","id":1}`), "price"},
+		{"popularity not a number", encode(`{"v":"1.5","id":1}`), "popularity"},
+		{"bad time", encode(`{"v":"yesterday","id":1}`), "created_at"},
+		{"unknown sort", encode(`{"v":"10","id":1}`), "rating"},
+		{"other sort's cursor", EncodeProductCursor(ListedProduct{Product: models.Product{ID: 1, Title: "Tea"}}, "title"), "price"},
+	}
+	for _, tt := range tests {
+		if _, _, err := decodeProductCursor(tt.cursor, tt.sort); !errors.Is(err, ErrInvalidCursor) {
+			t.Errorf("%s: err = %v, want ErrInvalidCursor", tt.name, err)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package helper
+
+import (
+	"errors"
+	"main/models"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	CouponPercentage = "percentage"
+	CouponFixed      = "fixed"
+)
+
+var (
+	ErrCouponNotFound    = errors.New("coupon not found")
+	ErrCouponNotActive   = errors.New("coupon is not active")
+	ErrCouponUsedUp      = errors.New("coupon usage limit reached")
+	ErrCouponMinPurchase = errors.New("purchase is below the coupon minimum")
+	ErrCouponNotEligible = errors.New("coupon does not apply to these products")
+)
+
+// NormalizeCouponCode makes coupon codes case insensitive.
+func NormalizeCouponCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// couponLine is the part of a purchase line a coupon needs to know about.
+type couponLine struct {
+	ProductID  uint
+	CategoryID uint
+	Amount     int
+}
+
+// redeemCoupon locks the coupon, checks that userID may use it on lines and
+// counts the use. It returns the coupon and the discount for each line, in
+// the order of lines. The redemption row is written by the caller once the
+// order exists.
+func redeemCoupon(tx *gorm.DB, code string, userID uint, lines []couponLine, now time.Time) (*models.Coupon, []int, error) {
+	var coupon models.Coupon
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Preload("Categories").Preload("Products").
+		Where("code = ?", NormalizeCouponCode(code)).
+		First(&coupon).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil, ErrCouponNotFound
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if (coupon.StartsAt != nil && now.Before(*coupon.StartsAt)) || (coupon.EndsAt != nil && now.After(*coupon.EndsAt)) {
+		return nil, nil, ErrCouponNotActive
+	}
+	if coupon.UsageLimit > 0 && coupon.UsedCount >= coupon.UsageLimit {
+		return nil, nil, ErrCouponUsedUp
+	}
+	if coupon.PerUserLimit > 0 {
+		var used int64
+		err := tx.Model(&models.CouponRedemption{}).
+			Where("coupon_id = ? AND user_id = ?", coupon.ID, userID).
+			Count(&used).Error
+		if err != nil {
+			return nil, nil, err
+		}
+		if int(used) >= coupon.PerUserLimit {
+			return nil, nil, ErrCouponUsedUp
+		}
+	}
+
+	eligible := make([]bool, len(lines))
+	eligibleTotal := 0
+	for i, line := range lines {
+		if couponApplies(coupon, line) {
+			eligible[i] = true
+			eligibleTotal += line.Amount
+		}
+	}
+	if eligibleTotal == 0 {
+		return nil, nil, ErrCouponNotEligible
+	}
+	if eligibleTotal < coupon.MinPurchase {
+		return nil, nil, ErrCouponMinPurchase
+	}
+
+	discount := coupon.Value
+	if coupon.Type == CouponPercentage {
+		discount = eligibleTotal * coupon.Value / 100
+	}
+	if coupon.MaxDiscount > 0 && discount > coupon.MaxDiscount {
+		discount = coupon.MaxDiscount
+	}
+	if discount > eligibleTotal {
+		discount = eligibleTotal
+	}
+
+	// Spread the discount over the eligible lines in proportion to their
+	// amount, so refunding a line gives back what was actually paid for it.
+	discounts := make([]int, len(lines))
+	remaining, last := discount, -1
+	for i, line := range lines {
+		if !eligible[i] {
+			continue
+		}
+		discounts[i] = discount * line.Amount / eligibleTotal
+		remaining -= discounts[i]
+		last = i
+	}
+	discounts[last] += remaining
+
+	if err := tx.Model(&coupon).UpdateColumn("used_count", gorm.Expr("used_count + 1")).Error; err != nil {
+		return nil, nil, err
+	}
+
+	return &coupon, discounts, nil
+}
+
+func couponApplies(coupon models.Coupon, line couponLine) bool {
+	if len(coupon.Categories) == 0 && len(coupon.Products) == 0 {
+		return true
+	}
+	for _, category := range coupon.Categories {
+		if category.ID == line.CategoryID {
+			return true
+		}
+	}
+	for _, product := range coupon.Products {
+		if product.ID == line.ProductID {
+			return true
+		}
+	}
+	return false
+}
+
+// releaseCoupon gives a use back to the coupon of a cancelled or fully
+// refunded order.
+func releaseCoupon(tx *gorm.DB, order models.Order) error {
+	if order.CouponID == 0 {
+		return nil
+	}
+	err := tx.Where("coupon_id = ? AND order_id = ?", order.CouponID, order.ID).Delete(&models.CouponRedemption{}).Error
+	if err != nil {
+		return err
+	}
+	return tx.Model(&models.Coupon{}).
+		Where("id = ? AND used_count > 0", order.CouponID).
+		UpdateColumn("used_count", gorm.Expr("used_count - 1")).Error
+}
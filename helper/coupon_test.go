@@ -0,0 +1,214 @@
+package helper
+
+import (
+	"errors"
+	"fmt"
+	"main/models"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// buyWithCoupon runs a purchase of quantity units of productID using the
+// coupon code in its own transaction.
+func buyWithCoupon(db *gorm.DB, userID, productID uint, quantity int, code string) (*PurchaseResult, error) {
+	var result *PurchaseResult
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		result, err = Purchase(tx, PurchaseRequest{
+			UserID:     userID,
+			Lines:      []PurchaseLine{{ProductID: productID, Quantity: quantity}},
+			CouponCode: code,
+		})
+		return err
+	})
+	return result, err
+}
+
+func createTestCoupon(t *testing.T, db *gorm.DB, coupon models.Coupon) models.Coupon {
+	t.Helper()
+	if err := db.Create(&coupon).Error; err != nil {
+		t.Fatal(err)
+	}
+	return coupon
+}
+
+func TestRedeemCoupon(t *testing.T) {
+	db := openTestDB(t)
+	now := time.Now()
+	yesterday, tomorrow := now.Add(-24*time.Hour), now.Add(24*time.Hour)
+	user := createTestUser(t, db, "coupons@example.com", 0)
+	category := models.Category{Type: "Books"}
+	if err := db.Create(&category).Error; err != nil {
+		t.Fatal(err)
+	}
+	product := createTestProduct(t, db, models.Product{Title: "Pen", Price: 1000})
+
+	book := couponLine{ProductID: 100, CategoryID: category.ID, Amount: 30000}
+	pen := couponLine{ProductID: product.ID, CategoryID: product.CategoryID, Amount: 10000}
+
+	tests := []struct {
+		name    string
+		coupon  models.Coupon
+		lines   []couponLine
+		want    []int
+		wantErr error
+	}{
+		{"fixed", models.Coupon{Type: CouponFixed, Value: 4000}, []couponLine{book, pen}, []int{3000, 1000}, nil},
+		{"percentage", models.Coupon{Type: CouponPercentage, Value: 10}, []couponLine{book, pen}, []int{3000, 1000}, nil},
+		{"percentage capped", models.Coupon{Type: CouponPercentage, Value: 50, MaxDiscount: 5000}, []couponLine{book, pen}, []int{3750, 1250}, nil},
+		{"not more than the purchase", models.Coupon{Type: CouponFixed, Value: 50000}, []couponLine{pen}, []int{10000}, nil},
+		{"uneven split", models.Coupon{Type: CouponFixed, Value: 1000}, []couponLine{pen, pen, pen}, []int{333, 333, 334}, nil},
+		{"category only", models.Coupon{Type: CouponPercentage, Value: 10, Categories: []models.Category{category}}, []couponLine{book, pen}, []int{3000, 0}, nil},
+		{"product only", models.Coupon{Type: CouponPercentage, Value: 10, Products: []models.Product{product}}, []couponLine{book, pen}, []int{0, 1000}, nil},
+		{"nothing eligible", models.Coupon{Type: CouponFixed, Value: 1000, Categories: []models.Category{category}}, []couponLine{pen}, nil, ErrCouponNotEligible},
+		{"exactly the minimum", models.Coupon{Type: CouponFixed, Value: 1000, MinPurchase: 40000}, []couponLine{book, pen}, []int{750, 250}, nil},
+		{"below the minimum", models.Coupon{Type: CouponFixed, Value: 1000, MinPurchase: 40001}, []couponLine{book, pen}, nil, ErrCouponMinPurchase},
+		{"minimum counts eligible lines only", models.Coupon{Type: CouponFixed, Value: 1000, MinPurchase: 20000, Products: []models.Product{product}}, []couponLine{book, pen}, nil, ErrCouponMinPurchase},
+		{"not started", models.Coupon{Type: CouponFixed, Value: 1000, StartsAt: &tomorrow}, []couponLine{pen}, nil, ErrCouponNotActive},
+		{"ended", models.Coupon{Type: CouponFixed, Value: 1000, EndsAt: &yesterday}, []couponLine{pen}, nil, ErrCouponNotActive},
+		{"within its dates", models.Coupon{Type: CouponFixed, Value: 1000, StartsAt: &yesterday, EndsAt: &tomorrow}, []couponLine{pen}, []int{1000}, nil},
+		{"used up", models.Coupon{Type: CouponFixed, Value: 1000, UsageLimit: 5, UsedCount: 5}, []couponLine{pen}, nil, ErrCouponUsedUp},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.coupon.Code = fmt.Sprintf("CODE%d", i)
+			coupon := createTestCoupon(t, db, tt.coupon)
+
+			var discounts []int
+			err := db.Transaction(func(tx *gorm.DB) error {
+				var err error
+				// Codes are matched case insensitively
+				_, discounts, err = redeemCoupon(tx, fmt.Sprintf(" code%d ", i), user.ID, tt.lines, now)
+				return err
+			})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("error = %v, want %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(discounts, tt.want) {
+				t.Errorf("discounts = %v, want %v", discounts, tt.want)
+			}
+
+			if err := db.First(&coupon, coupon.ID).Error; err != nil {
+				t.Fatal(err)
+			}
+			wantUsed := tt.coupon.UsedCount
+			if tt.wantErr == nil {
+				wantUsed++
+			}
+			if coupon.UsedCount != wantUsed {
+				t.Errorf("used count = %d, want %d", coupon.UsedCount, wantUsed)
+			}
+		})
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		_, _, err := redeemCoupon(tx, "MISSING", user.ID, []couponLine{pen}, now)
+		return err
+	})
+	if !errors.Is(err, ErrCouponNotFound) {
+		t.Errorf("unknown code: %v, want ErrCouponNotFound", err)
+	}
+}
+
+func TestCouponUsageLimits(t *testing.T) {
+	db := openTestDB(t)
+	product := createTestProduct(t, db, models.Product{Title: "Pen", Price: 10000, Stock: 100})
+	coupon := createTestCoupon(t, db, models.Coupon{Code: "TWICE", Type: CouponFixed, Value: 2000, UsageLimit: 2, PerUserLimit: 1})
+	first := createTestUser(t, db, "first@example.com", 100000)
+	second := createTestUser(t, db, "second@example.com", 100000)
+	third := createTestUser(t, db, "third@example.com", 100000)
+
+	result, err := buyWithCoupon(db, first.ID, product.ID, 1, "twice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.TotalPrice != 8000 {
+		t.Errorf("total with the coupon = %d, want 8000", result.TotalPrice)
+	}
+	if _, err := buyWithCoupon(db, first.ID, product.ID, 1, "twice"); !errors.Is(err, ErrCouponUsedUp) {
+		t.Errorf("second use by the same customer: %v, want ErrCouponUsedUp", err)
+	}
+	if _, err := buyWithCoupon(db, second.ID, product.ID, 1, "twice"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := buyWithCoupon(db, third.ID, product.ID, 1, "twice"); !errors.Is(err, ErrCouponUsedUp) {
+		t.Errorf("use past the total limit: %v, want ErrCouponUsedUp", err)
+	}
+
+	// Cancelling an order gives its use back to the coupon and the customer.
+	err = db.Transaction(func(tx *gorm.DB) error {
+		_, err := CancelOrder(tx, result.Order.ID, first.ID, "customer_request")
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := buyWithCoupon(db, third.ID, product.ID, 1, "twice"); err != nil {
+		t.Errorf("use after a cancellation: %v", err)
+	}
+	if _, err := buyWithCoupon(db, first.ID, product.ID, 1, "twice"); !errors.Is(err, ErrCouponUsedUp) {
+		t.Errorf("use past the total limit: %v, want ErrCouponUsedUp", err)
+	}
+
+	if err := db.First(&coupon, coupon.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	var redemptions int64
+	if err := db.Model(&models.CouponRedemption{}).Where("coupon_id = ?", coupon.ID).Count(&redemptions).Error; err != nil {
+		t.Fatal(err)
+	}
+	if coupon.UsedCount != 2 || redemptions != 2 {
+		t.Errorf("used count %d and %d redemptions, want 2", coupon.UsedCount, redemptions)
+	}
+	assertWalletsBalanced(t, db)
+}
+
+func TestCouponLastUseConcurrent(t *testing.T) {
+	db := openTestDB(t)
+	const buyers = 10
+	product := createTestProduct(t, db, models.Product{Title: "Pen", Price: 10000, Stock: 100})
+	coupon := createTestCoupon(t, db, models.Coupon{Code: "LAST", Type: CouponFixed, Value: 2000, UsageLimit: 3, UsedCount: 2})
+	users := make([]models.User, buyers)
+	for i := range users {
+		users[i] = createTestUser(t, db, fmt.Sprintf("buyer%d@example.com", i), 10000)
+	}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	redeemed := 0
+	for _, user := range users {
+		wg.Add(1)
+		go func(user models.User) {
+			defer wg.Done()
+			_, err := buyWithCoupon(db, user.ID, product.ID, 1, "LAST")
+			switch {
+			case err == nil:
+				mu.Lock()
+				redeemed++
+				mu.Unlock()
+			case !errors.Is(err, ErrCouponUsedUp):
+				t.Error(err)
+			}
+		}(user)
+	}
+	wg.Wait()
+
+	if redeemed != 1 {
+		t.Errorf("the last use was redeemed %d times", redeemed)
+	}
+	if err := db.First(&coupon, coupon.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	var redemptions int64
+	if err := db.Model(&models.CouponRedemption{}).Where("coupon_id = ?", coupon.ID).Count(&redemptions).Error; err != nil {
+		t.Fatal(err)
+	}
+	if coupon.UsedCount != 3 || redemptions != 1 {
+		t.Errorf("used count %d and %d redemptions, want 3 and 1", coupon.UsedCount, redemptions)
+	}
+	assertWalletsBalanced(t, db)
+}
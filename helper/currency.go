@@ -0,0 +1,96 @@
+package helper
+
+import (
+	"errors"
+	"fmt"
+	"main/models"
+	"math/big"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrUnsupportedCurrency = errors.New("unsupported currency")
+	ErrNoExchangeRate      = errors.New("no exchange rate for currency pair")
+)
+
+// ConvertMoney converts m into the to currency using the exchange_rates
+// table, trying the inverse pair when only that one is configured. The result
+// is rounded half away from zero to the minor unit of the target currency.
+func ConvertMoney(db *gorm.DB, m models.Money, to string) (models.Money, error) {
+	to = strings.ToUpper(to)
+	if m.Currency == to {
+		return m, nil
+	}
+
+	from, ok := models.LookupCurrency(m.Currency)
+	if !ok {
+		return models.Money{}, fmt.Errorf("%w %q", ErrUnsupportedCurrency, m.Currency)
+	}
+	target, ok := models.LookupCurrency(to)
+	if !ok {
+		return models.Money{}, fmt.Errorf("%w %q", ErrUnsupportedCurrency, to)
+	}
+
+	rate, err := exchangeRate(db, from.Code, target.Code)
+	if err != nil {
+		return models.Money{}, err
+	}
+
+	value := new(big.Rat).SetInt64(int64(m.Amount))
+	value.Mul(value, rate)
+	value.Mul(value, pow10(target.Decimals))
+	value.Quo(value, pow10(from.Decimals))
+
+	return models.NewMoney(roundRat(value), target.Code), nil
+}
+
+func exchangeRate(db *gorm.DB, from, to string) (*big.Rat, error) {
+	var rate models.ExchangeRate
+	err := db.Where(`"from" = ? AND "to" = ?`, from, to).Limit(1).Find(&rate).Error
+	if err != nil {
+		return nil, err
+	}
+	if rate.ID != 0 {
+		return ParseRate(rate.Rate)
+	}
+
+	err = db.Where(`"from" = ? AND "to" = ?`, to, from).Limit(1).Find(&rate).Error
+	if err != nil {
+		return nil, err
+	}
+	if rate.ID == 0 {
+		return nil, fmt.Errorf("%w %s/%s", ErrNoExchangeRate, from, to)
+	}
+	inverse, err := ParseRate(rate.Rate)
+	if err != nil {
+		return nil, err
+	}
+	return inverse.Inv(inverse), nil
+}
+
+// ParseRate parses a positive decimal exchange rate such as "0.0000625".
+func ParseRate(s string) (*big.Rat, error) {
+	rate, ok := new(big.Rat).SetString(s)
+	if !ok || rate.Sign() <= 0 {
+		return nil, fmt.Errorf("invalid exchange rate %q", s)
+	}
+	return rate, nil
+}
+
+func pow10(n int) *big.Rat {
+	return new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil))
+}
+
+func roundRat(r *big.Rat) int {
+	num := new(big.Int).Set(r.Num())
+	den := r.Denom()
+	half := new(big.Int).Set(den)
+	if num.Sign() < 0 {
+		num.Sub(num, new(big.Int).Quo(half, big.NewInt(2)))
+	} else {
+		num.Add(num, new(big.Int).Quo(half, big.NewInt(2)))
+	}
+	return int(new(big.Int).Quo(num, den).Int64())
+}
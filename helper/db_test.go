@@ -0,0 +1,85 @@
+package helper
+
+import (
+	"main/models"
+	"main/testdb"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+// openTestDB returns an empty, migrated database for one test with product
+// search set up, see testdb.Open.
+func openTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db := testdb.Open(t)
+	if err := SetupProductSearch(db); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// createTestUser creates a customer whose wallet has been topped up with
+// balance through the ledger.
+func createTestUser(t *testing.T, db *gorm.DB, email string, balance int) models.User {
+	t.Helper()
+	user := testdb.CreateUser(t, db, email, "customer")
+	if balance > 0 {
+		err := db.Transaction(func(tx *gorm.DB) error {
+			_, err := PostWalletEntry(tx, user.ID, WalletEntryTopup, balance, AccountPaymentsClearing, "", 0, "Test topup")
+			return err
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.First(&user, user.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+// createTestProduct creates product in a category of its own.
+func createTestProduct(t *testing.T, db *gorm.DB, product models.Product) models.Product {
+	return testdb.CreateProduct(t, db, product)
+}
+
+// buy runs a purchase of quantity units of productID in its own transaction.
+func buy(db *gorm.DB, userID, productID uint, quantity int) (*PurchaseResult, error) {
+	var result *PurchaseResult
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		result, err = Purchase(tx, PurchaseRequest{
+			UserID: userID,
+			Lines:  []PurchaseLine{{ProductID: productID, Quantity: quantity}},
+		})
+		return err
+	})
+	return result, err
+}
+
+// assertWalletsBalanced fails the test when a user's balance has drifted
+// from their ledger or the journal does not balance.
+func assertWalletsBalanced(t *testing.T, db *gorm.DB) {
+	t.Helper()
+	var users []models.User
+	if err := db.Find(&users).Error; err != nil {
+		t.Fatal(err)
+	}
+	for _, user := range users {
+		report, err := VerifyWallet(db, user)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if report.Drifted() {
+			t.Errorf("wallet of user %d drifted: %+v", user.ID, report)
+		}
+	}
+	unbalanced, err := UnbalancedJournalEntries(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(unbalanced) > 0 {
+		t.Errorf("unbalanced journal entries %v", unbalanced)
+	}
+}
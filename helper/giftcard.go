@@ -0,0 +1,173 @@
+package helper
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"log"
+	"main/config"
+	"main/models"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrGiftCardNotFound        = errors.New("gift card not found")
+	ErrGiftCardRedeemed        = errors.New("gift card has already been redeemed")
+	ErrGiftCardExpired         = errors.New("gift card has expired")
+	ErrTooManyGiftCardAttempts = errors.New("too many failed gift card attempts")
+)
+
+// giftCardBytes of randomness make 16 base32 characters, 80 bits that are
+// out of reach of guessing with redemptions throttled.
+const giftCardBytes = 10
+
+// GenerateGiftCardCode returns a new random code grouped as XXXX-XXXX-XXXX-XXXX.
+func GenerateGiftCardCode() (string, error) {
+	buf := make([]byte, giftCardBytes)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	raw := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(buf)
+
+	groups := make([]string, 0, len(raw)/4)
+	for i := 0; i < len(raw); i += 4 {
+		groups = append(groups, raw[i:i+4])
+	}
+	return strings.Join(groups, "-"), nil
+}
+
+// normalizeGiftCardCode drops the separators and case customers may type a
+// code with, so every spelling of it hashes the same.
+func normalizeGiftCardCode(code string) string {
+	code = strings.ToUpper(code)
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
+
+func hashGiftCardCode(code string) string {
+	return HashToken(normalizeGiftCardCode(code))
+}
+
+// IssueGiftCards creates count gift cards worth amount of currency in one
+// batch and returns them with their codes, which are not stored and cannot be
+// shown again.
+func IssueGiftCards(tx *gorm.DB, count int, amount int, currency string, expiresAt *time.Time, createdBy uint) ([]models.GiftCard, []string, error) {
+	batchID, err := GenerateToken(8)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	cards := make([]models.GiftCard, count)
+	codes := make([]string, count)
+	for i := range cards {
+		code, err := GenerateGiftCardCode()
+		if err != nil {
+			return nil, nil, err
+		}
+		normalized := normalizeGiftCardCode(code)
+		codes[i] = code
+		cards[i] = models.GiftCard{
+			BatchID:   batchID,
+			CodeHash:  HashToken(normalized),
+			Last4:     normalized[len(normalized)-4:],
+			Amount:    amount,
+			Currency:  currency,
+			ExpiresAt: expiresAt,
+			CreatedBy: createdBy,
+		}
+	}
+	if err := tx.CreateInBatches(&cards, 100).Error; err != nil {
+		return nil, nil, err
+	}
+	return cards, codes, nil
+}
+
+// RedeemGiftCard credits the gift card with code to the user's wallet as a
+// topup. Wrong codes are recorded, and once the user or their IP has made
+// too many within the window it fails with ErrTooManyGiftCardAttempts without
+// looking the code up.
+//
+// Every redemption records its attempt before counting, so of any number of
+// concurrent guesses only those that fit under the limit get to look a code
+// up. The attempt is forgotten again unless the code turns out to be wrong.
+func RedeemGiftCard(db *gorm.DB, cfg *config.GiftCardConfig, userID uint, ip string, code string, now time.Time) (*models.GiftCard, *models.WalletEntry, error) {
+	attempt := models.GiftCardAttempt{UserID: userID, IP: ip, CreatedAt: now}
+	if err := db.Create(&attempt).Error; err != nil {
+		return nil, nil, err
+	}
+
+	var attempts int64
+	err := db.Model(&models.GiftCardAttempt{}).
+		Where("(user_id = ? OR ip = ?) AND created_at > ?", userID, ip, now.Add(-cfg.AttemptWindow)).
+		Count(&attempts).Error
+	if err == nil && attempts > int64(cfg.MaxFailedAttempts) {
+		err = ErrTooManyGiftCardAttempts
+	}
+	if err != nil {
+		releaseGiftCardAttempt(db, attempt)
+		return nil, nil, err
+	}
+
+	var card models.GiftCard
+	var entry *models.WalletEntry
+	err = db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("code_hash = ?", hashGiftCardCode(code)).
+			First(&card).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrGiftCardNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if card.RedeemedAt != nil {
+			return ErrGiftCardRedeemed
+		}
+		if card.ExpiresAt != nil && !now.Before(*card.ExpiresAt) {
+			return ErrGiftCardExpired
+		}
+
+		// Cards may be issued in another currency, the wallet is always
+		// credited in the base currency.
+		credit, err := ConvertMoney(tx, models.NewMoney(card.Amount, card.Currency), models.BaseCurrency)
+		if err != nil {
+			return err
+		}
+		entry, err = PostWalletEntry(tx, userID, WalletEntryTopup, credit.Amount, AccountGiftCards, "gift_card", card.ID, "Gift card ending "+card.Last4)
+		if err != nil {
+			return err
+		}
+
+		card.RedeemedBy = &userID
+		card.RedeemedAt = &now
+		return tx.Model(&card).Updates(map[string]interface{}{
+			"redeemed_by": userID,
+			"redeemed_at": now,
+		}).Error
+	})
+	if !errors.Is(err, ErrGiftCardNotFound) {
+		releaseGiftCardAttempt(db, attempt)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return &card, entry, nil
+}
+
+// releaseGiftCardAttempt forgets an attempt that did not guess a wrong code.
+// Failing to do so only counts it against the limit, so it is logged rather
+// than failing the redemption.
+func releaseGiftCardAttempt(db *gorm.DB, attempt models.GiftCardAttempt) {
+	if err := db.Delete(&attempt).Error; err != nil {
+		log.Printf("Failed to release gift card attempt %d: %v", attempt.ID, err)
+	}
+}
+
+// DeleteOldGiftCardAttempts forgets failed attempts that no longer count
+// towards a lockout.
+func DeleteOldGiftCardAttempts(db *gorm.DB, cfg *config.GiftCardConfig) error {
+	return db.Where("created_at < ?", time.Now().Add(-cfg.AttemptWindow)).Delete(&models.GiftCardAttempt{}).Error
+}
@@ -0,0 +1,170 @@
+package helper
+
+import (
+	"errors"
+	"fmt"
+	"main/config"
+	"main/models"
+	"sync"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+func issueTestGiftCard(t *testing.T, db *gorm.DB, amount int, expiresAt *time.Time) string {
+	t.Helper()
+	var codes []string
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		_, codes, err = IssueGiftCards(tx, 1, amount, models.BaseCurrency, expiresAt, 0)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return codes[0]
+}
+
+func countGiftCardAttempts(t *testing.T, db *gorm.DB) int64 {
+	t.Helper()
+	var attempts int64
+	if err := db.Model(&models.GiftCardAttempt{}).Count(&attempts).Error; err != nil {
+		t.Fatal(err)
+	}
+	return attempts
+}
+
+func TestRedeemGiftCardLockout(t *testing.T) {
+	db := openTestDB(t)
+	cfg := &config.GiftCardConfig{MaxFailedAttempts: 3, AttemptWindow: 15 * time.Minute}
+	guesser := createTestUser(t, db, "guesser@example.com", 0)
+	neighbour := createTestUser(t, db, "neighbour@example.com", 0)
+	stranger := createTestUser(t, db, "stranger@example.com", 0)
+	code := issueTestGiftCard(t, db, 50000, nil)
+	now := time.Now()
+
+	for i := 0; i < cfg.MaxFailedAttempts; i++ {
+		if _, _, err := RedeemGiftCard(db, cfg, guesser.ID, "10.0.0.1", fmt.Sprintf("WRONG-%d", i), now); !errors.Is(err, ErrGiftCardNotFound) {
+			t.Fatalf("wrong guess %d: %v, want ErrGiftCardNotFound", i+1, err)
+		}
+	}
+
+	// Once locked out even the right code is refused, for the user from
+	// anywhere and for anyone from the same address.
+	if _, _, err := RedeemGiftCard(db, cfg, guesser.ID, "10.0.0.1", code, now); !errors.Is(err, ErrTooManyGiftCardAttempts) {
+		t.Errorf("guess after the limit: %v, want ErrTooManyGiftCardAttempts", err)
+	}
+	if _, _, err := RedeemGiftCard(db, cfg, guesser.ID, "10.0.0.2", code, now); !errors.Is(err, ErrTooManyGiftCardAttempts) {
+		t.Errorf("same user from another address: %v, want ErrTooManyGiftCardAttempts", err)
+	}
+	if _, _, err := RedeemGiftCard(db, cfg, neighbour.ID, "10.0.0.1", code, now); !errors.Is(err, ErrTooManyGiftCardAttempts) {
+		t.Errorf("another user from the same address: %v, want ErrTooManyGiftCardAttempts", err)
+	}
+	// Refused attempts do not extend the lockout.
+	if got := countGiftCardAttempts(t, db); got != int64(cfg.MaxFailedAttempts) {
+		t.Errorf("%d attempts recorded, want %d", got, cfg.MaxFailedAttempts)
+	}
+
+	if _, _, err := RedeemGiftCard(db, cfg, stranger.ID, "10.0.0.3", "WRONG", now); !errors.Is(err, ErrGiftCardNotFound) {
+		t.Errorf("unrelated user: %v, want ErrGiftCardNotFound", err)
+	}
+
+	// The lockout ends with the window.
+	later := now.Add(cfg.AttemptWindow + time.Second)
+	card, entry, err := RedeemGiftCard(db, cfg, guesser.ID, "10.0.0.1", code, later)
+	if err != nil {
+		t.Fatalf("redeeming after the window: %v", err)
+	}
+	if card.RedeemedBy == nil || *card.RedeemedBy != guesser.ID || entry.Amount != 50000 {
+		t.Errorf("card redeemed by %v for %d", card.RedeemedBy, entry.Amount)
+	}
+	assertWalletsBalanced(t, db)
+}
+
+func TestRedeemGiftCardReleasesAttempts(t *testing.T) {
+	db := openTestDB(t)
+	cfg := &config.GiftCardConfig{MaxFailedAttempts: 2, AttemptWindow: 15 * time.Minute}
+	user := createTestUser(t, db, "redeemer@example.com", 0)
+	now := time.Now()
+	yesterday := now.Add(-24 * time.Hour)
+	code := issueTestGiftCard(t, db, 25000, nil)
+	expired := issueTestGiftCard(t, db, 25000, &yesterday)
+
+	if _, _, err := RedeemGiftCard(db, cfg, user.ID, "10.0.0.1", code, now); err != nil {
+		t.Fatal(err)
+	}
+	// Mistakes that are not guesses never count towards the limit.
+	for i := 0; i < 3; i++ {
+		if _, _, err := RedeemGiftCard(db, cfg, user.ID, "10.0.0.1", code, now); !errors.Is(err, ErrGiftCardRedeemed) {
+			t.Errorf("redeeming twice: %v, want ErrGiftCardRedeemed", err)
+		}
+		if _, _, err := RedeemGiftCard(db, cfg, user.ID, "10.0.0.1", expired, now); !errors.Is(err, ErrGiftCardExpired) {
+			t.Errorf("redeeming an expired card: %v, want ErrGiftCardExpired", err)
+		}
+	}
+	if got := countGiftCardAttempts(t, db); got != 0 {
+		t.Errorf("%d attempts kept, want none", got)
+	}
+
+	var current models.User
+	if err := db.First(&current, user.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if current.Balance != 25000 {
+		t.Errorf("balance = %d, want 25000", current.Balance)
+	}
+
+	// Old attempts are swept once they fall out of the window.
+	old := models.GiftCardAttempt{UserID: user.ID, IP: "10.0.0.1", CreatedAt: now.Add(-time.Hour)}
+	if err := db.Create(&old).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := DeleteOldGiftCardAttempts(db, cfg); err != nil {
+		t.Fatal(err)
+	}
+	if got := countGiftCardAttempts(t, db); got != 0 {
+		t.Errorf("%d attempts left after the sweep, want none", got)
+	}
+	assertWalletsBalanced(t, db)
+}
+
+func TestRedeemGiftCardConcurrentGuesses(t *testing.T) {
+	db := openTestDB(t)
+	cfg := &config.GiftCardConfig{MaxFailedAttempts: 5, AttemptWindow: 15 * time.Minute}
+	user := createTestUser(t, db, "guesser@example.com", 0)
+	code := issueTestGiftCard(t, db, 50000, nil)
+	now := time.Now()
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	guessed := 0
+	for i := 0; i < 30; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, _, err := RedeemGiftCard(db, cfg, user.ID, "10.0.0.1", fmt.Sprintf("WRONG-%d", i), now)
+			switch {
+			case errors.Is(err, ErrGiftCardNotFound):
+				mu.Lock()
+				guessed++
+				mu.Unlock()
+			case !errors.Is(err, ErrTooManyGiftCardAttempts):
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if guessed == 0 || guessed > cfg.MaxFailedAttempts {
+		t.Errorf("%d guesses checked, want 1 to %d", guessed, cfg.MaxFailedAttempts)
+	}
+	if got := countGiftCardAttempts(t, db); got != int64(guessed) {
+		t.Errorf("%d attempts recorded for %d guesses", got, guessed)
+	}
+	if guessed == cfg.MaxFailedAttempts {
+		if _, _, err := RedeemGiftCard(db, cfg, user.ID, "10.0.0.1", code, now); !errors.Is(err, ErrTooManyGiftCardAttempts) {
+			t.Errorf("right code after the limit: %v, want ErrTooManyGiftCardAttempts", err)
+		}
+	}
+}
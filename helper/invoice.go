@@ -0,0 +1,140 @@
+package helper
+
+import (
+	"main/config"
+	"main/models"
+	"strconv"
+	"time"
+)
+
+type InvoiceLine struct {
+	Title     string
+	Quantity  int
+	UnitPrice models.Money
+	Total     models.Money
+}
+
+type Invoice struct {
+	Number     string
+	IssuedAt   time.Time
+	Store      *config.StoreConfig
+	BuyerName  string
+	BuyerEmail string
+	ShipTo     string
+	Lines      []InvoiceLine
+	Subtotal   models.Money
+	Discount   models.Money
+	Shipping   models.Money
+	Tax        models.Money
+	// TaxLabel names the tax, TaxRates lists the rates charged on the lines
+	// in basis points, and TaxIncluded says whether line amounts contain it.
+	TaxLabel    string
+	TaxRates    []int
+	TaxIncluded bool
+	Total       models.Money
+	Refunded    models.Money
+}
+
+// RenderInvoicePDF lays the invoice out on as many A4 pages as its lines need.
+func RenderInvoicePDF(invoice Invoice) []byte {
+	const (
+		left   = 50.0
+		right  = PDFPageWidth - 50
+		bottom = 80.0
+	)
+	doc := NewPDFDocument()
+
+	y := PDFPageHeight - 60
+	doc.Text(left, y, 20, true, invoice.Store.Name)
+	doc.TextRight(right, y, 20, true, "INVOICE")
+	y -= 18
+	doc.Text(left, y, 9, false, invoice.Store.Address)
+	doc.TextRight(right, y, 10, false, invoice.Number)
+	y -= 12
+	doc.Text(left, y, 9, false, invoice.Store.Email)
+	doc.TextRight(right, y, 10, false, invoice.IssuedAt.Format("02 January 2006"))
+	y -= 12
+	doc.Text(left, y, 9, false, invoice.Store.TaxID)
+
+	y -= 36
+	doc.Text(left, y, 10, true, "Bill to")
+	y -= 14
+	doc.Text(left, y, 10, false, invoice.BuyerName)
+	y -= 12
+	doc.Text(left, y, 10, false, invoice.BuyerEmail)
+	if invoice.ShipTo != "" {
+		y -= 12
+		doc.Text(left, y, 9, false, "Ship to: "+invoice.ShipTo)
+	}
+
+	header := func() {
+		y -= 30
+		doc.Text(left, y, 10, true, "Item")
+		doc.TextRight(340, y, 10, true, "Qty")
+		doc.TextRight(440, y, 10, true, "Unit price")
+		doc.TextRight(right, y, 10, true, "Amount")
+		y -= 6
+		doc.Line(left, y, right, y)
+	}
+	header()
+
+	for _, line := range invoice.Lines {
+		if y < bottom+100 {
+			doc.AddPage()
+			y = PDFPageHeight - 30
+			header()
+		}
+		y -= 16
+		doc.Text(left, y, 10, false, truncateText(line.Title, 260, 10))
+		doc.TextRight(340, y, 10, false, strconv.Itoa(line.Quantity))
+		doc.TextRight(440, y, 10, false, line.UnitPrice.String())
+		doc.TextRight(right, y, 10, false, line.Total.String())
+	}
+
+	y -= 10
+	doc.Line(left, y, right, y)
+
+	total := func(label string, amount models.Money, bold bool) {
+		y -= 16
+		doc.TextRight(440, y, 10, bold, label)
+		doc.TextRight(right, y, 10, bold, amount.String())
+	}
+	total("Subtotal", invoice.Subtotal, false)
+	if invoice.Discount.Amount > 0 {
+		total("Discount", models.NewMoney(0, invoice.Discount.Currency).Sub(invoice.Discount), false)
+	}
+	total("Shipping", invoice.Shipping, false)
+	taxLabel := invoice.TaxLabel
+	if taxLabel == "" {
+		taxLabel = "Tax"
+	}
+	if len(invoice.TaxRates) == 1 {
+		taxLabel += " " + FormatTaxRate(invoice.TaxRates[0])
+	}
+	if invoice.TaxIncluded {
+		total("Total", invoice.Total, true)
+		total(taxLabel+" included", invoice.Tax, false)
+	} else {
+		total(taxLabel, invoice.Tax, false)
+		total("Total", invoice.Total, true)
+	}
+	if invoice.Refunded.Amount > 0 {
+		total("Refunded", invoice.Refunded, false)
+	}
+
+	doc.Text(left, bottom-40, 8, false, "Amounts are in "+invoice.Total.Currency+". Thank you for shopping at "+invoice.Store.Name+".")
+
+	return doc.Bytes()
+}
+
+// truncateText shortens s with an ellipsis so it fits in width points.
+func truncateText(s string, width, size float64) string {
+	if PDFTextWidth(s, size) <= width {
+		return s
+	}
+	runes := []rune(s)
+	for len(runes) > 0 && PDFTextWidth(string(runes)+"...", size) > width {
+		runes = runes[:len(runes)-1]
+	}
+	return string(runes) + "..."
+}
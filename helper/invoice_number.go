@@ -0,0 +1,29 @@
+package helper
+
+import (
+	"fmt"
+	"main/models"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// NextInvoiceNumber hands out the next number of the month of t, formatted
+// like INV/2026/10/000123. The increment locks the month's sequence row
+// until tx ends, so concurrent purchases queue up instead of sharing a number,
+// and a rolled back purchase gives its number back, leaving no gaps.
+func NextInvoiceNumber(tx *gorm.DB, t time.Time) (string, error) {
+	sequence := models.InvoiceSequence{Period: t.Format("2006/01"), LastNumber: 1}
+	err := tx.Clauses(
+		clause.OnConflict{
+			Columns:   []clause.Column{{Name: "period"}},
+			DoUpdates: clause.Assignments(map[string]interface{}{"last_number": gorm.Expr("invoice_sequences.last_number + 1")}),
+		},
+		clause.Returning{Columns: []clause.Column{{Name: "last_number"}}},
+	).Create(&sequence).Error
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("INV/%s/%06d", sequence.Period, sequence.LastNumber), nil
+}
@@ -0,0 +1,153 @@
+package helper
+
+import (
+	"errors"
+	"fmt"
+	"main/models"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+func nextInvoiceNumber(t *testing.T, db *gorm.DB, at time.Time) string {
+	t.Helper()
+	var number string
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		number, err = NextInvoiceNumber(tx, at)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return number
+}
+
+func TestNextInvoiceNumber(t *testing.T) {
+	db := openTestDB(t)
+	december := time.Date(2026, 12, 31, 23, 59, 59, 0, time.UTC)
+	january := time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	for i, want := range []string{"INV/2026/12/000001", "INV/2026/12/000002", "INV/2026/12/000003"} {
+		if got := nextInvoiceNumber(t, db, december); got != want {
+			t.Errorf("number %d = %s, want %s", i+1, got, want)
+		}
+	}
+
+	// A rolled back purchase gives its number back.
+	errRollback := errors.New("rollback")
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if _, err := NextInvoiceNumber(tx, december); err != nil {
+			return err
+		}
+		return errRollback
+	})
+	if !errors.Is(err, errRollback) {
+		t.Fatal(err)
+	}
+	if got := nextInvoiceNumber(t, db, december); got != "INV/2026/12/000004" {
+		t.Errorf("number after a rollback = %s, want INV/2026/12/000004", got)
+	}
+
+	// The new year starts its own sequence and leaves the old one alone.
+	if got := nextInvoiceNumber(t, db, january); got != "INV/2027/01/000001" {
+		t.Errorf("first number of the year = %s, want INV/2027/01/000001", got)
+	}
+	if got := nextInvoiceNumber(t, db, december); got != "INV/2026/12/000005" {
+		t.Errorf("late number for December = %s, want INV/2026/12/000005", got)
+	}
+	if got := nextInvoiceNumber(t, db, january.AddDate(0, 0, 1)); got != "INV/2027/01/000002" {
+		t.Errorf("second number of the year = %s, want INV/2027/01/000002", got)
+	}
+}
+
+func TestNextInvoiceNumberConcurrent(t *testing.T) {
+	db := openTestDB(t)
+	const workers = 20
+	at := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+
+	// Every other transaction rolls back after taking a number; the committed
+	// ones still have to share out 1 to workers/2 between them.
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var committed []string
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(rollback bool) {
+			defer wg.Done()
+			var number string
+			err := db.Transaction(func(tx *gorm.DB) error {
+				var err error
+				if number, err = NextInvoiceNumber(tx, at); err != nil {
+					return err
+				}
+				if rollback {
+					return errors.New("rollback")
+				}
+				return nil
+			})
+			if err == nil {
+				mu.Lock()
+				committed = append(committed, number)
+				mu.Unlock()
+			} else if !rollback {
+				t.Error(err)
+			}
+		}(i%2 == 1)
+	}
+	wg.Wait()
+
+	sort.Strings(committed)
+	if len(committed) != workers/2 {
+		t.Fatalf("%d numbers committed, want %d", len(committed), workers/2)
+	}
+	for i, number := range committed {
+		if want := fmt.Sprintf("INV/2026/10/%06d", i+1); number != want {
+			t.Errorf("numbers %v have a gap or duplicate at %s", committed, want)
+			break
+		}
+	}
+}
+
+func TestPurchaseInvoiceNumbersConcurrent(t *testing.T) {
+	db := openTestDB(t)
+	const (
+		buyers = 12
+		stock  = 8
+	)
+	product := createTestProduct(t, db, models.Product{Title: "Numbered", Price: 1000, Stock: stock})
+	users := make([]models.User, buyers)
+	for i := range users {
+		users[i] = createTestUser(t, db, fmt.Sprintf("buyer%d@example.com", i), 1000)
+	}
+
+	// More buyers than stock, so some purchases fail and roll back.
+	var wg sync.WaitGroup
+	for _, user := range users {
+		wg.Add(1)
+		go func(user models.User) {
+			defer wg.Done()
+			if _, err := buy(db, user.ID, product.ID, 1); err != nil && !errors.Is(err, ErrInsufficientStock) {
+				t.Error(err)
+			}
+		}(user)
+	}
+	wg.Wait()
+
+	var orders []models.Order
+	if err := db.Order("invoice_number").Find(&orders).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(orders) != stock {
+		t.Fatalf("%d orders, want %d", len(orders), stock)
+	}
+	prefix := "INV/" + time.Now().Format("2006/01") + "/"
+	for i, order := range orders {
+		if want := fmt.Sprintf("%s%06d", prefix, i+1); order.InvoiceNumber != want {
+			t.Errorf("order %d has invoice number %s, want %s", order.ID, order.InvoiceNumber, want)
+		}
+	}
+}
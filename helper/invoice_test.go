@@ -0,0 +1,164 @@
+package helper
+
+import (
+	"bytes"
+	"fmt"
+	"main/config"
+	"main/models"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// checkPDFStructure fails the test unless every cross-reference entry and
+// stream length of the document points where it should, and returns the
+// number of pages.
+func checkPDFStructure(t *testing.T, pdf []byte) int {
+	t.Helper()
+	if !bytes.HasPrefix(pdf, []byte("%PDF-1.4\n")) || !bytes.HasSuffix(pdf, []byte("%%EOF\n")) {
+		t.Fatalf("not a PDF: %q...", pdf[:20])
+	}
+
+	startxref := regexp.MustCompile(`startxref\n(\d+)\n`).FindSubmatch(pdf)
+	if startxref == nil {
+		t.Fatal("no startxref")
+	}
+	xref, _ := strconv.Atoi(string(startxref[1]))
+	if !bytes.HasPrefix(pdf[xref:], []byte("xref\n")) {
+		t.Fatalf("startxref %d does not point at the xref table", xref)
+	}
+	entries := regexp.MustCompile(`(\d{10}) 00000 n `).FindAllSubmatch(pdf[xref:], -1)
+	for i, entry := range entries {
+		offset, _ := strconv.Atoi(string(entry[1]))
+		if want := fmt.Sprintf("%d 0 obj\n", i+1); !bytes.HasPrefix(pdf[offset:], []byte(want)) {
+			t.Errorf("xref entry %d points at %q", i+1, pdf[offset:offset+10])
+		}
+	}
+
+	for _, stream := range regexp.MustCompile(`(?s)<< /Length (\d+) >>\nstream\n(.*?)\nendstream`).FindAllSubmatch(pdf, -1) {
+		if length, _ := strconv.Atoi(string(stream[1])); length != len(stream[2]) {
+			t.Errorf("stream /Length %d, content is %d bytes", length, len(stream[2]))
+		}
+	}
+
+	count := regexp.MustCompile(`/Count (\d+)`).FindSubmatch(pdf)
+	if count == nil {
+		t.Fatal("no page count")
+	}
+	pages, _ := strconv.Atoi(string(count[1]))
+	if objects := len(entries); objects != 4+2*pages {
+		t.Errorf("%d objects for %d pages", objects, pages)
+	}
+	return pages
+}
+
+func TestPDFDocument(t *testing.T) {
+	doc := NewPDFDocument()
+	doc.Text(50, 800, 12, false, "First page")
+	doc.AddPage()
+	doc.Text(50, 800, 12, true, "Second (page)")
+	pdf := doc.Bytes()
+
+	if pages := checkPDFStructure(t, pdf); pages != 2 {
+		t.Errorf("%d pages, want 2", pages)
+	}
+	for _, want := range []string{"/F1 12.0 Tf 50.00 800.00 Td (First page) Tj", "/F2 12.0 Tf 50.00 800.00 Td (Second \\(page\\)) Tj"} {
+		if !bytes.Contains(pdf, []byte(want)) {
+			t.Errorf("PDF does not contain %q", want)
+		}
+	}
+}
+
+func TestPDFEscape(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"plain", "plain"},
+		{`a (b) \c`, `a \(b\) \\c`},
+		{"€1.234,56", `\2001.234,56`},
+		{"¥1,000", `\2451,000`},
+		{"Café", `Caf\351`},
+		{"日本", "??"},
+		{"line\nbreak", "line?break"},
+	}
+	for _, tt := range tests {
+		if got := pdfEscape(tt.in); got != tt.want {
+			t.Errorf("pdfEscape(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestRenderInvoicePDF(t *testing.T) {
+	idr := func(amount int) models.Money { return models.NewMoney(amount, models.BaseCurrency) }
+	invoice := Invoice{
+		Number:     "INV-2026-000042",
+		IssuedAt:   time.Date(2026, 3, 5, 10, 0, 0, 0, time.UTC),
+		Store:      &config.StoreConfig{Name: "Toko Test", Address: "Jl. Test 1", Email: "shop@example.com", TaxID: "NPWP 01"},
+		BuyerName:  "Ani",
+		BuyerEmail: "ani@example.com",
+		ShipTo:     "Jl. Merdeka 1, Bandung",
+		Lines: []InvoiceLine{
+			{Title: "Kettle", Quantity: 2, UnitPrice: idr(15000), Total: idr(30000)},
+			{Title: strings.Repeat("Very long product name ", 10), Quantity: 1, UnitPrice: idr(5000), Total: idr(5000)},
+		},
+		Subtotal: idr(35000),
+		Discount: idr(1000),
+		Shipping: idr(9000),
+		Tax:      idr(3740),
+		TaxLabel: "PPN",
+		TaxRates: []int{1100},
+		Total:    idr(46740),
+		Refunded: idr(0),
+	}
+
+	pdf := RenderInvoicePDF(invoice)
+	if pages := checkPDFStructure(t, pdf); pages != 1 {
+		t.Errorf("%d pages, want 1", pages)
+	}
+	for _, want := range []string{
+		"(Toko Test)", "(INVOICE)", "(INV-2026-000042)", "(05 March 2026)",
+		"(Ani)", "(Ship to: Jl. Merdeka 1, Bandung)",
+		"(Kettle)", "(Rp 15.000)", "(Rp 30.000)",
+		"(Subtotal)", "(Rp 35.000)", "(Discount)", "(-Rp 1.000)", "(Shipping)", "(Rp 9.000)",
+		"(PPN 11%)", "(Rp 3.740)", "(Total)", "(Rp 46.740)",
+		"(Amounts are in IDR. Thank you for shopping at Toko Test.)",
+	} {
+		if !bytes.Contains(pdf, []byte(want)) {
+			t.Errorf("invoice does not contain %q", want)
+		}
+	}
+	long := invoice.Lines[1].Title
+	if bytes.Contains(pdf, []byte(long)) || !regexp.MustCompile(`\(Very long product name[^)]*\.\.\.\)`).Match(pdf) {
+		t.Error("long title is not cut short with an ellipsis")
+	}
+	if truncated := truncateText(long, 260, 10); PDFTextWidth(truncated, 10) > 260 {
+		t.Errorf("truncated title %q is wider than its column", truncated)
+	}
+	if bytes.Contains(pdf, []byte("(Refunded)")) {
+		t.Error("invoice without refunds lists a refunded amount")
+	}
+
+	// Prices that include tax list it under the total instead.
+	invoice.TaxIncluded = true
+	invoice.TaxRates = []int{1100, 1200}
+	invoice.Refunded = idr(5000)
+	pdf = RenderInvoicePDF(invoice)
+	for _, want := range []string{"(PPN included)", "(Refunded)", "(Rp 5.000)"} {
+		if !bytes.Contains(pdf, []byte(want)) {
+			t.Errorf("invoice does not contain %q", want)
+		}
+	}
+	if total, tax := bytes.Index(pdf, []byte("(Total)")), bytes.Index(pdf, []byte("(PPN included)")); total > tax {
+		t.Error("included tax is listed before the total")
+	}
+
+	// Long orders continue on further pages.
+	for len(invoice.Lines) < 80 {
+		invoice.Lines = append(invoice.Lines, invoice.Lines[0])
+	}
+	if pages := checkPDFStructure(t, RenderInvoicePDF(invoice)); pages < 2 {
+		t.Errorf("80 lines fit on %d page", pages)
+	}
+}
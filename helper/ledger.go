@@ -0,0 +1,234 @@
+package helper
+
+import (
+	"errors"
+	"main/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	WalletEntryTopup      = "topup"
+	WalletEntryPurchase   = "purchase"
+	WalletEntryRefund     = "refund"
+	WalletEntryAdjustment = "adjustment"
+)
+
+// Journal accounts. Customer wallets are what the store owes its customers;
+// the others are the store's side of every wallet movement.
+const (
+	AccountCustomerWallets  = "customer_wallets"
+	AccountPaymentsClearing = "payments_clearing" // topups paid through a provider
+	AccountGiftCards        = "gift_cards"        // value of gift cards sold
+	AccountSales            = "sales"
+	AccountRefunds          = "refunds"
+	AccountOpeningBalances  = "opening_balances" // balances from before the ledger
+)
+
+var (
+	ErrInsufficientBalance = errors.New("insufficient balance")
+	ErrUnbalancedJournal   = errors.New("journal lines do not sum to zero")
+)
+
+// PostJournalEntry writes entry with its lines, refusing lines that do not
+// sum to zero.
+func PostJournalEntry(tx *gorm.DB, entry models.JournalEntry) (*models.JournalEntry, error) {
+	sum := 0
+	for _, line := range entry.Lines {
+		sum += line.Amount
+	}
+	if len(entry.Lines) < 2 || sum != 0 {
+		return nil, ErrUnbalancedJournal
+	}
+	if err := tx.Create(&entry).Error; err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+// walletJournalEntry moves amount between the user's wallet and
+// counterAccount: a positive amount credits the wallet and debits the
+// counter account, a negative one the other way round.
+func walletJournalEntry(tx *gorm.DB, userID uint, entryType string, amount int, counterAccount string, referenceType string, referenceID uint, description string) (*models.JournalEntry, error) {
+	return PostJournalEntry(tx, models.JournalEntry{
+		Type:          entryType,
+		ReferenceType: referenceType,
+		ReferenceID:   referenceID,
+		Description:   description,
+		Lines: []models.JournalLine{
+			{Account: counterAccount, Amount: amount},
+			{Account: AccountCustomerWallets, UserID: &userID, Amount: -amount},
+		},
+	})
+}
+
+// PostWalletEntry appends an entry to the user's ledger, posts it to the
+// journal against counterAccount and refreshes the cached User.Balance. It
+// must run inside a database transaction; the user row is locked so
+// concurrent postings for the same user are serialised. Negative amounts
+// debit the wallet and fail with ErrInsufficientBalance when they would take
+// the balance below zero.
+func PostWalletEntry(tx *gorm.DB, userID uint, entryType string, amount int, counterAccount string, referenceType string, referenceID uint, description string) (*models.WalletEntry, error) {
+	var user models.User
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&user, userID).Error; err != nil {
+		return nil, err
+	}
+
+	last, err := lastWalletEntry(tx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if last == nil {
+		if last, err = openWalletLedger(tx, user); err != nil {
+			return nil, err
+		}
+	}
+
+	entry := models.WalletEntry{
+		UserID:        userID,
+		Sequence:      1,
+		Type:          entryType,
+		Amount:        amount,
+		BalanceAfter:  amount,
+		ReferenceType: referenceType,
+		ReferenceID:   referenceID,
+		Description:   description,
+	}
+	if last != nil {
+		entry.Sequence = last.Sequence + 1
+		entry.BalanceAfter = last.BalanceAfter + amount
+	}
+
+	if entry.BalanceAfter < 0 {
+		return nil, ErrInsufficientBalance
+	}
+
+	journal, err := walletJournalEntry(tx, userID, entryType, amount, counterAccount, referenceType, referenceID, description)
+	if err != nil {
+		return nil, err
+	}
+	entry.JournalEntryID = journal.ID
+
+	if err := tx.Create(&entry).Error; err != nil {
+		return nil, err
+	}
+
+	if err := tx.Model(&user).UpdateColumn("balance", entry.BalanceAfter).Error; err != nil {
+		return nil, err
+	}
+
+	return &entry, nil
+}
+
+// OpenWalletLedger records the bare balance of a user created before the
+// ledger existed as an opening adjustment. It does nothing for users that
+// already have entries or a zero balance.
+func OpenWalletLedger(tx *gorm.DB, userID uint) error {
+	var user models.User
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&user, userID).Error; err != nil {
+		return err
+	}
+	last, err := lastWalletEntry(tx, userID)
+	if err != nil || last != nil {
+		return err
+	}
+	_, err = openWalletLedger(tx, user)
+	return err
+}
+
+func openWalletLedger(tx *gorm.DB, user models.User) (*models.WalletEntry, error) {
+	if user.Balance == 0 {
+		return nil, nil
+	}
+	journal, err := walletJournalEntry(tx, user.ID, WalletEntryAdjustment, user.Balance, AccountOpeningBalances, "", 0, "Opening balance")
+	if err != nil {
+		return nil, err
+	}
+	opening := models.WalletEntry{
+		UserID:         user.ID,
+		Sequence:       1,
+		JournalEntryID: journal.ID,
+		Type:           WalletEntryAdjustment,
+		Amount:         user.Balance,
+		BalanceAfter:   user.Balance,
+		Description:    "Opening balance",
+	}
+	if err := tx.Create(&opening).Error; err != nil {
+		return nil, err
+	}
+	return &opening, nil
+}
+
+func lastWalletEntry(db *gorm.DB, userID uint) (*models.WalletEntry, error) {
+	var last models.WalletEntry
+	err := db.Where("user_id = ?", userID).Order("sequence DESC").Limit(1).Find(&last).Error
+	if err != nil {
+		return nil, err
+	}
+	if last.ID == 0 {
+		return nil, nil
+	}
+	return &last, nil
+}
+
+// WalletReport describes how a user's stored balance compares with their ledger.
+type WalletReport struct {
+	UserID        uint
+	StoredBalance int
+	LedgerBalance int
+	// JournalBalance is what the journal says the store owes the user.
+	JournalBalance int
+	Entries        int
+	// BrokenSequence is the first entry whose BalanceAfter does not follow
+	// from the entry before it, or 0 when the chain is intact.
+	BrokenSequence int
+}
+
+func (r WalletReport) Drifted() bool {
+	return r.StoredBalance != r.LedgerBalance || r.JournalBalance != r.LedgerBalance || r.BrokenSequence != 0
+}
+
+// VerifyWallet replays a user's ledger and compares it with User.Balance.
+func VerifyWallet(db *gorm.DB, user models.User) (WalletReport, error) {
+	report := WalletReport{UserID: user.ID, StoredBalance: user.Balance}
+
+	var entries []models.WalletEntry
+	if err := db.Where("user_id = ?", user.ID).Order("sequence ASC").Find(&entries).Error; err != nil {
+		return report, err
+	}
+
+	running := 0
+	for i, entry := range entries {
+		running += entry.Amount
+		if report.BrokenSequence == 0 && (entry.BalanceAfter != running || entry.Sequence != i+1) {
+			report.BrokenSequence = entry.Sequence
+		}
+	}
+	report.LedgerBalance = running
+	report.Entries = len(entries)
+
+	// The wallet account is credited with what the user is owed
+	var journal int
+	err := db.Model(&models.JournalLine{}).
+		Select("COALESCE(SUM(amount), 0)").
+		Where("account = ? AND user_id = ?", AccountCustomerWallets, user.ID).
+		Scan(&journal).Error
+	if err != nil {
+		return report, err
+	}
+	report.JournalBalance = -journal
+
+	return report, nil
+}
+
+// UnbalancedJournalEntries returns the IDs of journal entries whose lines do
+// not sum to zero, which PostJournalEntry should never let happen.
+func UnbalancedJournalEntries(db *gorm.DB) ([]uint, error) {
+	var ids []uint
+	err := db.Model(&models.JournalLine{}).
+		Group("journal_entry_id").
+		Having("SUM(amount) <> 0").
+		Pluck("journal_entry_id", &ids).Error
+	return ids, err
+}
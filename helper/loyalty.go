@@ -0,0 +1,256 @@
+package helper
+
+import (
+	"errors"
+	"main/models"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	PointsEarn     = "earn"
+	PointsRedeem   = "redeem"
+	PointsExpire   = "expire"
+	PointsReversal = "reversal" // points earned on a purchase that was refunded
+	PointsReturn   = "return"   // points spent on an order that was cancelled or refunded
+)
+
+var (
+	ErrInsufficientPoints = errors.New("insufficient points")
+	ErrPointsLimit        = errors.New("points cannot pay for that much of the purchase")
+)
+
+// lockPoints locks the user row, which serialises every change to their
+// points and wallet, and expires their lots that ran out before now.
+func lockPoints(tx *gorm.DB, userID uint, now time.Time) (*models.User, error) {
+	var user models.User
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&user, userID).Error; err != nil {
+		return nil, err
+	}
+	if err := expireUserPoints(tx, &user, now); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// appendPointEntry adds entry to the ledger of the locked user and refreshes
+// the cached User.Points. Positive entries with an expiry become lots.
+func appendPointEntry(tx *gorm.DB, user *models.User, entry models.PointEntry) (*models.PointEntry, error) {
+	var last models.PointEntry
+	if err := tx.Where("user_id = ?", user.ID).Order("sequence DESC").Limit(1).Find(&last).Error; err != nil {
+		return nil, err
+	}
+
+	entry.UserID = user.ID
+	entry.Sequence = last.Sequence + 1
+	entry.BalanceAfter = last.BalanceAfter + entry.Points
+	if entry.BalanceAfter < 0 {
+		return nil, ErrInsufficientPoints
+	}
+	if entry.Points > 0 && entry.ExpiresAt != nil {
+		entry.Remaining = entry.Points
+	}
+	if err := tx.Create(&entry).Error; err != nil {
+		return nil, err
+	}
+
+	if err := tx.Model(user).UpdateColumn("points", entry.BalanceAfter).Error; err != nil {
+		return nil, err
+	}
+	user.Points = entry.BalanceAfter
+	return &entry, nil
+}
+
+// spendPoints takes the points of a negative entry from the user's lots,
+// soonest to expire first.
+func spendPoints(tx *gorm.DB, entry *models.PointEntry) error {
+	var lots []models.PointEntry
+	err := tx.Where("user_id = ? AND remaining > 0", entry.UserID).Order("expires_at, id").Find(&lots).Error
+	if err != nil {
+		return err
+	}
+
+	left := -entry.Points
+	for _, lot := range lots {
+		if left == 0 {
+			break
+		}
+		take := lot.Remaining
+		if take > left {
+			take = left
+		}
+		if err := tx.Model(&lot).UpdateColumn("remaining", gorm.Expr("remaining - ?", take)).Error; err != nil {
+			return err
+		}
+		allocation := models.PointAllocation{EntryID: entry.ID, LotID: lot.ID, Points: take}
+		if err := tx.Create(&allocation).Error; err != nil {
+			return err
+		}
+		left -= take
+	}
+	return nil
+}
+
+func expireUserPoints(tx *gorm.DB, user *models.User, now time.Time) error {
+	var lots []models.PointEntry
+	err := tx.Where("user_id = ? AND remaining > 0 AND expires_at <= ?", user.ID, now).Find(&lots).Error
+	if err != nil || len(lots) == 0 {
+		return err
+	}
+
+	expired := 0
+	for _, lot := range lots {
+		expired += lot.Remaining
+		if err := tx.Model(&lot).UpdateColumn("remaining", 0).Error; err != nil {
+			return err
+		}
+	}
+	_, err = appendPointEntry(tx, user, models.PointEntry{
+		Type:        PointsExpire,
+		Points:      -expired,
+		Description: "Points expired",
+	})
+	return err
+}
+
+// EarnPoints credits points to the user, expiring at expiresAt.
+func EarnPoints(tx *gorm.DB, userID uint, points int, expiresAt time.Time, referenceType string, referenceID uint, description string) error {
+	if points <= 0 {
+		return nil
+	}
+	user, err := lockPoints(tx, userID, time.Now())
+	if err != nil {
+		return err
+	}
+	_, err = appendPointEntry(tx, user, models.PointEntry{
+		Type:          PointsEarn,
+		Points:        points,
+		ExpiresAt:     &expiresAt,
+		ReferenceType: referenceType,
+		ReferenceID:   referenceID,
+		Description:   description,
+	})
+	return err
+}
+
+// RedeemPoints spends points of the user, failing with ErrInsufficientPoints
+// when they do not have that many.
+func RedeemPoints(tx *gorm.DB, userID uint, points int, referenceType string, referenceID uint, description string) error {
+	user, err := lockPoints(tx, userID, time.Now())
+	if err != nil {
+		return err
+	}
+	entry, err := appendPointEntry(tx, user, models.PointEntry{
+		Type:          PointsRedeem,
+		Points:        -points,
+		ReferenceType: referenceType,
+		ReferenceID:   referenceID,
+		Description:   description,
+	})
+	if err != nil {
+		return err
+	}
+	return spendPoints(tx, entry)
+}
+
+// reversePoints takes back points earned on a purchase that was refunded.
+// Points the user has already spent or lost to expiry cannot be taken back.
+func reversePoints(tx *gorm.DB, userID uint, points int, referenceType string, referenceID uint, description string) error {
+	user, err := lockPoints(tx, userID, time.Now())
+	if err != nil {
+		return err
+	}
+	if points > user.Points {
+		points = user.Points
+	}
+	if points <= 0 {
+		return nil
+	}
+	entry, err := appendPointEntry(tx, user, models.PointEntry{
+		Type:          PointsReversal,
+		Points:        -points,
+		ReferenceType: referenceType,
+		ReferenceID:   referenceID,
+		Description:   description,
+	})
+	if err != nil {
+		return err
+	}
+	return spendPoints(tx, entry)
+}
+
+// returnOrderPoints gives back the points spent on an order, to the lots they
+// came from. Lots that expired in the meantime expire again straight away.
+func returnOrderPoints(tx *gorm.DB, order models.Order) error {
+	if order.PointsUsed == 0 {
+		return nil
+	}
+	now := time.Now()
+	user, err := lockPoints(tx, order.UserID, now)
+	if err != nil {
+		return err
+	}
+
+	var redeemed models.PointEntry
+	err = tx.Where("user_id = ? AND type = ? AND reference_type = ? AND reference_id = ?", order.UserID, PointsRedeem, "order", order.ID).
+		First(&redeemed).Error
+	if err != nil {
+		return err
+	}
+
+	var allocations []models.PointAllocation
+	if err := tx.Where("entry_id = ?", redeemed.ID).Find(&allocations).Error; err != nil {
+		return err
+	}
+
+	_, err = appendPointEntry(tx, user, models.PointEntry{
+		Type:          PointsReturn,
+		Points:        -redeemed.Points,
+		ReferenceType: "order",
+		ReferenceID:   order.ID,
+		Description:   "Points returned from a cancelled or refunded order",
+	})
+	if err != nil {
+		return err
+	}
+	for _, allocation := range allocations {
+		err := tx.Model(&models.PointEntry{}).
+			Where("id = ?", allocation.LotID).
+			UpdateColumn("remaining", gorm.Expr("remaining + ?", allocation.Points)).Error
+		if err != nil {
+			return err
+		}
+	}
+	return expireUserPoints(tx, user, now)
+}
+
+// ExpireUserPoints expires the user's lots that ran out before now inside tx
+// and returns the user with their remaining points.
+func ExpireUserPoints(tx *gorm.DB, userID uint, now time.Time) (*models.User, error) {
+	return lockPoints(tx, userID, now)
+}
+
+// ExpirePoints expires the lots of every user that ran out before now. Each
+// user is handled in their own transaction.
+func ExpirePoints(db *gorm.DB, now time.Time) error {
+	var userIDs []uint
+	err := db.Model(&models.PointEntry{}).
+		Where("remaining > 0 AND expires_at <= ?", now).
+		Distinct().Pluck("user_id", &userIDs).Error
+	if err != nil {
+		return err
+	}
+
+	for _, userID := range userIDs {
+		err := db.Transaction(func(tx *gorm.DB) error {
+			_, err := ExpireUserPoints(tx, userID, now)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package helper
+
+import (
+	"main/models"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+func TestPointLots(t *testing.T) {
+	db := openTestDB(t)
+	user := createTestUser(t, db, "points@example.com", 0)
+	now := time.Now()
+
+	inTx := func(fn func(tx *gorm.DB) error) {
+		t.Helper()
+		if err := db.Transaction(fn); err != nil {
+			t.Fatal(err)
+		}
+	}
+	lot := func(description string) models.PointEntry {
+		t.Helper()
+		var entry models.PointEntry
+		if err := db.Where("user_id = ? AND description = ?", user.ID, description).First(&entry).Error; err != nil {
+			t.Fatal(err)
+		}
+		return entry
+	}
+	points := func() int {
+		t.Helper()
+		var fresh models.User
+		if err := db.First(&fresh, user.ID).Error; err != nil {
+			t.Fatal(err)
+		}
+		return fresh.Points
+	}
+
+	inTx(func(tx *gorm.DB) error {
+		return EarnPoints(tx, user.ID, 100, now.Add(10*24*time.Hour), "order", 1, "late")
+	})
+	inTx(func(tx *gorm.DB) error {
+		return EarnPoints(tx, user.ID, 50, now.Add(5*24*time.Hour), "order", 2, "early")
+	})
+
+	// Spending takes from the lot that expires first
+	order := models.Order{UserID: user.ID, PointsUsed: 80}
+	if err := db.Create(&order).Error; err != nil {
+		t.Fatal(err)
+	}
+	inTx(func(tx *gorm.DB) error {
+		return RedeemPoints(tx, user.ID, 80, "order", order.ID, "Redeemed")
+	})
+	if early, late := lot("early"), lot("late"); early.Remaining != 0 || late.Remaining != 70 {
+		t.Errorf("remaining after redeeming = %d early, %d late, want 0, 70", early.Remaining, late.Remaining)
+	}
+	var allocations []models.PointAllocation
+	if err := db.Order("id").Find(&allocations).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(allocations) != 2 || allocations[0].LotID != lot("early").ID || allocations[0].Points != 50 ||
+		allocations[1].LotID != lot("late").ID || allocations[1].Points != 30 {
+		t.Errorf("allocations = %+v, want 50 from the early lot and 30 from the late one", allocations)
+	}
+	if got := points(); got != 70 {
+		t.Errorf("points = %d, want 70", got)
+	}
+
+	inTx(func(tx *gorm.DB) error {
+		err := RedeemPoints(tx, user.ID, 71, "order", 0, "Too many")
+		if err != ErrInsufficientPoints {
+			t.Errorf("redeeming more than the balance: err = %v, want ErrInsufficientPoints", err)
+		}
+		return nil
+	})
+
+	// Cancelling the order puts the points back into the lots they came from
+	inTx(func(tx *gorm.DB) error { return returnOrderPoints(tx, order) })
+	if early, late := lot("early"), lot("late"); early.Remaining != 50 || late.Remaining != 100 {
+		t.Errorf("remaining after returning = %d early, %d late, want 50, 100", early.Remaining, late.Remaining)
+	}
+	if got := points(); got != 150 {
+		t.Errorf("points = %d, want 150", got)
+	}
+
+	// Refunds take back what is left, never more than the balance
+	inTx(func(tx *gorm.DB) error { return reversePoints(tx, user.ID, 20, "refund", 1, "Reversed") })
+	if early := lot("early"); early.Remaining != 30 {
+		t.Errorf("early lot remaining after reversal = %d, want 30", early.Remaining)
+	}
+
+	// The early lot runs out first, then the late one
+	if err := ExpirePoints(db, now.Add(6*24*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if got := points(); got != 100 {
+		t.Errorf("points after the early lot expired = %d, want 100", got)
+	}
+	if err := ExpirePoints(db, now.Add(11*24*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if got := points(); got != 0 {
+		t.Errorf("points after every lot expired = %d, want 0", got)
+	}
+	inTx(func(tx *gorm.DB) error { return reversePoints(tx, user.ID, 20, "refund", 2, "Nothing left") })
+	if got := points(); got != 0 {
+		t.Errorf("points after reversing with none left = %d, want 0", got)
+	}
+
+	var entries []models.PointEntry
+	if err := db.Where("user_id = ?", user.ID).Order("sequence").Find(&entries).Error; err != nil {
+		t.Fatal(err)
+	}
+	balance := 0
+	for i, entry := range entries {
+		balance += entry.Points
+		if entry.Sequence != i+1 || entry.BalanceAfter != balance {
+			t.Errorf("entry %d: sequence %d balance after %d, want %d and %d", entry.ID, entry.Sequence, entry.BalanceAfter, i+1, balance)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package helper
+
+import (
+	"fmt"
+	"log"
+	"main/config"
+	"net"
+	"net/smtp"
+	"strings"
+)
+
+// Mailer delivers emails to customers.
+type Mailer interface {
+	Send(to, subject, body string) error
+}
+
+func NewMailer(cfg *config.MailConfig) (Mailer, error) {
+	switch cfg.Provider {
+	case "smtp":
+		if cfg.SMTPAddr == "" || cfg.From == "" {
+			return nil, fmt.Errorf("smtp mailer needs an address and a from address")
+		}
+		return &SMTPMailer{config: cfg}, nil
+	case "noop":
+		return NoopMailer{}, nil
+	}
+	return nil, fmt.Errorf("unknown mail provider %q", cfg.Provider)
+}
+
+// NoopMailer drops every email, for development. Only the recipient and
+// subject are logged since bodies may hold secrets such as reset tokens.
+type NoopMailer struct{}
+
+func (NoopMailer) Send(to, subject, body string) error {
+	log.Printf("Not sending email %q to %s, mail is disabled", subject, to)
+	return nil
+}
+
+type SMTPMailer struct {
+	config *config.MailConfig
+}
+
+func (m *SMTPMailer) Send(to, subject, body string) error {
+	var auth smtp.Auth
+	if m.config.Username != "" {
+		host, _, err := net.SplitHostPort(m.config.SMTPAddr)
+		if err != nil {
+			return err
+		}
+		auth = smtp.PlainAuth("", m.config.Username, m.config.Password, host)
+	}
+
+	// Header injection is ruled out by refusing line breaks in the headers
+	if strings.ContainsAny(to+subject, "\r\n") {
+		return fmt.Errorf("invalid email header")
+	}
+	message := "From: " + m.config.From + "\r\n" +
+		"To: " + to + "\r\n" +
+		"Subject: " + subject + "\r\n" +
+		"Content-Type: text/plain; charset=UTF-8\r\n" +
+		"\r\n" + body
+	return smtp.SendMail(m.config.SMTPAddr, auth, m.config.From, []string{to}, []byte(message))
+}
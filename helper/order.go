@@ -0,0 +1,227 @@
+package helper
+
+import (
+	"errors"
+	"fmt"
+	"main/models"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	OrderPending     = "pending"
+	OrderPaid        = "paid"
+	OrderBackordered = "backordered" // paid, waiting for stock of backordered items
+	OrderProcessing  = "processing"
+	OrderShipped     = "shipped"
+	OrderDelivered   = "delivered"
+	OrderCancelled   = "cancelled"
+	OrderRefunded    = "refunded"
+)
+
+var (
+	ErrOrderNotFound          = errors.New("order not found")
+	ErrInvalidOrderTransition = errors.New("order cannot move to that status")
+)
+
+// orderTransitions lists the statuses each status may move to. Cancelled and
+// refunded orders are final.
+var orderTransitions = map[string][]string{
+	OrderPending:     {OrderPaid, OrderBackordered, OrderCancelled},
+	OrderBackordered: {OrderCancelled, OrderRefunded},
+	OrderPaid:        {OrderProcessing, OrderCancelled, OrderRefunded},
+	OrderProcessing:  {OrderShipped, OrderCancelled, OrderRefunded},
+	OrderShipped:     {OrderDelivered, OrderRefunded},
+	OrderDelivered:   {OrderRefunded},
+}
+
+// allocationTransitions are only made once stock has been allocated to every
+// backordered purchase of an order, never on request.
+var allocationTransitions = map[string][]string{
+	OrderBackordered: {OrderPaid},
+}
+
+// CanTransitionOrder reports whether the transition table allows an order in
+// status from to move to status to.
+func CanTransitionOrder(from, to string) bool {
+	return canTransition(orderTransitions, from, to)
+}
+
+func canTransition(transitions map[string][]string, from, to string) bool {
+	for _, allowed := range transitions[from] {
+		if allowed == to {
+			return true
+		}
+	}
+	return false
+}
+
+// TransitionOrder moves the order to a new status inside tx, stamps the
+// matching timestamp and records the change in the order's status history.
+func TransitionOrder(tx *gorm.DB, orderID uint, to string, changedBy uint, note string) (*models.Order, error) {
+	return transitionOrder(tx, orderID, to, changedBy, note, nil)
+}
+
+// transitionOrder is TransitionOrder also allowing the transitions in extra.
+func transitionOrder(tx *gorm.DB, orderID uint, to string, changedBy uint, note string, extra map[string][]string) (*models.Order, error) {
+	var order models.Order
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&order, orderID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrOrderNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if !CanTransitionOrder(order.Status, to) && !canTransition(extra, order.Status, to) {
+		return nil, ErrInvalidOrderTransition
+	}
+
+	// Updates writes the new status into order, keep the old one for the history
+	from := order.Status
+	now := time.Now()
+	updates := map[string]interface{}{"status": to}
+	switch to {
+	case OrderPaid:
+		// Backordered orders were paid when they were placed
+		if order.PaidAt == nil {
+			updates["paid_at"] = now
+		}
+	case OrderBackordered:
+		updates["paid_at"] = now
+	case OrderProcessing:
+		updates["processing_at"] = now
+	case OrderShipped:
+		updates["shipped_at"] = now
+	case OrderDelivered:
+		updates["delivered_at"] = now
+	case OrderCancelled:
+		updates["cancelled_at"] = now
+	case OrderRefunded:
+		updates["refunded_at"] = now
+	}
+	if err := tx.Model(&order).Updates(updates).Error; err != nil {
+		return nil, err
+	}
+
+	change := models.OrderStatusChange{
+		OrderID:    order.ID,
+		FromStatus: from,
+		ToStatus:   to,
+		ChangedBy:  changedBy,
+		Note:       note,
+	}
+	if err := tx.Create(&change).Error; err != nil {
+		return nil, err
+	}
+
+	order.Status = to
+	return &order, nil
+}
+
+// refundOrderIfSettled moves an order to refunded once every one of its
+// purchases has been refunded in full.
+func refundOrderIfSettled(tx *gorm.DB, orderID uint, changedBy uint) error {
+	var open int64
+	err := tx.Model(&models.TransactionHistory{}).
+		Where("order_id = ? AND refunded_quantity < quantity", orderID).
+		Count(&open).Error
+	if err != nil || open > 0 {
+		return err
+	}
+
+	var order models.Order
+	if err := tx.First(&order, orderID).Error; err != nil {
+		return err
+	}
+	if !CanTransitionOrder(order.Status, OrderRefunded) {
+		return nil
+	}
+	if err := refundShipping(tx, order); err != nil {
+		return err
+	}
+	if err := releaseCoupon(tx, order); err != nil {
+		return err
+	}
+	if err := returnOrderPoints(tx, order); err != nil {
+		return err
+	}
+	_, err = TransitionOrder(tx, orderID, OrderRefunded, changedBy, "All items refunded")
+	return err
+}
+
+// CancelOrder cancels an order that has not shipped yet inside tx. Whatever
+// has not been refunded already is returned to stock and credited back to the
+// customer before the order moves to cancelled.
+func CancelOrder(tx *gorm.DB, orderID uint, cancelledBy uint, reason string) (*models.Order, error) {
+	// The products are locked before the order, the same order backorder
+	// allocation locks them in, so a cancellation and a restock of one of
+	// its products cannot deadlock.
+	var productIDs []uint
+	err := tx.Model(&models.TransactionHistory{}).
+		Where("order_id = ?", orderID).
+		Distinct().Order("product_id").
+		Pluck("product_id", &productIDs).Error
+	if err != nil {
+		return nil, err
+	}
+	if len(productIDs) > 0 {
+		var products []models.Product
+		err := tx.Unscoped().Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id IN ?", productIDs).
+			Order("id").
+			Find(&products).Error
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var order models.Order
+	err = tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&order, orderID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrOrderNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !CanTransitionOrder(order.Status, OrderCancelled) {
+		return nil, ErrInvalidOrderTransition
+	}
+
+	var transactions []models.TransactionHistory
+	err = tx.Where("order_id = ? AND refunded_quantity < quantity", orderID).Order("id").Find(&transactions).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, transaction := range transactions {
+		if _, err := refundTransaction(tx, transaction.ID, 0, cancelledBy, "Order cancelled: "+reason, false); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := refundShipping(tx, order); err != nil {
+		return nil, err
+	}
+	if err := releaseCoupon(tx, order); err != nil {
+		return nil, err
+	}
+	if err := returnOrderPoints(tx, order); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Model(&order).Update("cancel_reason", reason).Error; err != nil {
+		return nil, err
+	}
+	return TransitionOrder(tx, orderID, OrderCancelled, cancelledBy, reason)
+}
+
+// refundShipping credits the shipping paid for order back to the customer.
+func refundShipping(tx *gorm.DB, order models.Order) error {
+	if order.ShippingCost <= 0 {
+		return nil
+	}
+	_, err := PostWalletEntry(tx, order.UserID, WalletEntryRefund, order.ShippingCost, AccountRefunds, "order", order.ID, fmt.Sprintf("Shipping refund for order %d", order.ID))
+	return err
+}
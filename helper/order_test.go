@@ -0,0 +1,124 @@
+package helper
+
+import (
+	"errors"
+	"main/models"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+func TestCanTransitionOrder(t *testing.T) {
+	tests := []struct {
+		from, to string
+		want     bool
+	}{
+		{OrderPending, OrderPaid, true},
+		{OrderPending, OrderBackordered, true},
+		{OrderPending, OrderShipped, false},
+		{OrderPaid, OrderProcessing, true},
+		{OrderPaid, OrderShipped, false},
+		{OrderPaid, OrderPending, false},
+		{OrderProcessing, OrderShipped, true},
+		{OrderProcessing, OrderCancelled, true},
+		{OrderShipped, OrderDelivered, true},
+		{OrderShipped, OrderCancelled, false},
+		{OrderDelivered, OrderRefunded, true},
+		{OrderDelivered, OrderCancelled, false},
+		{OrderBackordered, OrderCancelled, true},
+		{OrderBackordered, OrderPaid, false},
+		{OrderBackordered, OrderProcessing, false},
+		{OrderCancelled, OrderPaid, false},
+		{OrderCancelled, OrderRefunded, false},
+		{OrderRefunded, OrderPaid, false},
+		{OrderPaid, "lost", false},
+	}
+	for _, tt := range tests {
+		if got := CanTransitionOrder(tt.from, tt.to); got != tt.want {
+			t.Errorf("CanTransitionOrder(%q, %q) = %v, want %v", tt.from, tt.to, got, tt.want)
+		}
+	}
+}
+
+func TestTransitionOrder(t *testing.T) {
+	db := openTestDB(t)
+	user := createTestUser(t, db, "orders@example.com", 0)
+	order := models.Order{UserID: user.ID, Status: OrderPaid}
+	if err := db.Create(&order).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	transition := func(to string) error {
+		return db.Transaction(func(tx *gorm.DB) error {
+			_, err := TransitionOrder(tx, order.ID, to, user.ID, "to "+to)
+			return err
+		})
+	}
+
+	for _, to := range []string{OrderProcessing, OrderShipped, OrderDelivered} {
+		if err := transition(to); err != nil {
+			t.Fatalf("moving to %s: %v", to, err)
+		}
+	}
+	if err := transition(OrderCancelled); !errors.Is(err, ErrInvalidOrderTransition) {
+		t.Errorf("cancelling a delivered order: %v, want ErrInvalidOrderTransition", err)
+	}
+
+	if err := db.First(&order, order.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if order.Status != OrderDelivered {
+		t.Errorf("status = %q, want delivered", order.Status)
+	}
+	if order.ProcessingAt == nil || order.ShippedAt == nil || order.DeliveredAt == nil || order.CancelledAt != nil {
+		t.Errorf("timestamps = processing %v, shipped %v, delivered %v, cancelled %v",
+			order.ProcessingAt, order.ShippedAt, order.DeliveredAt, order.CancelledAt)
+	}
+
+	var changes []models.OrderStatusChange
+	if err := db.Where("order_id = ?", order.ID).Order("id").Find(&changes).Error; err != nil {
+		t.Fatal(err)
+	}
+	want := [][2]string{{OrderPaid, OrderProcessing}, {OrderProcessing, OrderShipped}, {OrderShipped, OrderDelivered}}
+	if len(changes) != len(want) {
+		t.Fatalf("%d status changes recorded, want %d", len(changes), len(want))
+	}
+	for i, change := range changes {
+		if change.FromStatus != want[i][0] || change.ToStatus != want[i][1] || change.ChangedBy != user.ID || change.Note != "to "+want[i][1] {
+			t.Errorf("change %d = %+v, want %s -> %s", i, change, want[i][0], want[i][1])
+		}
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		_, err := TransitionOrder(tx, order.ID+1, OrderPaid, user.ID, "")
+		return err
+	})
+	if !errors.Is(err, ErrOrderNotFound) {
+		t.Errorf("missing order: %v, want ErrOrderNotFound", err)
+	}
+}
+
+func TestBackorderedOrderOnlyPaidByAllocation(t *testing.T) {
+	db := openTestDB(t)
+	user := createTestUser(t, db, "orders@example.com", 0)
+	order := models.Order{UserID: user.ID, Status: OrderBackordered}
+	if err := db.Create(&order).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		_, err := TransitionOrder(tx, order.ID, OrderPaid, user.ID, "")
+		return err
+	})
+	if !errors.Is(err, ErrInvalidOrderTransition) {
+		t.Fatalf("paying a backordered order on request: %v, want ErrInvalidOrderTransition", err)
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		_, err := transitionOrder(tx, order.ID, OrderPaid, 0, "", allocationTransitions)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("allocation moving the order to paid: %v", err)
+	}
+}
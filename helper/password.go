@@ -0,0 +1,120 @@
+package helper
+
+import (
+	"bufio"
+	_ "embed"
+	"fmt"
+	"io"
+	"main/config"
+	"os"
+	"strings"
+	"unicode"
+)
+
+//go:embed common_passwords.txt
+var bundledCommonPasswords string
+
+// PasswordPolicy checks new passwords against the configured rules and a list
+// of common or breached passwords.
+type PasswordPolicy struct {
+	config  *config.PasswordPolicyConfig
+	blocked map[string]struct{}
+}
+
+func NewPasswordPolicy(cfg *config.PasswordPolicyConfig) (*PasswordPolicy, error) {
+	policy := &PasswordPolicy{config: cfg, blocked: map[string]struct{}{}}
+	if err := policy.loadBlocked(strings.NewReader(bundledCommonPasswords)); err != nil {
+		return nil, fmt.Errorf("read common passwords: %w", err)
+	}
+
+	if cfg.BreachedPasswordsFile != "" {
+		file, err := os.Open(cfg.BreachedPasswordsFile)
+		if err != nil {
+			return nil, fmt.Errorf("open breached passwords file: %w", err)
+		}
+		defer file.Close()
+		if err := policy.loadBlocked(file); err != nil {
+			return nil, fmt.Errorf("read breached passwords file: %w", err)
+		}
+	}
+	return policy, nil
+}
+
+func (p *PasswordPolicy) loadBlocked(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		word := strings.ToLower(strings.TrimSpace(scanner.Text()))
+		if word != "" {
+			p.blocked[word] = struct{}{}
+		}
+	}
+	return scanner.Err()
+}
+
+// Check returns the list of rules the password breaks, or nil when it is
+// acceptable. Email and full name are used to reject passwords built from
+// the user's own details.
+func (p *PasswordPolicy) Check(password, email, fullName string) []string {
+	var problems []string
+
+	length := len([]rune(password))
+	if length < p.config.MinLength {
+		problems = append(problems, fmt.Sprintf("Password must be at least %d characters long", p.config.MinLength))
+	}
+	if p.config.MaxLength > 0 && len(password) > p.config.MaxLength {
+		problems = append(problems, fmt.Sprintf("Password must be at most %d characters long", p.config.MaxLength))
+	}
+
+	var hasUpper, hasLower, hasDigit, hasSymbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			hasUpper = true
+		case unicode.IsLower(r):
+			hasLower = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r):
+			hasSymbol = true
+		}
+	}
+	if p.config.RequireUpper && !hasUpper {
+		problems = append(problems, "Password must contain an uppercase letter")
+	}
+	if p.config.RequireLower && !hasLower {
+		problems = append(problems, "Password must contain a lowercase letter")
+	}
+	if p.config.RequireDigit && !hasDigit {
+		problems = append(problems, "Password must contain a digit")
+	}
+	if p.config.RequireSymbol && !hasSymbol {
+		problems = append(problems, "Password must contain a symbol")
+	}
+
+	lowered := strings.ToLower(password)
+	if containsPersonalInfo(lowered, email, fullName) {
+		problems = append(problems, "Password must not contain your email or name")
+	}
+	if _, found := p.blocked[lowered]; found {
+		problems = append(problems, "Password is too common or has appeared in a data breach")
+	}
+
+	return problems
+}
+
+func containsPersonalInfo(lowered, email, fullName string) bool {
+	email = strings.ToLower(strings.TrimSpace(email))
+	parts := []string{email}
+	if at := strings.Index(email, "@"); at > 0 {
+		parts = append(parts, email[:at])
+	}
+	parts = append(parts, strings.Fields(strings.ToLower(fullName))...)
+
+	for _, part := range parts {
+		// Very short fragments such as initials would reject too many passwords.
+		if len(part) >= 3 && strings.Contains(lowered, part) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,102 @@
+package helper
+
+import (
+	"main/config"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestPasswordPolicyCheck(t *testing.T) {
+	breached := filepath.Join(t.TempDir(), "breached.txt")
+	if err := os.WriteFile(breached, []byte("Leaked-Secret9\n\n  Another1Leak  \n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	policy, err := NewPasswordPolicy(&config.PasswordPolicyConfig{
+		MinLength:             8,
+		MaxLength:             16,
+		RequireUpper:          true,
+		RequireLower:          true,
+		RequireDigit:          true,
+		RequireSymbol:         true,
+		BreachedPasswordsFile: breached,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		password string
+		want     []string
+	}{
+		{"acceptable", "Tr0ub4dor&x", nil},
+		{"exactly the minimum length", "Ab1!efgh", nil},
+		{"too short", "Ab1!efg", []string{"Password must be at least 8 characters long"}},
+		{"short counts runes", "Ab1!éfg", []string{"Password must be at least 8 characters long"}},
+		{"exactly the maximum length", "Ab1!efghijklmnop", nil},
+		{"too long", "Ab1!efghijklmnopq", []string{"Password must be at most 16 characters long"}},
+		{"long counts bytes", "Ab1!éééééééééééé", []string{"Password must be at most 16 characters long"}},
+		{"no uppercase", "ab1!efgh", []string{"Password must contain an uppercase letter"}},
+		{"no lowercase", "AB1!EFGH", []string{"Password must contain a lowercase letter"}},
+		{"no digit", "Abc!efgh", []string{"Password must contain a digit"}},
+		{"no symbol", "Ab1defgh", []string{"Password must contain a symbol"}},
+		{"every rule", "", []string{
+			"Password must be at least 8 characters long",
+			"Password must contain an uppercase letter",
+			"Password must contain a lowercase letter",
+			"Password must contain a digit",
+			"Password must contain a symbol",
+		}},
+		{"email local part", "Jane.doe1!x", []string{"Password must not contain your email or name"}},
+		{"name", "Ab1!Smithy", []string{"Password must not contain your email or name"}},
+		{"bundled common password", "password", []string{
+			"Password must contain an uppercase letter",
+			"Password must contain a digit",
+			"Password must contain a symbol",
+			"Password is too common or has appeared in a data breach",
+		}},
+		{"breached password file", "leaked-secret9", []string{
+			"Password must contain an uppercase letter",
+			"Password is too common or has appeared in a data breach",
+		}},
+		{"breached password ignores case", "LEAKED-SECRET9", []string{
+			"Password must contain a lowercase letter",
+			"Password is too common or has appeared in a data breach",
+		}},
+		{"breached password file is trimmed", "Another1Leak", []string{
+			"Password must contain a symbol",
+			"Password is too common or has appeared in a data breach",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := policy.Check(tt.password, "jane.doe@example.com", "Jane Smith")
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Check(%q) = %q, want %q", tt.password, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPasswordPolicyOptionalRules(t *testing.T) {
+	policy, err := NewPasswordPolicy(&config.PasswordPolicyConfig{MinLength: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	long := "correct horse battery staple and then some more words past any limit"
+	if got := policy.Check(long, "", ""); got != nil {
+		t.Errorf("Check without class rules or a maximum = %q, want nil", got)
+	}
+	if got := policy.Check("ab", "", ""); !reflect.DeepEqual(got, []string{"Password must be at least 4 characters long"}) {
+		t.Errorf("Check(%q) = %q", "ab", got)
+	}
+}
+
+func TestNewPasswordPolicyMissingFile(t *testing.T) {
+	_, err := NewPasswordPolicy(&config.PasswordPolicyConfig{BreachedPasswordsFile: filepath.Join(t.TempDir(), "missing.txt")})
+	if err == nil {
+		t.Error("NewPasswordPolicy with a missing breached passwords file succeeded")
+	}
+}
@@ -0,0 +1,164 @@
+package helper
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"main/config"
+	"main/models"
+	"net/http"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	PaymentPending = "pending"
+	PaymentSettled = "settled"
+	PaymentFailed  = "failed"
+	PaymentExpired = "expired"
+)
+
+var (
+	ErrInvalidWebhookSignature = errors.New("invalid webhook signature")
+	ErrUnknownPaymentStatus    = errors.New("unknown payment status")
+)
+
+// ProviderPayment is what a provider hands back when a payment is opened.
+type ProviderPayment struct {
+	ExternalID string
+	PaymentURL string
+}
+
+// PaymentEvent is a verified status change reported by a provider webhook.
+type PaymentEvent struct {
+	ExternalID string
+	Status     string
+	Reason     string
+}
+
+// PaymentProvider is implemented by every payment gateway topups can go through.
+type PaymentProvider interface {
+	Name() string
+	CreatePayment(intent models.PaymentIntent) (ProviderPayment, error)
+	// ParseWebhook verifies the signature of a webhook request and decodes it.
+	ParseWebhook(header http.Header, body []byte) (PaymentEvent, error)
+}
+
+func NewPaymentProvider(cfg *config.PaymentConfig) (PaymentProvider, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	switch cfg.Provider {
+	case "mock":
+		return &MockPaymentProvider{secret: []byte(cfg.MockWebhookSecret)}, nil
+	}
+	return nil, fmt.Errorf("unknown payment provider %q", cfg.Provider)
+}
+
+const MockSignatureHeader = "X-Mock-Signature"
+
+// MockPaymentProvider settles nothing by itself. Payments are completed by
+// posting a webhook signed with the shared secret, see cmd/mockpay.
+type MockPaymentProvider struct {
+	secret []byte
+}
+
+func (p *MockPaymentProvider) Name() string {
+	return "mock"
+}
+
+func (p *MockPaymentProvider) CreatePayment(intent models.PaymentIntent) (ProviderPayment, error) {
+	token, err := GenerateToken(12)
+	if err != nil {
+		return ProviderPayment{}, err
+	}
+	externalID := "mock_" + token
+	return ProviderPayment{
+		ExternalID: externalID,
+		PaymentURL: "mock://pay/" + externalID,
+	}, nil
+}
+
+func (p *MockPaymentProvider) ParseWebhook(header http.Header, body []byte) (PaymentEvent, error) {
+	signature, err := hex.DecodeString(header.Get(MockSignatureHeader))
+	if err != nil || !hmac.Equal(signature, SignMockWebhook(p.secret, body)) {
+		return PaymentEvent{}, ErrInvalidWebhookSignature
+	}
+
+	var payload struct {
+		ExternalID string `json:"external_id"`
+		Status     string `json:"status"`
+		Reason     string `json:"reason"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return PaymentEvent{}, err
+	}
+	return PaymentEvent{ExternalID: payload.ExternalID, Status: payload.Status, Reason: payload.Reason}, nil
+}
+
+// SignMockWebhook returns the HMAC-SHA256 of a mock webhook body.
+func SignMockWebhook(secret, body []byte) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return mac.Sum(nil)
+}
+
+// ApplyPaymentEvent moves a pending intent to the state reported by the
+// provider and credits the wallet when it settled in time. Events for intents
+// that are no longer pending are ignored so webhook retries are harmless.
+func ApplyPaymentEvent(db *gorm.DB, provider string, event PaymentEvent) (models.PaymentIntent, error) {
+	var intent models.PaymentIntent
+	err := db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("provider = ? AND external_id = ?", provider, event.ExternalID).
+			First(&intent).Error
+		if err != nil {
+			return err
+		}
+		if intent.Status != PaymentPending {
+			return nil
+		}
+
+		now := time.Now()
+		switch event.Status {
+		case PaymentSettled:
+			if now.After(intent.ExpiresAt) {
+				// The customer was already told this payment expired; it has to
+				// be resolved with the provider by hand rather than credited.
+				intent.Status = PaymentExpired
+				intent.FailureReason = "settled after expiry"
+				break
+			}
+			_, err := PostWalletEntry(tx, intent.UserID, WalletEntryTopup, intent.Amount, AccountPaymentsClearing, "payment_intent", intent.ID, "Balance top up via "+provider)
+			if err != nil {
+				return err
+			}
+			intent.Status = PaymentSettled
+			intent.SettledAt = &now
+		case PaymentFailed, PaymentExpired:
+			intent.Status = event.Status
+			intent.FailureReason = event.Reason
+		default:
+			return fmt.Errorf("%w %q", ErrUnknownPaymentStatus, event.Status)
+		}
+
+		return tx.Model(&intent).Updates(map[string]interface{}{
+			"status":         intent.Status,
+			"failure_reason": intent.FailureReason,
+			"settled_at":     intent.SettledAt,
+		}).Error
+	})
+	return intent, err
+}
+
+// ExpirePaymentIntents marks pending intents past their expiry as expired.
+func ExpirePaymentIntents(db *gorm.DB) error {
+	return db.Model(&models.PaymentIntent{}).
+		Where("status = ? AND expires_at < ?", PaymentPending, time.Now()).
+		Updates(map[string]interface{}{"status": PaymentExpired, "failure_reason": "not paid in time"}).Error
+}
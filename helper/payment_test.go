@@ -0,0 +1,160 @@
+package helper
+
+import (
+	"encoding/hex"
+	"errors"
+	"main/models"
+	"net/http"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+func TestMockParseWebhook(t *testing.T) {
+	provider := &MockPaymentProvider{secret: []byte("secret")}
+	body := []byte(`{"external_id":"mock_1","status":"settled"}`)
+
+	tests := []struct {
+		name      string
+		signature string
+		wantErr   error
+	}{
+		{"valid signature", hex.EncodeToString(SignMockWebhook([]byte("secret"), body)), nil},
+		{"signed with another secret", hex.EncodeToString(SignMockWebhook([]byte("guess"), body)), ErrInvalidWebhookSignature},
+		{"not hex", "not-a-signature", ErrInvalidWebhookSignature},
+		{"missing", "", ErrInvalidWebhookSignature},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			header.Set(MockSignatureHeader, tt.signature)
+			event, err := provider.ParseWebhook(header, body)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ParseWebhook error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && (event.ExternalID != "mock_1" || event.Status != PaymentSettled) {
+				t.Errorf("ParseWebhook = %+v", event)
+			}
+		})
+	}
+}
+
+func TestApplyPaymentEvent(t *testing.T) {
+	db := openTestDB(t)
+	user := createTestUser(t, db, "payer@example.com", 0)
+
+	createIntent := func(externalID string, expiresAt time.Time) models.PaymentIntent {
+		t.Helper()
+		intent := models.PaymentIntent{
+			UserID:     user.ID,
+			Provider:   "mock",
+			ExternalID: externalID,
+			Amount:     5000,
+			Status:     PaymentPending,
+			ExpiresAt:  expiresAt,
+		}
+		if err := db.Create(&intent).Error; err != nil {
+			t.Fatal(err)
+		}
+		return intent
+	}
+	balance := func() int {
+		t.Helper()
+		var current models.User
+		if err := db.First(&current, user.ID).Error; err != nil {
+			t.Fatal(err)
+		}
+		return current.Balance
+	}
+	later := time.Now().Add(time.Hour)
+
+	t.Run("replayed settlement credits once", func(t *testing.T) {
+		createIntent("mock_settled", later)
+		for i := 0; i < 3; i++ {
+			intent, err := ApplyPaymentEvent(db, "mock", PaymentEvent{ExternalID: "mock_settled", Status: PaymentSettled})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if intent.Status != PaymentSettled || intent.SettledAt == nil {
+				t.Fatalf("delivery %d left intent %+v", i+1, intent)
+			}
+		}
+		if got := balance(); got != 5000 {
+			t.Errorf("balance = %d, want 5000", got)
+		}
+	})
+
+	t.Run("later events do not undo a settlement", func(t *testing.T) {
+		intent, err := ApplyPaymentEvent(db, "mock", PaymentEvent{ExternalID: "mock_settled", Status: PaymentFailed, Reason: "late"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if intent.Status != PaymentSettled || balance() != 5000 {
+			t.Errorf("intent %+v, balance %d after a late failure", intent, balance())
+		}
+	})
+
+	t.Run("settled after expiry", func(t *testing.T) {
+		createIntent("mock_expired", time.Now().Add(-time.Minute))
+		intent, err := ApplyPaymentEvent(db, "mock", PaymentEvent{ExternalID: "mock_expired", Status: PaymentSettled})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if intent.Status != PaymentExpired || intent.SettledAt != nil {
+			t.Errorf("intent = %+v, want expired and not settled", intent)
+		}
+		if got := balance(); got != 5000 {
+			t.Errorf("balance = %d, want 5000", got)
+		}
+	})
+
+	t.Run("failure", func(t *testing.T) {
+		createIntent("mock_failed", later)
+		intent, err := ApplyPaymentEvent(db, "mock", PaymentEvent{ExternalID: "mock_failed", Status: PaymentFailed, Reason: "card declined"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if intent.Status != PaymentFailed || intent.FailureReason != "card declined" {
+			t.Errorf("intent = %+v", intent)
+		}
+	})
+
+	t.Run("unknown status", func(t *testing.T) {
+		createIntent("mock_unknown", later)
+		_, err := ApplyPaymentEvent(db, "mock", PaymentEvent{ExternalID: "mock_unknown", Status: "refunded"})
+		if !errors.Is(err, ErrUnknownPaymentStatus) {
+			t.Fatalf("error = %v, want ErrUnknownPaymentStatus", err)
+		}
+		var intent models.PaymentIntent
+		if err := db.Where("external_id = ?", "mock_unknown").First(&intent).Error; err != nil {
+			t.Fatal(err)
+		}
+		if intent.Status != PaymentPending {
+			t.Errorf("status = %q, want it still pending", intent.Status)
+		}
+	})
+
+	t.Run("unknown intent", func(t *testing.T) {
+		_, err := ApplyPaymentEvent(db, "mock", PaymentEvent{ExternalID: "mock_missing", Status: PaymentSettled})
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			t.Errorf("error = %v, want ErrRecordNotFound", err)
+		}
+	})
+
+	t.Run("expiry sweep", func(t *testing.T) {
+		createIntent("mock_stale", time.Now().Add(-time.Minute))
+		if err := ExpirePaymentIntents(db); err != nil {
+			t.Fatal(err)
+		}
+		var intent models.PaymentIntent
+		if err := db.Where("external_id = ?", "mock_stale").First(&intent).Error; err != nil {
+			t.Fatal(err)
+		}
+		if intent.Status != PaymentExpired {
+			t.Errorf("status = %q, want expired", intent.Status)
+		}
+	})
+
+	assertWalletsBalanced(t, db)
+}
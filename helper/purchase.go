@@ -0,0 +1,421 @@
+package helper
+
+import (
+	"errors"
+	"fmt"
+	"main/config"
+	"main/models"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrProductNotFound   = errors.New("product not found")
+	ErrInsufficientStock = errors.New("insufficient stock")
+)
+
+type PurchaseLine struct {
+	ProductID uint
+	Quantity  int
+}
+
+type PurchaseRequest struct {
+	UserID uint
+	Lines  []PurchaseLine
+	// AddressID selects the shipping address, 0 uses the user's default one
+	// or, when the user has none, buys without shipping.
+	AddressID  uint
+	CouponCode string
+	// RedeemPoints loyalty points are spent as a discount.
+	RedeemPoints int
+	// Tax sets how lines are taxed, nil buys without tax.
+	Tax *config.TaxConfig
+	// Loyalty sets how points are earned and redeemed, nil neither earns
+	// nor accepts points.
+	Loyalty *config.LoyaltyConfig
+}
+
+type PurchaseResult struct {
+	Order        models.Order
+	Transactions []models.TransactionHistory
+	Products     []models.Product
+	Subtotal     int // items before discounts
+	Discount     int // coupon and points
+	Tax          int
+	PointsEarned int
+	ShippingCost int
+	TotalPrice   int // items less discounts, with tax, plus shipping
+}
+
+// pricedLine is a purchase line whose stock has been taken, waiting to be charged.
+type pricedLine struct {
+	product     models.Product
+	quantity    int
+	unitPrice   int // after any sale, in the product's currency
+	backordered int // units bought beyond stock
+	gross       int // quantity x price in the base currency
+	discount    int
+	taxRate     int
+	taxed       TaxedAmount
+	points      int // loyalty points earned
+}
+
+// Purchase buys every line of the request inside tx. Product rows are locked
+// in ID order before their stock is checked and the balance is debited
+// through the ledger, so concurrent purchases cannot oversell or overspend.
+// Any error means nothing should be committed.
+func Purchase(tx *gorm.DB, request PurchaseRequest) (*PurchaseResult, error) {
+	userID := request.UserID
+	now := time.Now()
+
+	// Orders of users without an address who did not ask for one are not shipped
+	address, err := ShippingAddress(tx, userID, request.AddressID)
+	shipped := err == nil
+	if err != nil && !(errors.Is(err, ErrAddressRequired) && request.AddressID == 0) {
+		return nil, err
+	}
+
+	lines, err := takeStock(tx, userID, request.Lines, now)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &PurchaseResult{Order: models.Order{
+		UserID: userID,
+		Status: OrderPending,
+	}}
+	if shipped {
+		result.Order.AddressID = address.ID
+		result.Order.ShipTo = address.String()
+	}
+	for _, line := range lines {
+		result.Subtotal += line.gross
+	}
+
+	// The coupon is locked after the products and before the user, the
+	// same order every purchase takes its locks in.
+	var coupon *models.Coupon
+	couponDiscount := 0
+	if request.CouponCode != "" {
+		couponLines := make([]couponLine, len(lines))
+		for i, line := range lines {
+			couponLines[i] = couponLine{ProductID: line.product.ID, CategoryID: line.product.CategoryID, Amount: line.gross}
+		}
+		var discounts []int
+		coupon, discounts, err = redeemCoupon(tx, request.CouponCode, userID, couponLines, now)
+		if err != nil {
+			return nil, err
+		}
+		for i := range lines {
+			lines[i].discount = discounts[i]
+			couponDiscount += discounts[i]
+		}
+		result.Order.CouponID = coupon.ID
+		result.Order.CouponCode = coupon.Code
+	}
+
+	// Points pay for part of what is left after the coupon
+	if request.RedeemPoints > 0 {
+		if request.Loyalty == nil {
+			return nil, ErrPointsLimit
+		}
+		amounts := make([]int, len(lines))
+		payable := 0
+		for i, line := range lines {
+			amounts[i] = line.gross - line.discount
+			payable += amounts[i]
+		}
+		pointsDiscount := request.RedeemPoints * request.Loyalty.PointValue
+		if pointsDiscount > payable*request.Loyalty.MaxRedeemPercent/100 {
+			return nil, ErrPointsLimit
+		}
+		for i, discount := range spreadAmount(pointsDiscount, amounts) {
+			lines[i].discount += discount
+		}
+		result.Order.PointsUsed = request.RedeemPoints
+	}
+
+	taxRates := map[uint]int{}
+	if request.Tax != nil {
+		categoryIDs := make([]uint, len(lines))
+		for i, line := range lines {
+			categoryIDs[i] = line.product.CategoryID
+		}
+		if taxRates, err = CategoryTaxRates(tx, request.Tax, categoryIDs); err != nil {
+			return nil, err
+		}
+	}
+
+	// Discounts apply to the price as shown, so tax is worked out afterwards
+	taxIncluded := request.Tax != nil && request.Tax.PricesIncludeTax
+	untaxed := make([]int, len(lines))
+	for i := range lines {
+		lines[i].taxRate = taxRates[lines[i].product.CategoryID]
+		lines[i].taxed = ApplyTax(lines[i].gross-lines[i].discount, lines[i].taxRate, taxIncluded)
+		untaxed[i] = lines[i].taxed.Subtotal
+		result.Discount += lines[i].discount
+	}
+
+	// Points are earned on the whole order and shared out over its lines so
+	// refunding a line takes back its part.
+	if request.Loyalty != nil && request.Loyalty.SpendPerPoint > 0 {
+		spent := 0
+		for _, amount := range untaxed {
+			spent += amount
+		}
+		result.PointsEarned = spent / request.Loyalty.SpendPerPoint
+		for i, points := range spreadAmount(result.PointsEarned, untaxed) {
+			lines[i].points = points
+		}
+		result.Order.PointsEarned = result.PointsEarned
+	}
+
+	if err := tx.Create(&result.Order).Error; err != nil {
+		return nil, err
+	}
+
+	weight := 0
+
+	for _, line := range lines {
+		product := line.product
+		taxed := line.taxed
+
+		transaction := models.TransactionHistory{
+			UserID:              userID,
+			OrderID:             result.Order.ID,
+			ProductID:           product.ID,
+			Quantity:            line.quantity,
+			UnitPrice:           line.unitPrice,
+			ListPrice:           product.Price,
+			Currency:            product.PriceMoney().Currency,
+			Discount:            line.discount,
+			Subtotal:            taxed.Subtotal,
+			Tax:                 taxed.Tax,
+			TaxRate:             line.taxRate,
+			TaxIncluded:         taxIncluded,
+			TotalPrice:          taxed.Total,
+			PointsEarned:        line.points,
+			BackorderedQuantity: line.backordered,
+		}
+		if err := tx.Create(&transaction).Error; err != nil {
+			return nil, err
+		}
+
+		_, err = PostWalletEntry(tx, userID, WalletEntryPurchase, -transaction.TotalPrice, AccountSales, "transaction_history", transaction.ID, "Purchase of "+product.Title)
+		if err != nil {
+			return nil, err
+		}
+
+		item := models.OrderItem{
+			OrderID:              result.Order.ID,
+			ProductID:            product.ID,
+			TransactionHistoryID: transaction.ID,
+			Title:                product.Title,
+			Quantity:             transaction.Quantity,
+			UnitPrice:            transaction.UnitPrice,
+			Currency:             transaction.Currency,
+			TotalPrice:           transaction.TotalPrice,
+		}
+		if err := tx.Create(&item).Error; err != nil {
+			return nil, err
+		}
+
+		weight += ShippingWeight(product, line.quantity)
+		result.Order.Items = append(result.Order.Items, item)
+		result.Transactions = append(result.Transactions, transaction)
+		result.Products = append(result.Products, product)
+		result.Tax += transaction.Tax
+		result.TotalPrice += transaction.TotalPrice
+	}
+
+	if coupon != nil {
+		redemption := models.CouponRedemption{
+			CouponID: coupon.ID,
+			UserID:   userID,
+			OrderID:  result.Order.ID,
+			Discount: couponDiscount,
+		}
+		if err := tx.Create(&redemption).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	if request.RedeemPoints > 0 {
+		err := RedeemPoints(tx, userID, request.RedeemPoints, "order", result.Order.ID, fmt.Sprintf("Redeemed on order %d", result.Order.ID))
+		if err != nil {
+			return nil, err
+		}
+	}
+	if result.PointsEarned > 0 {
+		expiresAt := now.Add(request.Loyalty.ExpiresAfter)
+		err := EarnPoints(tx, userID, result.PointsEarned, expiresAt, "order", result.Order.ID, fmt.Sprintf("Earned on order %d", result.Order.ID))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	shipping := 0
+	if shipped {
+		if shipping, err = ShippingCost(tx, address.Province, weight); err != nil {
+			return nil, err
+		}
+	}
+	if shipping > 0 {
+		_, err = PostWalletEntry(tx, userID, WalletEntryPurchase, -shipping, AccountSales, "order", result.Order.ID, fmt.Sprintf("Shipping for order %d", result.Order.ID))
+		if err != nil {
+			return nil, err
+		}
+	}
+	result.ShippingCost = shipping
+	result.TotalPrice += shipping
+
+	// Numbering comes last so the sequence row is locked as briefly as possible
+	invoiceNumber, err := NextInvoiceNumber(tx, now)
+	if err != nil {
+		return nil, err
+	}
+	err = tx.Model(&models.TransactionHistory{}).
+		Where("order_id = ?", result.Order.ID).
+		Update("invoice_number", invoiceNumber).Error
+	if err != nil {
+		return nil, err
+	}
+	for i := range result.Transactions {
+		result.Transactions[i].InvoiceNumber = invoiceNumber
+	}
+
+	result.Order.Subtotal = result.Subtotal
+	result.Order.Discount = result.Discount
+	result.Order.Tax = result.Tax
+	result.Order.ShippingCost = shipping
+	result.Order.TotalPrice = result.TotalPrice
+	result.Order.InvoiceNumber = invoiceNumber
+	err = tx.Model(&result.Order).Updates(map[string]interface{}{
+		"subtotal":       result.Subtotal,
+		"discount":       result.Discount,
+		"tax":            result.Tax,
+		"shipping_cost":  shipping,
+		"total_price":    result.TotalPrice,
+		"invoice_number": invoiceNumber,
+	}).Error
+	if err != nil {
+		return nil, err
+	}
+
+	// The wallet has already been debited, so the order is paid straight
+	// away. Orders with backordered items wait for their stock instead.
+	status := OrderPaid
+	for _, transaction := range result.Transactions {
+		if transaction.BackorderedQuantity > 0 {
+			status = OrderBackordered
+		}
+	}
+	paid, err := TransitionOrder(tx, result.Order.ID, status, userID, "")
+	if err != nil {
+		return nil, err
+	}
+	result.Order.Status = paid.Status
+
+	return result, nil
+}
+
+// takeStock locks the products of the purchase, takes the quantities off
+// their stock and prices each line, with the sales running at now, in the
+// base currency. Stock userID reserved for the purchase is converted, stock
+// reserved by others cannot be bought. Products that allow backorders sell
+// whatever is missing as backordered units.
+func takeStock(tx *gorm.DB, userID uint, requested []PurchaseLine, now time.Time) ([]pricedLine, error) {
+	sales, err := ActiveSales(tx, now)
+	if err != nil {
+		return nil, err
+	}
+
+	// Locking products in a fixed order keeps two multi-line purchases from
+	// deadlocking on each other.
+	sorted := append([]PurchaseLine(nil), requested...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].ProductID < sorted[j].ProductID })
+
+	lines := make([]pricedLine, 0, len(sorted))
+	for _, line := range sorted {
+		product, err := lockReservedProduct(tx, line.ProductID, now)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := releaseReservations(tx, &product, userID, ReservationConverted); err != nil {
+			return nil, err
+		}
+
+		taken := line.Quantity
+		if taken > SellableStock(product, now) {
+			if !AllowsBackorder(product) {
+				return nil, ErrInsufficientStock
+			}
+			taken = SellableStock(product, now)
+			if taken < 0 {
+				taken = 0
+			}
+		}
+
+		stock := tx.Model(&models.Product{}).
+			Where("id = ? AND stock - reserved >= ?", product.ID, taken).
+			UpdateColumn("stock", gorm.Expr("stock - ?", taken))
+		if stock.Error != nil {
+			return nil, stock.Error
+		}
+		if stock.RowsAffected == 0 {
+			return nil, ErrInsufficientStock
+		}
+		product.Stock -= taken
+
+		// Increment sold_product_amount in category
+		err = tx.Model(&models.Category{}).
+			Where("id = ?", product.CategoryID).
+			UpdateColumn("sold_product_amount", gorm.Expr("sold_product_amount + ?", line.Quantity)).Error
+		if err != nil {
+			return nil, err
+		}
+
+		// Products may be priced in another currency, the wallet is always
+		// charged in the base currency.
+		price, _ := sales.Price(product)
+		total, err := ConvertMoney(tx, price.Mul(line.Quantity), models.BaseCurrency)
+		if err != nil {
+			return nil, err
+		}
+
+		lines = append(lines, pricedLine{
+			product:     product,
+			quantity:    line.Quantity,
+			unitPrice:   price.Amount,
+			backordered: line.Quantity - taken,
+			gross:       total.Amount,
+		})
+	}
+	return lines, nil
+}
+
+// spreadAmount shares total out over lines in proportion to weights. The
+// last line with a weight takes the rounding so the shares add up to total.
+func spreadAmount(total int, weights []int) []int {
+	shares := make([]int, len(weights))
+	sum := 0
+	for _, weight := range weights {
+		sum += weight
+	}
+	if sum == 0 {
+		return shares
+	}
+	remaining, last := total, -1
+	for i, weight := range weights {
+		if weight == 0 {
+			continue
+		}
+		shares[i] = total * weight / sum
+		remaining -= shares[i]
+		last = i
+	}
+	shares[last] += remaining
+	return shares
+}
@@ -0,0 +1,36 @@
+package helper
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSpreadAmount(t *testing.T) {
+	tests := []struct {
+		total   int
+		weights []int
+		want    []int
+	}{
+		{100, []int{1, 1}, []int{50, 50}},
+		{100, []int{1, 1, 1}, []int{33, 33, 34}},
+		{10, []int{3, 0, 7}, []int{3, 0, 7}},
+		{7, []int{5, 5, 0}, []int{3, 4, 0}},
+		{0, []int{2, 3}, []int{0, 0}},
+		{50, []int{0, 0}, []int{0, 0}},
+		{1, []int{1000, 1}, []int{0, 1}},
+		{-10, []int{1, 2}, []int{-3, -7}},
+	}
+	for _, tt := range tests {
+		got := spreadAmount(tt.total, tt.weights)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("spreadAmount(%d, %v) = %v, want %v", tt.total, tt.weights, got, tt.want)
+		}
+		sum := 0
+		for _, share := range got {
+			sum += share
+		}
+		if sum != tt.total && sum != 0 {
+			t.Errorf("spreadAmount(%d, %v) adds up to %d", tt.total, tt.weights, sum)
+		}
+	}
+}
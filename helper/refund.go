@@ -0,0 +1,172 @@
+package helper
+
+import (
+	"errors"
+	"fmt"
+	"main/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrTransactionNotFound = errors.New("transaction not found")
+	ErrInvalidRefund       = errors.New("refund quantity exceeds what is left to refund")
+)
+
+// RefundTransaction refunds quantity units of a purchase inside tx: stock is
+// returned to the product, the category's sold amount is corrected and the
+// buyer's wallet is credited. Backordered units are refunded first and,
+// never having left the shelf, are not restocked. A quantity of 0 refunds everything that has not
+// been refunded yet.
+func RefundTransaction(tx *gorm.DB, transactionID uint, quantity int, refundedBy uint, reason string) (*models.Refund, error) {
+	return refundTransaction(tx, transactionID, quantity, refundedBy, reason, true)
+}
+
+// refundTransaction does the work of RefundTransaction. settleOrder controls
+// whether a fully refunded order is moved to refunded, which callers that
+// move the order themselves, like cancellation, turn off.
+func refundTransaction(tx *gorm.DB, transactionID uint, quantity int, refundedBy uint, reason string, settleOrder bool) (*models.Refund, error) {
+	var transaction models.TransactionHistory
+	err := tx.Select("product_id").First(&transaction, transactionID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrTransactionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	// The product is locked before the purchase row, the same order
+	// backorder allocation locks them in.
+	var product models.Product
+	err = tx.Unscoped().Clauses(clause.Locking{Strength: "UPDATE"}).First(&product, transaction.ProductID).Error
+	if err != nil {
+		return nil, err
+	}
+	err = tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&transaction, transactionID).Error
+	if err != nil {
+		return nil, err
+	}
+
+	refundedBefore := transaction.RefundedQuantity
+	remaining := transaction.Quantity - refundedBefore
+	if quantity == 0 {
+		quantity = remaining
+	}
+	if quantity <= 0 || quantity > remaining {
+		return nil, ErrInvalidRefund
+	}
+
+	// Refund the price proportionally; the last refund takes whatever is left
+	// so rounding never loses or creates money.
+	amount := transaction.TotalPrice * quantity / transaction.Quantity
+	if quantity == remaining {
+		amount = transaction.TotalPrice - transaction.RefundedAmount
+	}
+
+	backordered := transaction.BackorderedQuantity
+	if backordered > quantity {
+		backordered = quantity
+	}
+	if backordered > 0 {
+		err := tx.Unscoped().Model(&models.Category{}).
+			Where("id = ?", product.CategoryID).
+			UpdateColumn("sold_product_amount", gorm.Expr("sold_product_amount - ?", backordered)).Error
+		if err != nil {
+			return nil, err
+		}
+	}
+	// The purchase stops waiting before the units go back on the shelf,
+	// otherwise allocation would hand them straight back to it.
+	err = tx.Model(&transaction).UpdateColumns(map[string]interface{}{
+		"refunded_quantity":    gorm.Expr("refunded_quantity + ?", quantity),
+		"refunded_amount":      gorm.Expr("refunded_amount + ?", amount),
+		"backordered_quantity": gorm.Expr("backordered_quantity - ?", backordered),
+	}).Error
+	if err != nil {
+		return nil, err
+	}
+	if quantity > backordered {
+		if err := RestockProduct(tx, transaction.ProductID, quantity-backordered); err != nil {
+			return nil, err
+		}
+	}
+
+	refund := models.Refund{
+		TransactionHistoryID: transaction.ID,
+		UserID:               transaction.UserID,
+		RefundedBy:           refundedBy,
+		Quantity:             quantity,
+		Amount:               amount,
+		Reason:               reason,
+	}
+	if err := tx.Create(&refund).Error; err != nil {
+		return nil, err
+	}
+
+	_, err = PostWalletEntry(tx, transaction.UserID, WalletEntryRefund, amount, AccountRefunds, "refund", refund.ID, fmt.Sprintf("Refund of transaction %d", transaction.ID))
+	if err != nil {
+		return nil, err
+	}
+
+	// Take back the points earned on the refunded units. Working from the
+	// refunded quantity before and after keeps the rounding from adding up.
+	if transaction.PointsEarned > 0 {
+		before := transaction.PointsEarned * refundedBefore / transaction.Quantity
+		after := transaction.PointsEarned * (refundedBefore + quantity) / transaction.Quantity
+		err := reversePoints(tx, transaction.UserID, after-before, "refund", refund.ID, fmt.Sprintf("Points of refunded transaction %d", transaction.ID))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if settleOrder && transaction.OrderID != 0 {
+		if err := refundOrderIfSettled(tx, transaction.OrderID, refundedBy); err != nil {
+			return nil, err
+		}
+		// Refunding the last waiting units lets the rest of the order go out
+		if backordered > 0 {
+			if err := releaseBackorderedOrder(tx, transaction.OrderID); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return &refund, nil
+}
+
+// RestockProduct puts quantity units that had been sold back on the shelf and
+// takes them off the category's sold amount. Backordered purchases of the
+// product get the units first.
+func RestockProduct(tx *gorm.DB, productID uint, quantity int) error {
+	// Refunds of products that were deleted since still have to be counted.
+	// The row is locked so the stock seen here is the one being added to.
+	var product models.Product
+	err := tx.Unscoped().Clauses(clause.Locking{Strength: "UPDATE"}).First(&product, productID).Error
+	if err != nil {
+		return err
+	}
+
+	err = tx.Unscoped().Model(&models.Product{}).
+		Where("id = ?", productID).
+		UpdateColumn("stock", gorm.Expr("stock + ?", quantity)).Error
+	if err != nil {
+		return err
+	}
+
+	err = tx.Unscoped().Model(&models.Category{}).
+		Where("id = ?", product.CategoryID).
+		UpdateColumn("sold_product_amount", gorm.Expr("sold_product_amount - ?", quantity)).Error
+	if err != nil {
+		return err
+	}
+
+	if product.DeletedAt.Valid {
+		return nil
+	}
+	oldStock := product.Stock
+	allocated, err := AllocateBackorders(tx, productID)
+	if err != nil {
+		return err
+	}
+	return NotifyBackInStock(tx, *allocated, oldStock)
+}
@@ -0,0 +1,89 @@
+package helper
+
+import (
+	"main/models"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+func TestRefundProration(t *testing.T) {
+	db := openTestDB(t)
+	product := createTestProduct(t, db, models.Product{Title: "Refunded", Price: 1000, Stock: 10})
+	user := createTestUser(t, db, "refunds@example.com", 0)
+
+	// A purchase of three units that cost 1000 together, which does not
+	// divide evenly, on an order with shipping.
+	order := models.Order{UserID: user.ID, Status: OrderPaid, TotalPrice: 1500, ShippingCost: 500}
+	if err := db.Create(&order).Error; err != nil {
+		t.Fatal(err)
+	}
+	transaction := models.TransactionHistory{
+		ProductID: product.ID, UserID: user.ID, OrderID: order.ID, Quantity: 3, UnitPrice: 1000, TotalPrice: 1000,
+	}
+	if err := db.Create(&transaction).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Model(&models.Category{}).Where("id = ?", product.CategoryID).Update("sold_product_amount", 3).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	refund := func(quantity int) int {
+		t.Helper()
+		var refunded *models.Refund
+		err := db.Transaction(func(tx *gorm.DB) error {
+			var err error
+			refunded, err = RefundTransaction(tx, transaction.ID, quantity, 1, "Test")
+			return err
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return refunded.Amount
+	}
+
+	// Partial refunds round down, the last one takes what is left
+	if amount := refund(1); amount != 333 {
+		t.Errorf("refund of 1 unit = %d, want 333", amount)
+	}
+	if err := db.First(&order, order.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if order.Status != OrderPaid {
+		t.Errorf("order is %s after a partial refund, want paid", order.Status)
+	}
+	if amount := refund(0); amount != 667 {
+		t.Errorf("refund of the remaining 2 units = %d, want 667", amount)
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		_, err := RefundTransaction(tx, transaction.ID, 1, 1, "Again")
+		return err
+	})
+	if err != ErrInvalidRefund {
+		t.Errorf("refunding past the quantity: err = %v, want ErrInvalidRefund", err)
+	}
+
+	// The fully refunded order settles and gives back its shipping
+	if err := db.First(&order, order.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.First(&user, user.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if order.Status != OrderRefunded || user.Balance != 1500 {
+		t.Errorf("order is %s with balance %d, want refunded with 1500", order.Status, user.Balance)
+	}
+
+	if err := db.First(&product, product.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	var category models.Category
+	if err := db.First(&category, product.CategoryID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if product.Stock != 13 || category.SoldProductAmount != 0 {
+		t.Errorf("stock = %d sold = %d, want 13 and 0", product.Stock, category.SoldProductAmount)
+	}
+	assertWalletsBalanced(t, db)
+}
@@ -0,0 +1,209 @@
+package helper
+
+import (
+	"errors"
+	"main/models"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	ReservationActive    = "active"
+	ReservationConverted = "converted" // bought
+	ReservationReleased  = "released"  // given up or replaced before it expired
+	ReservationExpired   = "expired"
+)
+
+// ReserveStock holds the lines for userID until now plus ttl and lets go of
+// any other reservation the user had, so they hold exactly what they are
+// checking out. Products are locked in ID order like purchases do, and it
+// fails with ErrInsufficientStock when not enough stock is free.
+func ReserveStock(tx *gorm.DB, userID uint, lines []PurchaseLine, now time.Time, ttl time.Duration) ([]models.Reservation, error) {
+	var productIDs []uint
+	err := tx.Model(&models.Reservation{}).
+		Where("user_id = ? AND status = ?", userID, ReservationActive).
+		Distinct().Pluck("product_id", &productIDs).Error
+	if err != nil {
+		return nil, err
+	}
+
+	quantities := make(map[uint]int)
+	for _, line := range lines {
+		if _, ok := quantities[line.ProductID]; !ok {
+			productIDs = append(productIDs, line.ProductID)
+		}
+		quantities[line.ProductID] += line.Quantity
+	}
+	sort.Slice(productIDs, func(i, j int) bool { return productIDs[i] < productIDs[j] })
+
+	reservations := make([]models.Reservation, 0, len(lines))
+	for i, productID := range productIDs {
+		if i > 0 && productIDs[i-1] == productID {
+			continue
+		}
+
+		product, err := lockReservedProduct(tx, productID, now)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := releaseReservations(tx, &product, userID, ReservationReleased); err != nil {
+			return nil, err
+		}
+
+		quantity, ok := quantities[productID]
+		if !ok {
+			continue
+		}
+		if quantity > SellableStock(product, now) {
+			if !AllowsBackorder(product) {
+				return nil, ErrInsufficientStock
+			}
+			// Only what is on the shelf is held, the rest will be backordered
+			quantity = SellableStock(product, now)
+			if quantity <= 0 {
+				continue
+			}
+		}
+		err = tx.Model(&models.Product{}).
+			Where("id = ?", product.ID).
+			UpdateColumn("reserved", gorm.Expr("reserved + ?", quantity)).Error
+		if err != nil {
+			return nil, err
+		}
+
+		reservation := models.Reservation{
+			UserID:    userID,
+			ProductID: product.ID,
+			Quantity:  quantity,
+			Status:    ReservationActive,
+			ExpiresAt: now.Add(ttl),
+		}
+		if err := tx.Create(&reservation).Error; err != nil {
+			return nil, err
+		}
+		reservations = append(reservations, reservation)
+	}
+	return reservations, nil
+}
+
+// lockReservedProduct locks a product and expires its reservations that ran
+// out before now, so its Reserved count only covers live holds. Stock that is
+// free after that goes to backordered purchases before anyone else.
+func lockReservedProduct(tx *gorm.DB, productID uint, now time.Time) (models.Product, error) {
+	var product models.Product
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&product, productID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return product, ErrProductNotFound
+	}
+	if err != nil {
+		return product, err
+	}
+
+	var expired []models.Reservation
+	err = tx.Where("product_id = ? AND status = ? AND expires_at <= ?", productID, ReservationActive, now).Find(&expired).Error
+	if err != nil {
+		return product, err
+	}
+	if len(expired) > 0 {
+		if err := settleReservations(tx, &product, expired, ReservationExpired); err != nil {
+			return product, err
+		}
+	}
+	if err := allocateBackorders(tx, &product, now); err != nil {
+		return product, err
+	}
+	return product, nil
+}
+
+// releaseReservations ends the active reservations userID holds on the
+// locked product with the given status and returns how many units they held.
+func releaseReservations(tx *gorm.DB, product *models.Product, userID uint, status string) (int, error) {
+	var reservations []models.Reservation
+	err := tx.Where("product_id = ? AND user_id = ? AND status = ?", product.ID, userID, ReservationActive).Find(&reservations).Error
+	if err != nil || len(reservations) == 0 {
+		return 0, err
+	}
+
+	held := 0
+	for _, reservation := range reservations {
+		held += reservation.Quantity
+	}
+	return held, settleReservations(tx, product, reservations, status)
+}
+
+func settleReservations(tx *gorm.DB, product *models.Product, reservations []models.Reservation, status string) error {
+	ids := make([]uint, len(reservations))
+	held := 0
+	for i, reservation := range reservations {
+		ids[i] = reservation.ID
+		held += reservation.Quantity
+	}
+
+	if err := tx.Model(&models.Reservation{}).Where("id IN ?", ids).Update("status", status).Error; err != nil {
+		return err
+	}
+	err := tx.Model(&models.Product{}).
+		Where("id = ?", product.ID).
+		UpdateColumn("reserved", gorm.Expr("reserved - ?", held)).Error
+	if err != nil {
+		return err
+	}
+	product.Reserved -= held
+	return nil
+}
+
+// ReleaseUserReservations gives back all stock userID holds.
+func ReleaseUserReservations(tx *gorm.DB, userID uint, now time.Time) error {
+	var productIDs []uint
+	err := tx.Model(&models.Reservation{}).
+		Where("user_id = ? AND status = ?", userID, ReservationActive).
+		Distinct().Order("product_id").Pluck("product_id", &productIDs).Error
+	if err != nil {
+		return err
+	}
+	for _, productID := range productIDs {
+		product, err := lockReservedProduct(tx, productID, now)
+		if err != nil {
+			return err
+		}
+		if _, err := releaseReservations(tx, &product, userID, ReservationReleased); err != nil {
+			return err
+		}
+		if err := allocateBackorders(tx, &product, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ExpireReservations gives back the stock of every reservation that ran out
+// before now. Each product is handled in its own transaction.
+func ExpireReservations(db *gorm.DB, now time.Time) error {
+	var productIDs []uint
+	err := db.Model(&models.Reservation{}).
+		Where("status = ? AND expires_at <= ?", ReservationActive, now).
+		Distinct().Pluck("product_id", &productIDs).Error
+	if err != nil {
+		return err
+	}
+
+	for _, productID := range productIDs {
+		err := db.Transaction(func(tx *gorm.DB) error {
+			_, err := lockReservedProduct(tx, productID, now)
+			if errors.Is(err, ErrProductNotFound) {
+				// The product was deleted, there is no stock left to give back
+				return tx.Model(&models.Reservation{}).
+					Where("product_id = ? AND status = ? AND expires_at <= ?", productID, ReservationActive, now).
+					Update("status", ReservationExpired).Error
+			}
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package helper
+
+import (
+	"errors"
+	"main/models"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+func TestReservations(t *testing.T) {
+	db := openTestDB(t)
+	held := createTestProduct(t, db, models.Product{Title: "Held", Price: 1000, Stock: 3})
+	expiring := createTestProduct(t, db, models.Product{Title: "Expiring", Price: 1000, Stock: 2})
+	holder := createTestUser(t, db, "holder@example.com", 10000)
+	other := createTestUser(t, db, "other@example.com", 10000)
+
+	now := time.Now()
+	reserve := func(productID uint, quantity int) {
+		t.Helper()
+		err := db.Transaction(func(tx *gorm.DB) error {
+			_, err := ReserveStock(tx, holder.ID, []PurchaseLine{{ProductID: productID, Quantity: quantity}}, now, 10*time.Minute)
+			return err
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	stock := func(product models.Product) (int, int) {
+		t.Helper()
+		if err := db.First(&product, product.ID).Error; err != nil {
+			t.Fatal(err)
+		}
+		return product.Stock, product.Reserved
+	}
+
+	// Stock held for someone's checkout cannot be bought by anyone else
+	reserve(held.ID, 2)
+	if _, err := buy(db, other.ID, held.ID, 2); !errors.Is(err, ErrInsufficientStock) {
+		t.Errorf("buying reserved stock: err = %v, want ErrInsufficientStock", err)
+	}
+	if _, err := buy(db, other.ID, held.ID, 1); err != nil {
+		t.Errorf("buying the free unit: %v", err)
+	}
+
+	// The holder's purchase converts the reservation
+	if _, err := buy(db, holder.ID, held.ID, 2); err != nil {
+		t.Fatal(err)
+	}
+	if stock, reserved := stock(held); stock != 0 || reserved != 0 {
+		t.Errorf("after buying stock = %d reserved = %d, want 0 and 0", stock, reserved)
+	}
+	var converted int64
+	err := db.Model(&models.Reservation{}).Where("product_id = ? AND status = ?", held.ID, ReservationConverted).Count(&converted).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	if converted != 1 {
+		t.Errorf("%d converted reservations, want 1", converted)
+	}
+
+	// Reservations that run out give their stock back
+	reserve(expiring.ID, 2)
+	if stock, reserved := stock(expiring); stock != 2 || reserved != 2 {
+		t.Errorf("while reserved stock = %d reserved = %d, want 2 and 2", stock, reserved)
+	}
+	if err := ExpireReservations(db, now.Add(10*time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if stock, reserved := stock(expiring); stock != 2 || reserved != 0 {
+		t.Errorf("after expiry stock = %d reserved = %d, want 2 and 0", stock, reserved)
+	}
+	if _, err := buy(db, other.ID, expiring.ID, 2); err != nil {
+		t.Errorf("buying stock of an expired reservation: %v", err)
+	}
+	assertWalletsBalanced(t, db)
+}
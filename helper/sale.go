@@ -0,0 +1,39 @@
+package helper
+
+import (
+	"main/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Sales holds the sales running at one moment, so a whole product listing
+// can be priced with a single query.
+type Sales []models.Sale
+
+// ActiveSales returns the sales running at now.
+func ActiveSales(db *gorm.DB, now time.Time) (Sales, error) {
+	var sales []models.Sale
+	err := db.Where("starts_at <= ? AND ends_at > ?", now, now).Find(&sales).Error
+	return sales, err
+}
+
+// Price returns what product sells for and the sale that sets that price,
+// nil when the product is at its list price. When sales overlap the
+// customer gets the lowest price.
+func (sales Sales) Price(product models.Product) (models.Money, *models.Sale) {
+	price := product.PriceMoney()
+	var best *models.Sale
+	for i, sale := range sales {
+		if sale.ProductID != product.ID && (sale.CategoryID == 0 || sale.CategoryID != product.CategoryID) {
+			continue
+		}
+		if best == nil || sale.Percent > best.Percent {
+			best = &sales[i]
+		}
+	}
+	if best != nil {
+		price.Amount = price.Amount * (100 - best.Percent) / 100
+	}
+	return price, best
+}
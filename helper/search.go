@@ -0,0 +1,244 @@
+package helper
+
+import (
+	"main/models"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"gorm.io/gorm"
+)
+
+// MinTitleSimilarity is how close, by trigram word similarity, a query has
+// to be to a title to match despite typos.
+const MinTitleSimilarity = 0.3
+
+// productSearchSetup keeps products.search_vector up to date on Postgres.
+// Titles weigh most, then the category type, then the description. The
+// simple configuration is used because titles mix Indonesian and English.
+var productSearchSetup = []string{
+	`CREATE EXTENSION IF NOT EXISTS pg_trgm`,
+	`ALTER TABLE products ADD COLUMN IF NOT EXISTS search_vector tsvector`,
+	`CREATE OR REPLACE FUNCTION product_search_vector(title text, description text, category_id bigint) RETURNS tsvector AS $$
+		SELECT setweight(to_tsvector('simple', coalesce(title, '')), 'A') ||
+			setweight(to_tsvector('simple', coalesce((SELECT type FROM categories WHERE id = category_id), '')), 'B') ||
+			setweight(to_tsvector('simple', coalesce(description, '')), 'C')
+	$$ LANGUAGE sql STABLE`,
+	`CREATE OR REPLACE FUNCTION products_search_vector_trigger() RETURNS trigger AS $$
+	BEGIN
+		NEW.search_vector := product_search_vector(NEW.title, NEW.description, NEW.category_id);
+		RETURN NEW;
+	END
+	$$ LANGUAGE plpgsql`,
+	`DROP TRIGGER IF EXISTS products_search_vector_update ON products`,
+	`CREATE TRIGGER products_search_vector_update BEFORE INSERT OR UPDATE OF title, description, category_id ON products
+		FOR EACH ROW EXECUTE FUNCTION products_search_vector_trigger()`,
+	`CREATE OR REPLACE FUNCTION categories_search_vector_trigger() RETURNS trigger AS $$
+	BEGIN
+		UPDATE products SET search_vector = product_search_vector(title, description, category_id) WHERE category_id = NEW.id;
+		RETURN NULL;
+	END
+	$$ LANGUAGE plpgsql`,
+	`DROP TRIGGER IF EXISTS categories_search_vector_update ON categories`,
+	`CREATE TRIGGER categories_search_vector_update AFTER UPDATE OF type ON categories
+		FOR EACH ROW EXECUTE FUNCTION categories_search_vector_trigger()`,
+	`CREATE INDEX IF NOT EXISTS idx_products_search_vector ON products USING gin (search_vector)`,
+	`CREATE INDEX IF NOT EXISTS idx_products_title_trgm ON products USING gin (title gin_trgm_ops)`,
+	// Products from before the column existed
+	`UPDATE products SET search_vector = product_search_vector(title, description, category_id) WHERE search_vector IS NULL`,
+}
+
+// SetupProductSearch creates the search column, its triggers and indexes.
+// It runs after AutoMigrate and is safe to run on every start. Other
+// databases search without it, see SearchProducts.
+func SetupProductSearch(db *gorm.DB) error {
+	if db.Dialector.Name() != "postgres" {
+		return nil
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		for _, statement := range productSearchSetup {
+			if err := tx.Exec(statement).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// SearchResult is a product matching a search with how well it matched.
+type SearchResult struct {
+	models.Product
+	Rank float64
+}
+
+// searchTerms splits a query into lower case words of letters and digits,
+// which also keeps tsquery operators out of it.
+func searchTerms(query string) []string {
+	return strings.FieldsFunc(strings.ToLower(query), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// SearchProducts finds the products matching query, best match first, and
+// returns a page of them with the total number of matches. Every word has to
+// match, also as the start of a longer word so results show while typing.
+func SearchProducts(db *gorm.DB, query string, offset, limit int) ([]SearchResult, int64, error) {
+	terms := searchTerms(query)
+	if len(terms) == 0 {
+		return nil, 0, nil
+	}
+	if db.Dialector.Name() == "postgres" {
+		return searchProductsPostgres(db, terms, offset, limit)
+	}
+	return searchProductsFallback(db, terms, offset, limit)
+}
+
+func searchProductsPostgres(db *gorm.DB, terms []string, offset, limit int) ([]SearchResult, int64, error) {
+	prefixed := make([]string, len(terms))
+	for i, term := range terms {
+		prefixed[i] = term + ":*"
+	}
+	tsquery := strings.Join(prefixed, " & ")
+	text := strings.Join(terms, " ")
+
+	var results []SearchResult
+	var total int64
+	err := db.Transaction(func(tx *gorm.DB) error {
+		// <% compares against pg_trgm.word_similarity_threshold, which unlike
+		// a word_similarity() call can use the trigram index on titles. The
+		// setting only lasts for this transaction.
+		err := tx.Exec("SELECT set_config('pg_trgm.word_similarity_threshold', ?, true)", strconv.FormatFloat(MinTitleSimilarity, 'f', -1, 64)).Error
+		if err != nil {
+			return err
+		}
+
+		// Titles close to the query match even when misspelled
+		matches := tx.Model(&models.Product{}).
+			Where("products.search_vector @@ to_tsquery('simple', ?) OR ? <% products.title", tsquery, text)
+
+		if err := matches.Count(&total).Error; err != nil {
+			return err
+		}
+
+		return matches.
+			Select("products.*, ts_rank(products.search_vector, to_tsquery('simple', ?)) + word_similarity(?, products.title) AS rank", tsquery, text).
+			Order("rank DESC").
+			Order("products.id").
+			Offset(offset).
+			Limit(limit).
+			Find(&results).Error
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return results, total, nil
+}
+
+// searchProductsFallback ranks products in Go for databases without full
+// text search, like SQLite in development. It reads the whole catalog so it
+// only suits small ones.
+func searchProductsFallback(db *gorm.DB, terms []string, offset, limit int) ([]SearchResult, int64, error) {
+	var results []SearchResult
+	var products []models.Product
+	err := db.Joins("Category").FindInBatches(&products, 500, func(tx *gorm.DB, batch int) error {
+		for _, product := range products {
+			rank := rankProduct(product, terms)
+			if rank > 0 {
+				results = append(results, SearchResult{Product: product, Rank: rank})
+			}
+		}
+		return nil
+	}).Error
+	if err != nil {
+		return nil, 0, err
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].Rank != results[j].Rank {
+			return results[i].Rank > results[j].Rank
+		}
+		return results[i].ID < results[j].ID
+	})
+
+	total := int64(len(results))
+	if offset >= len(results) {
+		return nil, total, nil
+	}
+	results = results[offset:]
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	return results, total, nil
+}
+
+// rankProduct scores how well every term matches the product, weighting the
+// fields like the Postgres search does, or returns 0 when a term is missing.
+func rankProduct(product models.Product, terms []string) float64 {
+	fields := []struct {
+		words  []string
+		weight float64
+	}{
+		{searchTerms(product.Title), 1},
+		{searchTerms(product.Category.Type), 0.4},
+		{searchTerms(product.Description), 0.2},
+	}
+
+	rank := 0.0
+	for _, term := range terms {
+		best := 0.0
+		for _, field := range fields {
+			for _, word := range field.words {
+				if score := matchWord(term, word) * field.weight; score > best {
+					best = score
+				}
+			}
+		}
+		if best == 0 {
+			return 0
+		}
+		rank += best
+	}
+	return rank / float64(len(terms))
+}
+
+// matchWord scores a search term against a word: exact matches score
+// highest, then words the term starts, then words within a typo or two.
+func matchWord(term, word string) float64 {
+	switch {
+	case term == word:
+		return 1
+	case strings.HasPrefix(word, term):
+		return 0.8
+	}
+	allowed := 1
+	if len([]rune(term)) >= 6 {
+		allowed = 2
+	}
+	if len([]rune(term)) >= 3 && editDistance(term, word) <= allowed {
+		return 0.5
+	}
+	return 0
+}
+
+// editDistance is the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	previous := make([]int, len(rb)+1)
+	current := make([]int, len(rb)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		current[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(rb)]
+}
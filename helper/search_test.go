@@ -0,0 +1,111 @@
+package helper
+
+import (
+	"main/models"
+	"reflect"
+	"testing"
+)
+
+func TestSearchProductsFallback(t *testing.T) {
+	db := openTestDB(t)
+	if db.Dialector.Name() == "postgres" {
+		t.Skip("Postgres searches with full text search instead")
+	}
+
+	categories := []models.Category{{Type: "Electronics"}, {Type: "Kitchen"}}
+	if err := db.Create(&categories).Error; err != nil {
+		t.Fatal(err)
+	}
+	products := []models.Product{
+		{Title: "Wireless Keyboard", Description: "Compact and quiet", CategoryID: categories[0].ID, Stock: 10},
+		{Title: "Keyboard Cover", Description: "Silicone", CategoryID: categories[0].ID, Stock: 10},
+		{Title: "Kettle", Description: "Boils water for a wireless keyboard owner", CategoryID: categories[1].ID, Stock: 10},
+		{Title: "Blender", Description: "Smoothies", CategoryID: categories[1].ID, Stock: 10},
+	}
+	if err := db.Create(&products).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		query  string
+		offset int
+		limit  int
+		want   []string
+		total  int64
+	}{
+		{"titles before descriptions", "keyboard", 0, 10, []string{"Wireless Keyboard", "Keyboard Cover", "Kettle"}, 3},
+		{"every term has to match", "wireless keyboard", 0, 10, []string{"Wireless Keyboard", "Kettle"}, 2},
+		{"prefix while typing", "blen", 0, 10, []string{"Blender"}, 1},
+		{"typo in title", "kettel", 0, 10, []string{"Kettle"}, 1},
+		{"category type", "kitchen", 0, 10, []string{"Kettle", "Blender"}, 2},
+		{"page of results", "keyboard", 1, 1, []string{"Keyboard Cover"}, 3},
+		{"past the last page", "keyboard", 5, 10, nil, 3},
+		{"no match", "laptop", 0, 10, nil, 0},
+		{"no terms", "  -- ", 0, 10, nil, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results, total, err := SearchProducts(db, tt.query, tt.offset, tt.limit)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var titles []string
+			for _, result := range results {
+				titles = append(titles, result.Title)
+			}
+			if !reflect.DeepEqual(titles, tt.want) || total != tt.total {
+				t.Errorf("SearchProducts(%q) = %v, %d, want %v, %d", tt.query, titles, total, tt.want, tt.total)
+			}
+		})
+	}
+}
+
+func TestEditDistance(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"", "", 0},
+		{"kopi", "kopi", 0},
+		{"", "teh", 3},
+		{"teh", "", 3},
+		{"kopi", "kopo", 1},
+		{"kopi", "kop", 1},
+		{"kopi", "okpi", 2},
+		{"kitten", "sitting", 3},
+		{"café", "cafe", 1},
+	}
+	for _, tt := range tests {
+		if got := editDistance(tt.a, tt.b); got != tt.want {
+			t.Errorf("editDistance(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+		if got := editDistance(tt.b, tt.a); got != tt.want {
+			t.Errorf("editDistance(%q, %q) = %d, want %d", tt.b, tt.a, got, tt.want)
+		}
+	}
+}
+
+func TestMatchWord(t *testing.T) {
+	tests := []struct {
+		term, word string
+		want       float64
+	}{
+		{"kopi", "kopi", 1},
+		{"kop", "kopi", 0.8},
+		{"k", "kopi", 0.8},
+		{"kopu", "kopi", 0.5},
+		{"kpi", "kopi", 0.5},
+		{"kettel", "kettle", 0.5},     // two typos are allowed from six letters
+		{"keyboadr", "keyboard", 0.5}, // a swap is two edits
+		{"kupu", "kapi", 0},           // two typos in a short term
+		{"ko", "ka", 0},               // too short to allow a typo
+		{"kopi", "kop", 0.5},          // the word is shorter than the term
+		{"teh", "kopi", 0},
+	}
+	for _, tt := range tests {
+		if got := matchWord(tt.term, tt.word); got != tt.want {
+			t.Errorf("matchWord(%q, %q) = %v, want %v", tt.term, tt.word, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package helper
+
+import (
+	"errors"
+	"main/models"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrAddressRequired = errors.New("shipping address required")
+	ErrNoShippingRate  = errors.New("no shipping rate for province")
+)
+
+// ShippingWeight returns the weight charged for quantity units of a product:
+// the actual weight or, for bulky items, the volumetric weight
+// (length x width x height / 6000 in kilograms), whichever is higher.
+func ShippingWeight(product models.Product, quantity int) int {
+	weight := product.WeightGrams
+	volumetric := product.LengthCm * product.WidthCm * product.HeightCm / 6
+	if volumetric > weight {
+		weight = volumetric
+	}
+	return weight * quantity
+}
+
+// ShippingCost prices a parcel of weightGrams sent to province, in the base currency.
+func ShippingCost(db *gorm.DB, province string, weightGrams int) (int, error) {
+	rates, err := shippingRates(db, NormalizeProvince(province))
+	if err != nil {
+		return 0, err
+	}
+	if len(rates) == 0 {
+		if rates, err = shippingRates(db, "*"); err != nil {
+			return 0, err
+		}
+	}
+	if len(rates) == 0 {
+		return 0, ErrNoShippingRate
+	}
+
+	for _, rate := range rates {
+		if weightGrams <= rate.MaxWeightGrams {
+			return rate.Cost, nil
+		}
+	}
+
+	heaviest := rates[len(rates)-1]
+	extraKg := (weightGrams - heaviest.MaxWeightGrams + 999) / 1000
+	return heaviest.Cost + extraKg*heaviest.ExtraPerKg, nil
+}
+
+func shippingRates(db *gorm.DB, province string) ([]models.ShippingRate, error) {
+	var rates []models.ShippingRate
+	err := db.Where("province = ?", province).Order("max_weight_grams").Find(&rates).Error
+	return rates, err
+}
+
+// NormalizeProvince makes province names comparable regardless of case and spacing.
+func NormalizeProvince(province string) string {
+	return strings.ToUpper(strings.Join(strings.Fields(province), " "))
+}
+
+// ShippingAddress returns the address an order for userID ships to: the
+// given one, or the user's default address when addressID is 0.
+func ShippingAddress(db *gorm.DB, userID uint, addressID uint) (models.Address, error) {
+	var address models.Address
+	query := db.Where("user_id = ?", userID)
+	if addressID != 0 {
+		query = query.Where("id = ?", addressID)
+	} else {
+		query = query.Where("is_default = ?", true)
+	}
+	err := query.First(&address).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return address, ErrAddressRequired
+	}
+	return address, err
+}
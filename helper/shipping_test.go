@@ -0,0 +1,133 @@
+package helper
+
+import (
+	"errors"
+	"main/models"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+func TestShippingWeight(t *testing.T) {
+	tests := []struct {
+		name     string
+		product  models.Product
+		quantity int
+		want     int
+	}{
+		{"actual weight", models.Product{WeightGrams: 800, LengthCm: 10, WidthCm: 10, HeightCm: 10}, 1, 800},
+		{"volumetric weight of a bulky item", models.Product{WeightGrams: 500, LengthCm: 30, WidthCm: 20, HeightCm: 20}, 1, 2000},
+		{"per unit", models.Product{WeightGrams: 800}, 3, 2400},
+		{"no dimensions", models.Product{WeightGrams: 250}, 2, 500},
+		{"weightless", models.Product{}, 5, 0},
+	}
+	for _, tt := range tests {
+		if got := ShippingWeight(tt.product, tt.quantity); got != tt.want {
+			t.Errorf("%s: ShippingWeight = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func createShippingRates(t *testing.T, db *gorm.DB, rates ...models.ShippingRate) {
+	t.Helper()
+	if err := db.Create(&rates).Error; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestShippingCost(t *testing.T) {
+	db := openTestDB(t)
+	createShippingRates(t, db,
+		models.ShippingRate{Province: "JAWA BARAT", MaxWeightGrams: 1000, Cost: 10000},
+		models.ShippingRate{Province: "JAWA BARAT", MaxWeightGrams: 5000, Cost: 25000, ExtraPerKg: 5000},
+		models.ShippingRate{Province: "*", MaxWeightGrams: 1000, Cost: 30000, ExtraPerKg: 8000},
+	)
+
+	tests := []struct {
+		province string
+		weight   int
+		want     int
+	}{
+		{"JAWA BARAT", 0, 10000},
+		{"JAWA BARAT", 1000, 10000},
+		{"JAWA BARAT", 1001, 25000},
+		{"JAWA BARAT", 5000, 25000},
+		{"JAWA BARAT", 5001, 30000},
+		{"JAWA BARAT", 7500, 40000},
+		{"  jawa   barat ", 500, 10000},
+		{"BALI", 1000, 30000},
+		{"BALI", 2500, 46000},
+	}
+	for _, tt := range tests {
+		got, err := ShippingCost(db, tt.province, tt.weight)
+		if err != nil || got != tt.want {
+			t.Errorf("ShippingCost(%q, %d) = %d, %v, want %d", tt.province, tt.weight, got, err, tt.want)
+		}
+	}
+
+	if err := db.Where("province = ?", "*").Delete(&models.ShippingRate{}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ShippingCost(db, "BALI", 1000); !errors.Is(err, ErrNoShippingRate) {
+		t.Errorf("province without rates: %v, want ErrNoShippingRate", err)
+	}
+}
+
+func TestPurchaseShipping(t *testing.T) {
+	db := openTestDB(t)
+	createShippingRates(t, db, models.ShippingRate{Province: "JAWA BARAT", MaxWeightGrams: 1000, Cost: 10000, ExtraPerKg: 4000})
+	product := createTestProduct(t, db, models.Product{Title: "Kettle", Price: 20000, Stock: 10, WeightGrams: 1500})
+
+	// Without an address the order is not shipped.
+	unshipped := createTestUser(t, db, "digital@example.com", 100000)
+	result, err := buy(db, unshipped.ID, product.ID, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.ShippingCost != 0 || result.Order.ShipTo != "" || result.TotalPrice != 20000 {
+		t.Errorf("order without an address: shipping %d to %q, total %d", result.ShippingCost, result.Order.ShipTo, result.TotalPrice)
+	}
+
+	user := createTestUser(t, db, "shipped@example.com", 100000)
+	address := models.Address{
+		UserID: user.ID, RecipientName: "Ani", Phone: "0812", Street: "Jl. Merdeka 1",
+		City: "Bandung", Province: "JAWA BARAT", PostalCode: "40111", IsDefault: true,
+	}
+	if err := db.Create(&address).Error; err != nil {
+		t.Fatal(err)
+	}
+	result, err = buy(db, user.ID, product.ID, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.ShippingCost != 14000 || result.Order.AddressID != address.ID || result.Order.ShipTo == "" {
+		t.Errorf("order to the default address: shipping %d to address %d %q", result.ShippingCost, result.Order.AddressID, result.Order.ShipTo)
+	}
+	if result.TotalPrice != 34000 {
+		t.Errorf("total = %d, want 34000 with shipping", result.TotalPrice)
+	}
+
+	// An address that was asked for has to exist, and be one we ship to.
+	err = db.Transaction(func(tx *gorm.DB) error {
+		_, err := Purchase(tx, PurchaseRequest{UserID: unshipped.ID, AddressID: address.ID, Lines: []PurchaseLine{{ProductID: product.ID, Quantity: 1}}})
+		return err
+	})
+	if !errors.Is(err, ErrAddressRequired) {
+		t.Errorf("someone else's address: %v, want ErrAddressRequired", err)
+	}
+	if err := db.Model(&address).Update("province", "BALI").Error; err != nil {
+		t.Fatal(err)
+	}
+	if _, err := buy(db, user.ID, product.ID, 1); !errors.Is(err, ErrNoShippingRate) {
+		t.Errorf("province without rates: %v, want ErrNoShippingRate", err)
+	}
+
+	var current models.User
+	if err := db.First(&current, user.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if current.Balance != 100000-34000 {
+		t.Errorf("balance = %d, want %d", current.Balance, 100000-34000)
+	}
+	assertWalletsBalanced(t, db)
+}
@@ -0,0 +1,138 @@
+package helper
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"main/config"
+	"main/models"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	SubscriptionActive    = "active"
+	SubscriptionPaused    = "paused"
+	SubscriptionCancelled = "cancelled"
+)
+
+const NotificationSubscriptionFailed = "subscription_failed"
+
+// NextSubscriptionRun returns the first run of the subscription's schedule
+// after now, counting on from its current NextRunAt. Runs missed while it was
+// paused or could not be placed are not caught up on.
+func NextSubscriptionRun(subscription models.Subscription, now time.Time) time.Time {
+	next := subscription.NextRunAt
+	for !next.After(now) {
+		next = next.AddDate(0, 0, subscription.IntervalDays)
+	}
+	return next
+}
+
+// subscriptionFailure returns what to tell the customer when err stopped
+// their subscription order, or false for errors that are not theirs to fix,
+// which are retried on the next sweep instead.
+func subscriptionFailure(err error) (string, bool) {
+	switch {
+	case errors.Is(err, ErrInsufficientBalance):
+		return "your balance is too low", true
+	case errors.Is(err, ErrInsufficientStock):
+		return "it is out of stock", true
+	case errors.Is(err, ErrProductNotFound):
+		return "the product is no longer sold", true
+	case errors.Is(err, ErrAddressRequired):
+		return "the shipping address was not found", true
+	case errors.Is(err, ErrNoShippingRate):
+		return "we do not ship to your province", true
+	}
+	return "", false
+}
+
+// RunSubscriptions places the order of every active subscription due by now,
+// each in its own transaction, through the same purchase as CreateTransaction.
+// A subscription that fails for a reason other than the customer's is logged,
+// keeps the error in LastError and is tried again on the next run, without
+// holding up the ones after it.
+func RunSubscriptions(db *gorm.DB, tax *config.TaxConfig, loyalty *config.LoyaltyConfig, now time.Time) error {
+	var ids []uint
+	err := db.Model(&models.Subscription{}).
+		Where("status = ? AND next_run_at <= ?", SubscriptionActive, now).
+		Order("next_run_at").
+		Pluck("id", &ids).Error
+	if err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		err := runSubscription(db, id, tax, loyalty, now)
+		if err == nil {
+			continue
+		}
+		log.Printf("Failed to place the order of subscription %d: %v", id, err)
+		err = db.Model(&models.Subscription{}).Where("id = ?", id).Update("last_error", err.Error()).Error
+		if err != nil {
+			log.Printf("Failed to record the error of subscription %d: %v", id, err)
+		}
+	}
+	return nil
+}
+
+func runSubscription(db *gorm.DB, subscriptionID uint, tax *config.TaxConfig, loyalty *config.LoyaltyConfig, now time.Time) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		var subscription models.Subscription
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&subscription, subscriptionID).Error; err != nil {
+			return err
+		}
+		// Another sweep, a pause or a skip got there first
+		if subscription.Status != SubscriptionActive || subscription.NextRunAt.After(now) {
+			return nil
+		}
+
+		// The purchase runs in a savepoint so a failed order can be rolled
+		// back and still be recorded on the subscription.
+		var result *PurchaseResult
+		purchaseErr := tx.Transaction(func(tx *gorm.DB) error {
+			var err error
+			result, err = Purchase(tx, PurchaseRequest{
+				UserID:    subscription.UserID,
+				Lines:     []PurchaseLine{{ProductID: subscription.ProductID, Quantity: subscription.Quantity}},
+				AddressID: subscription.AddressID,
+				Tax:       tax,
+				Loyalty:   loyalty,
+			})
+			return err
+		})
+
+		updates := map[string]interface{}{
+			"next_run_at": NextSubscriptionRun(subscription, now),
+			"last_run_at": now,
+			"last_error":  "",
+		}
+		if purchaseErr != nil {
+			reason, ok := subscriptionFailure(purchaseErr)
+			if !ok {
+				return purchaseErr
+			}
+			updates["last_error"] = purchaseErr.Error()
+
+			var product models.Product
+			if err := tx.Unscoped().First(&product, subscription.ProductID).Error; err != nil {
+				return err
+			}
+			notification := models.Notification{
+				UserID:    subscription.UserID,
+				Type:      NotificationSubscriptionFailed,
+				ProductID: product.ID,
+				Message:   fmt.Sprintf("Your subscription order of %s could not be placed because %s", product.Title, reason),
+			}
+			if err := tx.Create(&notification).Error; err != nil {
+				return err
+			}
+		} else {
+			updates["last_order_id"] = result.Order.ID
+		}
+		return tx.Model(&subscription).Updates(updates).Error
+	})
+}
@@ -0,0 +1,33 @@
+package helper
+
+import (
+	"main/models"
+	"testing"
+	"time"
+)
+
+func TestNextSubscriptionRun(t *testing.T) {
+	day := func(d int, hour int) time.Time { return time.Date(2026, 1, d, hour, 0, 0, 0, time.UTC) }
+
+	tests := []struct {
+		name     string
+		next     time.Time
+		interval int
+		now      time.Time
+		want     time.Time
+	}{
+		{"due now", day(10, 9), 7, day(10, 9), day(17, 9)},
+		{"just overdue", day(10, 9), 7, day(10, 12), day(17, 9)},
+		{"missed runs are skipped", day(1, 9), 7, day(20, 9), day(22, 9)},
+		{"exactly on a later run", day(1, 9), 7, day(15, 9), day(22, 9)},
+		{"daily", day(1, 9), 1, day(5, 8), day(5, 9)},
+		{"across months", day(25, 9), 30, day(26, 9), time.Date(2026, 2, 24, 9, 0, 0, 0, time.UTC)},
+		{"not due yet", day(20, 9), 7, day(10, 9), day(20, 9)},
+	}
+	for _, tt := range tests {
+		subscription := models.Subscription{NextRunAt: tt.next, IntervalDays: tt.interval}
+		if got := NextSubscriptionRun(subscription, tt.now); !got.Equal(tt.want) {
+			t.Errorf("%s: NextSubscriptionRun = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package helper
+
+import (
+	"main/config"
+	"main/models"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// TaxedAmount is a purchase amount split into its untaxed part and the tax.
+type TaxedAmount struct {
+	Subtotal int
+	Tax      int
+	Total    int
+}
+
+// ApplyTax taxes amount at rate basis points. An amount that already includes
+// the tax is split, otherwise the tax is added on top. Tax is rounded half up.
+func ApplyTax(amount, rate int, included bool) TaxedAmount {
+	if included {
+		tax := (amount*rate*2 + 10000 + rate) / (2 * (10000 + rate))
+		return TaxedAmount{Subtotal: amount - tax, Tax: tax, Total: amount}
+	}
+	tax := (amount*rate*2 + 10000) / 20000
+	return TaxedAmount{Subtotal: amount, Tax: tax, Total: amount + tax}
+}
+
+// CategoryTaxRates returns the tax rate, in basis points, of each of the
+// given categories, using the default rate for those without a tax class.
+func CategoryTaxRates(db *gorm.DB, taxConfig *config.TaxConfig, categoryIDs []uint) (map[uint]int, error) {
+	var categories []models.Category
+	if err := db.Select("id", "tax_class_id").Find(&categories, categoryIDs).Error; err != nil {
+		return nil, err
+	}
+
+	var classIDs []uint
+	for _, category := range categories {
+		if category.TaxClassID != nil {
+			classIDs = append(classIDs, *category.TaxClassID)
+		}
+	}
+	classRates := make(map[uint]int)
+	if len(classIDs) > 0 {
+		var classes []models.TaxClass
+		if err := db.Find(&classes, classIDs).Error; err != nil {
+			return nil, err
+		}
+		for _, class := range classes {
+			classRates[class.ID] = class.Rate
+		}
+	}
+
+	rates := make(map[uint]int, len(categories))
+	for _, category := range categories {
+		rate := taxConfig.DefaultRate
+		if category.TaxClassID != nil {
+			if classRate, ok := classRates[*category.TaxClassID]; ok {
+				rate = classRate
+			}
+		}
+		rates[category.ID] = rate
+	}
+	return rates, nil
+}
+
+// FormatTaxRate renders basis points as a percentage, e.g. 1100 as "11%".
+func FormatTaxRate(rate int) string {
+	s := strconv.Itoa(rate/100) + "." + strconv.Itoa(rate%100/10) + strconv.Itoa(rate%10)
+	return strings.TrimSuffix(strings.TrimRight(s, "0"), ".") + "%"
+}
@@ -0,0 +1,50 @@
+package helper
+
+import "testing"
+
+func TestApplyTax(t *testing.T) {
+	tests := []struct {
+		amount   int
+		rate     int
+		included bool
+		want     TaxedAmount
+	}{
+		{10000, 1100, false, TaxedAmount{Subtotal: 10000, Tax: 1100, Total: 11100}},
+		{11100, 1100, true, TaxedAmount{Subtotal: 10000, Tax: 1100, Total: 11100}},
+		{10000, 0, false, TaxedAmount{Subtotal: 10000, Tax: 0, Total: 10000}},
+		{10000, 0, true, TaxedAmount{Subtotal: 10000, Tax: 0, Total: 10000}},
+		// 5 x 11% = 0.55 rounds up, 4 x 11% = 0.44 rounds down
+		{5, 1100, false, TaxedAmount{Subtotal: 5, Tax: 1, Total: 6}},
+		{4, 1100, false, TaxedAmount{Subtotal: 4, Tax: 0, Total: 4}},
+		// 150 x 10% = 15 exactly, 15 / 1.1 x 0.1 = 1.36 rounds down
+		{150, 1000, false, TaxedAmount{Subtotal: 150, Tax: 15, Total: 165}},
+		{15, 1000, true, TaxedAmount{Subtotal: 14, Tax: 1, Total: 15}},
+		// 11 / 1.1 x 0.1 = 1 exactly
+		{11, 1000, true, TaxedAmount{Subtotal: 10, Tax: 1, Total: 11}},
+		{0, 1100, true, TaxedAmount{}},
+	}
+	for _, tt := range tests {
+		if got := ApplyTax(tt.amount, tt.rate, tt.included); got != tt.want {
+			t.Errorf("ApplyTax(%d, %d, %v) = %+v, want %+v", tt.amount, tt.rate, tt.included, got, tt.want)
+		}
+	}
+}
+
+func TestFormatTaxRate(t *testing.T) {
+	tests := []struct {
+		rate int
+		want string
+	}{
+		{1100, "11%"},
+		{1000, "10%"},
+		{1150, "11.5%"},
+		{1125, "11.25%"},
+		{5, "0.05%"},
+		{0, "0%"},
+	}
+	for _, tt := range tests {
+		if got := FormatTaxRate(tt.rate); got != tt.want {
+			t.Errorf("FormatTaxRate(%d) = %q, want %q", tt.rate, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package helper
+
+import (
+	"main/models"
+
+	"gorm.io/gorm"
+)
+
+const (
+	NotificationPriceDrop   = "price_drop"
+	NotificationBackInStock = "back_in_stock"
+)
+
+// NotifyPriceDrop tells everyone who wishlisted product that its price went
+// down from oldPrice. Prices in different currencies are not compared.
+func NotifyPriceDrop(tx *gorm.DB, product models.Product, oldPrice models.Money) error {
+	price := product.PriceMoney()
+	if price.Currency != oldPrice.Currency || price.Amount >= oldPrice.Amount {
+		return nil
+	}
+	return notifyWishlisters(tx, product.ID, NotificationPriceDrop,
+		product.Title+" dropped in price from "+oldPrice.String()+" to "+price.String())
+}
+
+// NotifyBackInStock tells everyone who wishlisted product that it can be
+// bought again, when its stock went from oldStock of zero to something.
+func NotifyBackInStock(tx *gorm.DB, product models.Product, oldStock int) error {
+	if oldStock > 0 || product.Stock <= 0 {
+		return nil
+	}
+	return notifyWishlisters(tx, product.ID, NotificationBackInStock, product.Title+" is back in stock")
+}
+
+func notifyWishlisters(tx *gorm.DB, productID uint, notificationType string, message string) error {
+	var userIDs []uint
+	if err := tx.Model(&models.WishlistItem{}).Where("product_id = ?", productID).Pluck("user_id", &userIDs).Error; err != nil {
+		return err
+	}
+	if len(userIDs) == 0 {
+		return nil
+	}
+
+	notifications := make([]models.Notification, len(userIDs))
+	for i, userID := range userIDs {
+		notifications[i] = models.Notification{
+			UserID:    userID,
+			Type:      notificationType,
+			ProductID: productID,
+			Message:   message,
+		}
+	}
+	return tx.CreateInBatches(&notifications, 500).Error
+}
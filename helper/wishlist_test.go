@@ -0,0 +1,38 @@
+package helper
+
+import (
+	"main/models"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+func TestRefundNotifiesBackInStock(t *testing.T) {
+	db := openTestDB(t)
+	product := createTestProduct(t, db, models.Product{Title: "Last one", Price: 1000, Stock: 1})
+	buyer := createTestUser(t, db, "buyer@example.com", 1000)
+	watcher := createTestUser(t, db, "watcher@example.com", 0)
+	if err := db.Create(&models.WishlistItem{UserID: watcher.ID, ProductID: product.ID}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := buy(db, buyer.ID, product.ID, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		_, err := RefundTransaction(tx, result.Transactions[0].ID, 1, buyer.ID, "changed my mind")
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var notifications []models.Notification
+	if err := db.Where("user_id = ?", watcher.ID).Find(&notifications).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(notifications) != 1 || notifications[0].Type != NotificationBackInStock || notifications[0].Message != "Last one is back in stock" {
+		t.Errorf("notifications = %+v, want one back in stock", notifications)
+	}
+}
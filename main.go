@@ -4,8 +4,10 @@ import (
 	"log"
 	"main/config"
 	"main/handlers"
+	"main/helper"
 	"main/middleware"
 	"main/models"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/driver/postgres"
@@ -20,26 +22,180 @@ func main() {
 		log.Fatal("Failed to connect database", err)
 	}
 
-	err = db.AutoMigrate(&models.User{}, &models.Category{}, &models.Product{}, &models.TransactionHistory{})
+	err = db.AutoMigrate(
+		&models.User{},
+		&models.Category{},
+		&models.Product{},
+		&models.TransactionHistory{},
+		&models.PasswordReset{},
+		&models.WalletEntry{},
+		&models.JournalEntry{},
+		&models.JournalLine{},
+		&models.PaymentIntent{},
+		&models.IdempotencyKey{},
+		&models.Refund{},
+		&models.ExchangeRate{},
+		&models.CartItem{},
+		&models.Order{},
+		&models.OrderItem{},
+		&models.OrderStatusChange{},
+		&models.Address{},
+		&models.ShippingRate{},
+		&models.InvoiceSequence{},
+		&models.Coupon{},
+		&models.CouponRedemption{},
+		&models.Sale{},
+		&models.TaxClass{},
+		&models.PointEntry{},
+		&models.PointAllocation{},
+		&models.WishlistItem{},
+		&models.Notification{},
+		&models.Reservation{},
+		&models.GiftCard{},
+		&models.GiftCardAttempt{},
+		&models.SubscriptionPlan{},
+		&models.Subscription{},
+		&models.ProductReview{},
+	)
 	if err != nil {
 		log.Fatal("Failed to auto migrate", err)
 	}
+	if err := helper.SetupProductSearch(db); err != nil {
+		log.Fatal("Failed to set up product search", err)
+	}
+
+	passwordConfig := config.GetPasswordPolicyConfig()
+	passwordPolicy, err := helper.NewPasswordPolicy(passwordConfig)
+	if err != nil {
+		log.Fatal("Failed to load password policy", err)
+	}
+
+	mailer, err := helper.NewMailer(config.GetMailConfig())
+	if err != nil {
+		log.Fatal("Failed to set up mailer", err)
+	}
+
+	paymentConfig := config.GetPaymentConfig()
+	paymentProvider, err := helper.NewPaymentProvider(paymentConfig)
+	if err != nil {
+		log.Fatal("Failed to set up payment provider", err)
+	}
+
+	refundConfig := config.GetRefundConfig()
+	orderConfig := config.GetOrderConfig()
+	taxConfig := config.GetTaxConfig()
+	loyaltyConfig := config.GetLoyaltyConfig()
+	reservationConfig := config.GetReservationConfig()
+	giftCardConfig := config.GetGiftCardConfig()
+	subscriptionConfig := config.GetSubscriptionConfig()
+
+	idempotencyConfig := config.GetIdempotencyConfig()
+	idempotency := middleware.IdempotencyMiddleware(db, idempotencyConfig)
+
+	runEvery(idempotencyConfig.SweepInterval, "delete expired idempotency keys", func() error {
+		return middleware.DeleteExpiredIdempotencyKeys(db)
+	})
+	runEvery(paymentConfig.SweepInterval, "expire payment intents", func() error {
+		return helper.ExpirePaymentIntents(db)
+	})
+	runEvery(reservationConfig.SweepInterval, "expire stock reservations", func() error {
+		return helper.ExpireReservations(db, time.Now())
+	})
+	runEvery(reservationConfig.SweepInterval, "allocate released preorders", func() error {
+		return helper.ReleasePreorders(db, time.Now())
+	})
+	runEvery(loyaltyConfig.SweepInterval, "expire loyalty points", func() error {
+		return helper.ExpirePoints(db, time.Now())
+	})
+	runEvery(giftCardConfig.AttemptWindow, "delete old gift card attempts", func() error {
+		return helper.DeleteOldGiftCardAttempts(db, giftCardConfig)
+	})
+	runEvery(subscriptionConfig.SweepInterval, "place subscription orders", func() error {
+		return helper.RunSubscriptions(db, taxConfig, loyaltyConfig, time.Now())
+	})
 
 	r := gin.Default()
+	// Gift card attempt limits go by the client IP
+	if err := r.SetTrustedProxies(config.GetServerConfig().TrustedProxies); err != nil {
+		log.Fatal(err)
+	}
 
-	r.POST("/users/register", handlers.CreateUser(db))
+	r.POST("/users/register", handlers.CreateUser(db, passwordPolicy))
 	r.POST("/users/login", handlers.UserLogin(db))
+	r.POST("/users/password/forgot", handlers.ForgotPassword(db, passwordConfig.ResetTokenTTL, mailer))
+	r.POST("/users/password/reset", handlers.ResetPassword(db, passwordPolicy))
+	r.POST("/payments/webhook", handlers.PaymentWebhook(db, paymentProvider))
 	r.Use(middleware.TokenAuthMiddleware(db))
-	r.PATCH("/users/topup", handlers.UpdateBalance(db))
+	r.PATCH("/users/topup", idempotency, handlers.UpdateBalance(db, paymentProvider, paymentConfig.IntentTTL))
+	r.GET("/payments/:paymentId", handlers.GetPayment(db))
+	r.PATCH("/users/password", handlers.ChangePassword(db, passwordPolicy))
+	r.GET("/users/me/wallet/entries", handlers.GetWalletEntries(db))
+	r.GET("/users/me/points", handlers.GetPoints(db, loyaltyConfig))
+	r.POST("/users/me/gift-cards/redeem", idempotency, handlers.RedeemGiftCard(db, giftCardConfig))
+	r.GET("/users/me/addresses", handlers.GetAddresses(db))
+	r.POST("/users/me/addresses", handlers.CreateAddress(db))
+	r.PUT("/users/me/addresses/:addressId", handlers.UpdateAddress(db))
+	r.PATCH("/users/me/addresses/:addressId/default", handlers.SetDefaultAddress(db))
+	r.DELETE("/users/me/addresses/:addressId", handlers.DeleteAddress(db))
+	r.GET("/users/me/wishlist", handlers.GetWishlist(db))
+	r.POST("/users/me/wishlist", handlers.AddWishlistItem(db))
+	r.DELETE("/users/me/wishlist/:productId", handlers.RemoveWishlistItem(db))
+	r.GET("/users/me/notifications", handlers.GetNotifications(db))
+	r.PATCH("/users/me/notifications/:notificationId/read", handlers.MarkNotificationRead(db))
 	r.POST("/categories", middleware.AdminAuthMiddleware(), handlers.CreateCategory(db))
 	r.GET("/categories", middleware.AdminAuthMiddleware(), handlers.GetCategories(db))
 	r.PATCH("/categories/:categoryId", middleware.AdminAuthMiddleware(), handlers.UpdateCategory(db))
 	r.DELETE("/categories/:categoryId", middleware.AdminAuthMiddleware(), handlers.DeleteCategory(db))
 	r.POST("/products", middleware.AdminAuthMiddleware(), handlers.CreateProduct(db))
 	r.GET("/products", handlers.GetAllProducts(db))
+	r.GET("/products/search", handlers.SearchProducts(db))
+	r.GET("/products/:productId", handlers.GetProduct(db))
+	r.GET("/products/:productId/reviews", handlers.GetProductReviews(db))
+	r.POST("/products/:productId/reviews", handlers.ReviewProduct(db))
 	r.PUT("/products/:productId", middleware.AdminAuthMiddleware(), handlers.UpdateProduct(db))
 	r.DELETE("/products/:productId", middleware.AdminAuthMiddleware(), handlers.DeleteProduct(db))
-	r.POST("/transactions", handlers.CreateTransaction(db))
+	r.GET("/exchange-rates", middleware.AdminAuthMiddleware(), handlers.GetExchangeRates(db))
+	r.PUT("/exchange-rates", middleware.AdminAuthMiddleware(), handlers.SetExchangeRate(db))
+	r.GET("/shipping-rates", middleware.AdminAuthMiddleware(), handlers.GetShippingRates(db))
+	r.POST("/shipping-rates", middleware.AdminAuthMiddleware(), handlers.CreateShippingRate(db))
+	r.DELETE("/shipping-rates/:rateId", middleware.AdminAuthMiddleware(), handlers.DeleteShippingRate(db))
+	r.GET("/coupons", middleware.AdminAuthMiddleware(), handlers.GetCoupons(db))
+	r.POST("/coupons", middleware.AdminAuthMiddleware(), handlers.CreateCoupon(db))
+	r.PUT("/coupons/:couponId", middleware.AdminAuthMiddleware(), handlers.UpdateCoupon(db))
+	r.DELETE("/coupons/:couponId", middleware.AdminAuthMiddleware(), handlers.DeleteCoupon(db))
+	r.GET("/sales", middleware.AdminAuthMiddleware(), handlers.GetSales(db))
+	r.POST("/sales", middleware.AdminAuthMiddleware(), handlers.CreateSale(db))
+	r.PUT("/sales/:saleId", middleware.AdminAuthMiddleware(), handlers.UpdateSale(db))
+	r.DELETE("/sales/:saleId", middleware.AdminAuthMiddleware(), handlers.DeleteSale(db))
+	r.GET("/tax-classes", middleware.AdminAuthMiddleware(), handlers.GetTaxClasses(db))
+	r.POST("/tax-classes", middleware.AdminAuthMiddleware(), handlers.CreateTaxClass(db))
+	r.PUT("/tax-classes/:taxClassId", middleware.AdminAuthMiddleware(), handlers.UpdateTaxClass(db))
+	r.GET("/gift-cards", middleware.AdminAuthMiddleware(), handlers.GetGiftCards(db))
+	r.POST("/gift-cards", middleware.AdminAuthMiddleware(), handlers.IssueGiftCards(db, giftCardConfig))
+	r.GET("/subscription-plans", handlers.GetSubscriptionPlans(db))
+	r.POST("/subscription-plans", middleware.AdminAuthMiddleware(), handlers.CreateSubscriptionPlan(db))
+	r.PUT("/subscription-plans/:planId", middleware.AdminAuthMiddleware(), handlers.UpdateSubscriptionPlan(db))
+	r.GET("/subscriptions", handlers.GetSubscriptions(db))
+	r.POST("/subscriptions", handlers.CreateSubscription(db))
+	r.POST("/subscriptions/:subscriptionId/pause", handlers.PauseSubscription(db))
+	r.POST("/subscriptions/:subscriptionId/resume", handlers.ResumeSubscription(db))
+	r.POST("/subscriptions/:subscriptionId/skip", handlers.SkipSubscription(db))
+	r.POST("/subscriptions/:subscriptionId/cancel", handlers.CancelSubscription(db))
+	r.GET("/cart", handlers.GetCart(db))
+	r.POST("/cart/items", handlers.AddCartItem(db))
+	r.PATCH("/cart/items/:productId", handlers.UpdateCartItem(db))
+	r.DELETE("/cart/items/:productId", handlers.RemoveCartItem(db))
+	r.POST("/cart/checkout/start", handlers.StartCheckout(db, reservationConfig.TTL))
+	r.DELETE("/cart/checkout/start", handlers.CancelCheckout(db))
+	r.POST("/cart/checkout", idempotency, handlers.CheckoutCart(db, taxConfig, loyaltyConfig))
+	r.GET("/orders/my-orders", handlers.GetOrdersForUser(db))
+	r.GET("/orders/user-orders", middleware.AdminAuthMiddleware(), handlers.GetAllOrders(db))
+	r.GET("/orders/:orderId", handlers.GetOrder(db))
+	r.PATCH("/orders/:orderId/status", middleware.AdminAuthMiddleware(), handlers.UpdateOrderStatus(db))
+	r.POST("/orders/:orderId/cancel", handlers.CancelOrder(db, orderConfig.CustomerCancelWindow))
+	r.POST("/transactions", idempotency, handlers.CreateTransaction(db, taxConfig, loyaltyConfig))
+	r.POST("/transactions/:transactionId/refund", handlers.RefundTransaction(db, refundConfig.CustomerWindow))
+	r.GET("/transactions/:transactionId/invoice.pdf", handlers.GetTransactionInvoice(db, config.GetStoreConfig(), taxConfig))
 	r.GET("/transactions/my-transactions", handlers.GetTransactionHistoriesForUser(db))
 	r.GET("/transactions/user-transactions", middleware.AdminAuthMiddleware(), handlers.GetAllTransactionHistories(db))
 
@@ -47,3 +203,17 @@ func main() {
 		log.Fatal("Failed to run server:", err)
 	}
 }
+
+// runEvery runs job in the background on every tick of interval, logging
+// failures instead of stopping the server.
+func runEvery(interval time.Duration, name string, job func() error) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if err := job(); err != nil {
+				log.Println("Failed to", name+":", err)
+			}
+		}
+	}()
+}
@@ -0,0 +1,172 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log"
+	"main/config"
+	"main/models"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+type responseRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *responseRecorder) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *responseRecorder) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// IdempotencyMiddleware makes requests carrying an Idempotency-Key header safe
+// to retry. The first request with a key runs normally and its response is
+// stored; retries with the same key and body get the stored response back
+// without running the handler again. It must run after TokenAuthMiddleware
+// because keys are scoped per user.
+//
+// While the first request runs its key is only held for the processing
+// lease, so a request that never finishes does not block retries for the
+// whole replay window.
+func IdempotencyMiddleware(db *gorm.DB, cfg *config.IdempotencyConfig) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(IdempotencyKeyHeader)
+		if key == "" {
+			c.Next()
+			return
+		}
+		if len(key) > 255 {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Idempotency-Key must be at most 255 characters long"})
+			return
+		}
+
+		userID, exists := c.Get("userID")
+		if !exists {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized access"})
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Failed to read request body"})
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		sum := sha256.Sum256(append([]byte(c.Request.Method+" "+c.Request.URL.Path+"\n"), body...))
+		record := models.IdempotencyKey{
+			UserID:      userID.(uint),
+			Key:         key,
+			Method:      c.Request.Method,
+			Path:        c.Request.URL.Path,
+			Fingerprint: hex.EncodeToString(sum[:]),
+			ExpiresAt:   time.Now().Add(cfg.ProcessingLease),
+		}
+
+		claimed, existing, err := claimIdempotencyKey(db, &record)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to check Idempotency-Key"})
+			return
+		}
+
+		if !claimed {
+			switch {
+			case existing.Fingerprint != record.Fingerprint:
+				c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"error": "Idempotency-Key has already been used for a different request"})
+			case existing.StatusCode == 0:
+				c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": "A request with this Idempotency-Key is still being processed"})
+			default:
+				c.Header("Idempotent-Replayed", "true")
+				c.Data(existing.StatusCode, "application/json; charset=utf-8", existing.Response)
+				c.Abort()
+			}
+			return
+		}
+
+		// A handler that panics leaves no response to store, so the key is
+		// released for a retry before the panic carries on to the recovery
+		// middleware.
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				releaseIdempotencyKey(db, &record)
+				panic(recovered)
+			}
+		}()
+
+		recorder := &responseRecorder{ResponseWriter: c.Writer}
+		c.Writer = recorder
+		c.Next()
+
+		status := recorder.Status()
+		if status >= http.StatusInternalServerError {
+			// Server errors are not final, let the client retry them for real.
+			releaseIdempotencyKey(db, &record)
+			return
+		}
+		err = db.Model(&record).Updates(map[string]interface{}{
+			"status_code": status,
+			"response":    recorder.body.Bytes(),
+			"expires_at":  time.Now().Add(cfg.Window),
+		}).Error
+		if err != nil {
+			// Retries see the key as still processing until its lease runs out
+			log.Println("Failed to store response for Idempotency-Key", record.Key+":", err)
+		}
+	}
+}
+
+func releaseIdempotencyKey(db *gorm.DB, record *models.IdempotencyKey) {
+	if err := db.Delete(record).Error; err != nil {
+		log.Println("Failed to release Idempotency-Key", record.Key+":", err)
+	}
+}
+
+// claimIdempotencyKey inserts the record unless the key is already taken, in
+// which case the stored record is returned. Expired keys are replaced.
+func claimIdempotencyKey(db *gorm.DB, record *models.IdempotencyKey) (bool, *models.IdempotencyKey, error) {
+	for attempt := 0; attempt < 2; attempt++ {
+		result := db.Clauses(clause.OnConflict{DoNothing: true}).Create(record)
+		if result.Error != nil {
+			return false, nil, result.Error
+		}
+		if result.RowsAffected == 1 {
+			return true, nil, nil
+		}
+
+		var existing models.IdempotencyKey
+		err := db.Where("user_id = ? AND key = ?", record.UserID, record.Key).First(&existing).Error
+		if err == gorm.ErrRecordNotFound {
+			continue
+		}
+		if err != nil {
+			return false, nil, err
+		}
+		if existing.ExpiresAt.After(time.Now()) {
+			return false, &existing, nil
+		}
+		if err := db.Delete(&existing).Error; err != nil {
+			return false, nil, err
+		}
+		record.ID = 0
+	}
+	return false, nil, gorm.ErrDuplicatedKey
+}
+
+// DeleteExpiredIdempotencyKeys removes keys whose replay window has passed.
+func DeleteExpiredIdempotencyKeys(db *gorm.DB) error {
+	return db.Where("expires_at < ?", time.Now()).Delete(&models.IdempotencyKey{}).Error
+}
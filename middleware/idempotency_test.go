@@ -0,0 +1,192 @@
+package middleware
+
+import (
+	"bytes"
+	"main/config"
+	"main/models"
+	"main/testdb"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// newIdempotencyRouter serves POST /orders and /other behind the idempotency
+// middleware for the user in the X-Test-User header. Each call to handler
+// decides the response of one request that got through.
+func newIdempotencyRouter(db *gorm.DB, handler gin.HandlerFunc) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(gin.CustomRecovery(func(c *gin.Context, recovered interface{}) {
+		c.AbortWithStatus(http.StatusInternalServerError)
+	}))
+	r.Use(func(c *gin.Context) {
+		if id, err := strconv.ParseUint(c.GetHeader("X-Test-User"), 10, 64); err == nil {
+			c.Set("userID", uint(id))
+		}
+	})
+	r.Use(IdempotencyMiddleware(db, &config.IdempotencyConfig{Window: time.Hour, ProcessingLease: time.Minute}))
+	r.POST("/orders", handler)
+	r.POST("/other", handler)
+	return r
+}
+
+func post(r http.Handler, path string, userID uint, key, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, path, bytes.NewBufferString(body))
+	req.Header.Set("X-Test-User", strconv.FormatUint(uint64(userID), 10))
+	if key != "" {
+		req.Header.Set(IdempotencyKeyHeader, key)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestIdempotencyReplay(t *testing.T) {
+	db := testdb.Open(t)
+	calls := 0
+	r := newIdempotencyRouter(db, func(c *gin.Context) {
+		calls++
+		c.JSON(http.StatusCreated, gin.H{"order": calls})
+	})
+
+	first := post(r, "/orders", 1, "key-1", `{"product_id":1}`)
+	second := post(r, "/orders", 1, "key-1", `{"product_id":1}`)
+	if calls != 1 {
+		t.Fatalf("handler ran %d times, want 1", calls)
+	}
+	if second.Code != first.Code || second.Body.String() != first.Body.String() {
+		t.Errorf("replay = %d %s, want %d %s", second.Code, second.Body, first.Code, first.Body)
+	}
+	if second.Header().Get("Idempotent-Replayed") != "true" {
+		t.Error("replay is missing the Idempotent-Replayed header")
+	}
+	if first.Header().Get("Idempotent-Replayed") != "" {
+		t.Error("first response is marked as replayed")
+	}
+
+	// Keys belong to a user, and requests without one are never deduplicated.
+	if w := post(r, "/orders", 2, "key-1", `{"product_id":1}`); w.Code != http.StatusCreated || calls != 2 {
+		t.Errorf("same key for another user: %d, %d calls", w.Code, calls)
+	}
+	post(r, "/orders", 1, "", `{"product_id":1}`)
+	post(r, "/orders", 1, "", `{"product_id":1}`)
+	if calls != 4 {
+		t.Errorf("handler ran %d times, want 4", calls)
+	}
+}
+
+func TestIdempotencyKeyReusedForAnotherRequest(t *testing.T) {
+	db := testdb.Open(t)
+	calls := 0
+	r := newIdempotencyRouter(db, func(c *gin.Context) {
+		calls++
+		c.JSON(http.StatusCreated, gin.H{})
+	})
+
+	post(r, "/orders", 1, "key-1", `{"product_id":1}`)
+	if w := post(r, "/orders", 1, "key-1", `{"product_id":2}`); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("different body: %d %s, want 422", w.Code, w.Body)
+	}
+	if w := post(r, "/other", 1, "key-1", `{"product_id":1}`); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("different path: %d %s, want 422", w.Code, w.Body)
+	}
+	if calls != 1 {
+		t.Errorf("handler ran %d times, want 1", calls)
+	}
+}
+
+func TestIdempotencyKeyReleased(t *testing.T) {
+	tests := []struct {
+		name  string
+		first func(c *gin.Context)
+	}{
+		{"after a server error", func(c *gin.Context) {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "try again"})
+		}},
+		{"after a panic", func(c *gin.Context) {
+			panic("handler failed")
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := testdb.Open(t)
+			calls := 0
+			r := newIdempotencyRouter(db, func(c *gin.Context) {
+				calls++
+				if calls == 1 {
+					tt.first(c)
+					return
+				}
+				c.JSON(http.StatusCreated, gin.H{})
+			})
+
+			if w := post(r, "/orders", 1, "key-1", `{}`); w.Code < http.StatusInternalServerError {
+				t.Fatalf("first request: %d, want a server error", w.Code)
+			}
+			w := post(r, "/orders", 1, "key-1", `{}`)
+			if w.Code != http.StatusCreated || calls != 2 {
+				t.Errorf("retry: %d after %d calls, want the handler to run again", w.Code, calls)
+			}
+		})
+	}
+}
+
+func TestIdempotencyKeyStillProcessing(t *testing.T) {
+	db := testdb.Open(t)
+	started := make(chan struct{})
+	finish := make(chan struct{})
+	r := newIdempotencyRouter(db, func(c *gin.Context) {
+		close(started)
+		<-finish
+		c.JSON(http.StatusCreated, gin.H{})
+	})
+
+	done := make(chan *httptest.ResponseRecorder)
+	go func() { done <- post(r, "/orders", 1, "key-1", `{}`) }()
+	<-started
+	if w := post(r, "/orders", 1, "key-1", `{}`); w.Code != http.StatusConflict {
+		t.Errorf("retry while processing: %d %s, want 409", w.Code, w.Body)
+	}
+	close(finish)
+	if w := <-done; w.Code != http.StatusCreated {
+		t.Errorf("first request: %d %s", w.Code, w.Body)
+	}
+
+	var record models.IdempotencyKey
+	if err := db.Where("user_id = ? AND key = ?", 1, "key-1").First(&record).Error; err != nil {
+		t.Fatal(err)
+	}
+	if until := time.Until(record.ExpiresAt); until < 50*time.Minute {
+		t.Errorf("stored response expires in %v, want the replay window", until)
+	}
+}
+
+func TestIdempotencyProcessingLeaseExpired(t *testing.T) {
+	db := testdb.Open(t)
+	// A request that was still running when its server died.
+	abandoned := models.IdempotencyKey{
+		UserID:      1,
+		Key:         "key-1",
+		Method:      http.MethodPost,
+		Path:        "/orders",
+		Fingerprint: "abandoned",
+		ExpiresAt:   time.Now().Add(-time.Second),
+	}
+	if err := db.Create(&abandoned).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	calls := 0
+	r := newIdempotencyRouter(db, func(c *gin.Context) {
+		calls++
+		c.JSON(http.StatusCreated, gin.H{})
+	})
+	if w := post(r, "/orders", 1, "key-1", `{}`); w.Code != http.StatusCreated || calls != 1 {
+		t.Errorf("retry after the lease: %d after %d calls, want the handler to run", w.Code, calls)
+	}
+}
@@ -1,6 +1,7 @@
 package models
 
 import (
+	"errors"
 	"time"
 
 	"gorm.io/gorm"
@@ -13,42 +14,557 @@ type User struct {
 	Email     string    `validate:"required,email" json:"email" `
 	Password  string    `json:"password" validate:"required,min=6"`
 	Role      string    `json:"role" validate:"required,oneof=admin customer"`
-	Balance   int       `json:"balance" validate:"required,min=0,max=100000000"`
+	Balance   int       `gorm:"check:chk_users_balance,balance >= 0" json:"balance" validate:"required,min=0,max=100000000"`
+	Points    int       `gorm:"check:chk_users_points,points >= 0" json:"points" validate:"-"` // loyalty points, cached from the points ledger
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 }
 
+// Product rows also have a search_vector column that database triggers keep
+// up to date, see helper.SetupProductSearch. It is left out of the struct so
+// saving a product never overwrites it.
 type Product struct {
 	gorm.Model
-	ID         uint      `gorm:"primaryKey" json:"id" validate:"-"`
-	Title      string    `json:"title" validate:"required"`
-	Price      int       `json:"price" validate:"required,min=0,max=50000000"`
-	Stock      int       `json:"stock" validate:"required,min=5"`
-	CategoryID uint      `json:"category_id" validate:"-"`
-	Category   Category  `gorm:"foreignKey:CategoryID;references:ID"`
-	CreatedAt  time.Time `json:"created_at" validate:"-"`
-	UpdatedAt  time.Time `json:"updated_at" validate:"-"`
+	ID          uint   `gorm:"primaryKey" json:"id" validate:"-"`
+	Title       string `json:"title" validate:"required"`
+	Description string `json:"description" validate:"-"`
+	Price       int    `json:"price" validate:"required,min=0,max=50000000"` // minor units of Currency
+	Currency    string `gorm:"size:3;default:IDR" json:"currency" validate:"-"`
+	Stock       int    `gorm:"check:chk_products_stock,stock >= 0" json:"stock" validate:"required,min=5"`
+	Reserved    int    `gorm:"check:chk_products_reserved,reserved >= 0" json:"reserved" validate:"-"` // held by active reservations
+	// BackorderMode lets the product be bought beyond its stock, labelled
+	// "backorder" for restocks and "preorder" for products not released yet.
+	// Empty means only what is in stock can be bought.
+	BackorderMode string     `json:"backorder_mode" validate:"-"`
+	AvailableAt   *time.Time `json:"available_at" validate:"-"` // when backordered units are expected, preorders hold all stock until then
+	CategoryID    uint       `json:"category_id" validate:"-"`
+	Category      Category   `gorm:"foreignKey:CategoryID;references:ID"`
+	WeightGrams   int        `json:"weight_grams" validate:"-"` // weight and dimensions price shipping
+	LengthCm      int        `json:"length_cm" validate:"-"`
+	WidthCm       int        `json:"width_cm" validate:"-"`
+	HeightCm      int        `json:"height_cm" validate:"-"`
+	CreatedAt     time.Time  `json:"created_at" validate:"-"`
+	UpdatedAt     time.Time  `json:"updated_at" validate:"-"`
+}
+
+// AvailableStock is the stock that is not held for someone's checkout.
+func (p Product) AvailableStock() int {
+	if p.Reserved >= p.Stock {
+		return 0
+	}
+	return p.Stock - p.Reserved
+}
+
+func (p Product) PriceMoney() Money {
+	if p.Currency == "" {
+		return NewMoney(p.Price, BaseCurrency)
+	}
+	return NewMoney(p.Price, p.Currency)
 }
 
 type Category struct {
 	gorm.Model
 	ID                uint      `gorm:"primaryKey" json:"id"`
 	Type              string    `json:"type" validate:"required"`
-	SoldProductAmount int       `json:"sold_product_amount" validate:"-"`
+	SoldProductAmount int       `gorm:"check:chk_categories_sold_product_amount,sold_product_amount >= 0" json:"sold_product_amount" validate:"-"`
+	TaxClassID        *uint     `json:"tax_class_id" validate:"-"` // nil uses the default tax rate
 	CreatedAt         time.Time `json:"created_at" validate:"-"`
 	UpdatedAt         time.Time `json:"updated_at" validate:"-"`
 	Products          []Product `gorm:"foreignKey:CategoryID"`
 }
 
 type TransactionHistory struct {
+	gorm.Model
+	ID            uint   `gorm:"primaryKey" json:"id"`
+	ProductID     uint   `json:"product_id" validate:"required"`
+	UserID        uint   `json:"user_id"`
+	OrderID       uint   `gorm:"index" json:"order_id"`
+	InvoiceNumber string `gorm:"index" json:"invoice_number"`
+	Quantity      int    `json:"quantity" validate:"required"`
+	UnitPrice     int    `json:"unit_price"` // product price at purchase time, in Currency
+	ListPrice     int    `json:"list_price"` // UnitPrice before any sale, in Currency
+	Discount      int    `json:"discount"`   // coupon and points discount taken off TotalPrice
+	PointsEarned  int    `json:"points_earned"`
+	// BackorderedQuantity units were bought beyond stock and are still
+	// waiting to be allocated from new stock.
+	BackorderedQuantity int       `json:"backordered_quantity"`
+	Currency            string    `gorm:"size:3;default:IDR" json:"currency"` // currency the product was priced in
+	Subtotal            int       `json:"subtotal"`                           // amount charged without tax, in BaseCurrency
+	Tax                 int       `json:"tax"`
+	TaxRate             int       `json:"tax_rate"`                        // basis points
+	TaxIncluded         bool      `json:"tax_included"`                    // whether the price already contained the tax
+	TotalPrice          int       `json:"total_price" validate:"required"` // amount charged, in BaseCurrency
+	RefundedQuantity    int       `json:"refunded_quantity"`
+	RefundedAmount      int       `json:"refunded_amount"`
+	CreatedAt           time.Time `json:"created_at"`
+	UpdatedAt           time.Time `json:"updated_at"`
+	Product             Product   `gorm:"foreignKey:ProductID;references:ID"`
+	User                User      `gorm:"foreignKey:UserID;references:ID"`
+}
+
+func (u User) BalanceMoney() Money {
+	return NewMoney(u.Balance, BaseCurrency)
+}
+
+func (t TransactionHistory) TotalPriceMoney() Money {
+	return NewMoney(t.TotalPrice, BaseCurrency)
+}
+
+func (t TransactionHistory) UnitPriceMoney() Money {
+	if t.Currency == "" {
+		return NewMoney(t.UnitPrice, BaseCurrency)
+	}
+	return NewMoney(t.UnitPrice, t.Currency)
+}
+
+// GrossMoney is the line total before the coupon and points discount and
+// without tax, as listed on invoices.
+func (t TransactionHistory) GrossMoney() Money {
+	gross := NewMoney(t.TotalPrice+t.Discount, BaseCurrency)
+	if !t.TaxIncluded {
+		gross.Amount -= t.Tax
+	}
+	return gross
+}
+
+// ExchangeRate converts one unit of From into Rate units of To. Rate is kept
+// as an exact decimal rather than a float.
+type ExchangeRate struct {
+	gorm.Model
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	From      string    `gorm:"size:3;uniqueIndex:idx_exchange_rates_pair" json:"from"`
+	To        string    `gorm:"size:3;uniqueIndex:idx_exchange_rates_pair" json:"to"`
+	Rate      string    `gorm:"type:numeric(24,12)" json:"rate"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type PasswordReset struct {
+	gorm.Model
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	UserID    uint       `gorm:"index" json:"user_id"`
+	TokenHash string     `gorm:"uniqueIndex" json:"-"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
+// WalletEntry is an immutable line in a user's wallet ledger. The sum of a
+// user's entries is their balance; User.Balance is only a cached copy of the
+// latest BalanceAfter. Every entry is also posted to the journal as a
+// balanced JournalEntry.
+type WalletEntry struct {
+	ID             uint      `gorm:"primaryKey" json:"id"`
+	UserID         uint      `gorm:"uniqueIndex:idx_wallet_entries_user_sequence" json:"user_id"`
+	Sequence       int       `gorm:"uniqueIndex:idx_wallet_entries_user_sequence" json:"sequence"`
+	JournalEntryID uint      `gorm:"index" json:"journal_entry_id"`
+	Type           string    `gorm:"index" json:"type"`
+	Amount         int       `json:"amount"`
+	BalanceAfter   int       `gorm:"check:chk_wallet_entries_balance_after,balance_after >= 0" json:"balance_after"`
+	ReferenceType  string    `json:"reference_type"`
+	ReferenceID    uint      `json:"reference_id"`
+	Description    string    `json:"description"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+var ErrImmutableWalletEntry = errors.New("wallet entries cannot be changed once written")
+
+func (WalletEntry) BeforeUpdate(*gorm.DB) error {
+	return ErrImmutableWalletEntry
+}
+
+func (WalletEntry) BeforeDelete(*gorm.DB) error {
+	return ErrImmutableWalletEntry
+}
+
+// JournalEntry is one money movement in the double-entry journal. Its lines
+// sum to zero: what one account is debited another is credited.
+type JournalEntry struct {
+	ID            uint          `gorm:"primaryKey" json:"id"`
+	Type          string        `gorm:"index" json:"type"`
+	ReferenceType string        `json:"reference_type"`
+	ReferenceID   uint          `json:"reference_id"`
+	Description   string        `json:"description"`
+	Lines         []JournalLine `json:"lines"`
+	CreatedAt     time.Time     `json:"created_at"`
+}
+
+// JournalLine debits an account with a positive Amount and credits it with a
+// negative one. Customer wallets share one account told apart by UserID.
+type JournalLine struct {
+	ID             uint      `gorm:"primaryKey" json:"id"`
+	JournalEntryID uint      `gorm:"index" json:"journal_entry_id"`
+	Account        string    `gorm:"index:idx_journal_lines_account_user" json:"account"`
+	UserID         *uint     `gorm:"index:idx_journal_lines_account_user" json:"user_id"`
+	Amount         int       `json:"amount"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+var ErrImmutableJournal = errors.New("journal entries cannot be changed once written")
+
+func (JournalEntry) BeforeUpdate(*gorm.DB) error {
+	return ErrImmutableJournal
+}
+
+func (JournalEntry) BeforeDelete(*gorm.DB) error {
+	return ErrImmutableJournal
+}
+
+func (JournalLine) BeforeUpdate(*gorm.DB) error {
+	return ErrImmutableJournal
+}
+
+func (JournalLine) BeforeDelete(*gorm.DB) error {
+	return ErrImmutableJournal
+}
+
+type PaymentIntent struct {
+	gorm.Model
+	ID            uint       `gorm:"primaryKey" json:"id"`
+	UserID        uint       `gorm:"index" json:"user_id"`
+	Provider      string     `gorm:"uniqueIndex:idx_payment_intents_provider_external" json:"provider"`
+	ExternalID    string     `gorm:"uniqueIndex:idx_payment_intents_provider_external" json:"external_id"`
+	Amount        int        `json:"amount"`
+	Status        string     `gorm:"index" json:"status"`
+	PaymentURL    string     `json:"payment_url"`
+	FailureReason string     `json:"failure_reason"`
+	ExpiresAt     time.Time  `json:"expires_at"`
+	SettledAt     *time.Time `json:"settled_at"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
+
+type IdempotencyKey struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	UserID      uint      `gorm:"uniqueIndex:idx_idempotency_keys_user_key" json:"user_id"`
+	Key         string    `gorm:"uniqueIndex:idx_idempotency_keys_user_key;size:255" json:"key"`
+	Method      string    `json:"method"`
+	Path        string    `json:"path"`
+	Fingerprint string    `json:"fingerprint"`
+	StatusCode  int       `json:"status_code"` // 0 while the first request is still running
+	Response    []byte    `json:"-"`
+	ExpiresAt   time.Time `gorm:"index" json:"expires_at"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+type Refund struct {
+	gorm.Model
+	ID                   uint               `gorm:"primaryKey" json:"id"`
+	TransactionHistoryID uint               `gorm:"index" json:"transaction_id"`
+	UserID               uint               `gorm:"index" json:"user_id"`
+	RefundedBy           uint               `json:"refunded_by"`
+	Quantity             int                `json:"quantity"`
+	Amount               int                `json:"amount"`
+	Reason               string             `json:"reason"`
+	CreatedAt            time.Time          `json:"created_at"`
+	UpdatedAt            time.Time          `json:"updated_at"`
+	TransactionHistory   TransactionHistory `gorm:"foreignKey:TransactionHistoryID;references:ID" json:"-"`
+}
+
+type CartItem struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	UserID    uint      `gorm:"uniqueIndex:idx_cart_items_user_product" json:"user_id"`
+	ProductID uint      `gorm:"uniqueIndex:idx_cart_items_user_product" json:"product_id"`
+	Quantity  int       `gorm:"check:chk_cart_items_quantity,quantity > 0" json:"quantity"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Product   Product   `gorm:"foreignKey:ProductID;references:ID" json:"-"`
+}
+
+type Order struct {
+	gorm.Model
+	ID            uint                `gorm:"primaryKey" json:"id"`
+	UserID        uint                `gorm:"index" json:"user_id"`
+	Status        string              `gorm:"index" json:"status"`
+	InvoiceNumber string              `gorm:"uniqueIndex:idx_orders_invoice_number,where:invoice_number <> ''" json:"invoice_number"`
+	TotalPrice    int                 `json:"total_price"` // items less discounts, with tax, plus shipping
+	Subtotal      int                 `json:"subtotal"`    // items before discounts
+	Discount      int                 `json:"discount"`
+	Tax           int                 `json:"tax"`
+	PointsUsed    int                 `json:"points_used"`
+	PointsEarned  int                 `json:"points_earned"`
+	CouponID      uint                `json:"coupon_id"`
+	CouponCode    string              `json:"coupon_code"`
+	ShippingCost  int                 `json:"shipping_cost"`
+	AddressID     uint                `json:"address_id"`
+	ShipTo        string              `json:"ship_to"` // address as it was when ordering
+	PaidAt        *time.Time          `json:"paid_at"`
+	ProcessingAt  *time.Time          `json:"processing_at"`
+	ShippedAt     *time.Time          `json:"shipped_at"`
+	DeliveredAt   *time.Time          `json:"delivered_at"`
+	CancelledAt   *time.Time          `json:"cancelled_at"`
+	RefundedAt    *time.Time          `json:"refunded_at"`
+	CancelReason  string              `json:"cancel_reason"`
+	CreatedAt     time.Time           `json:"created_at"`
+	UpdatedAt     time.Time           `json:"updated_at"`
+	Items         []OrderItem         `gorm:"foreignKey:OrderID" json:"items"`
+	StatusHistory []OrderStatusChange `gorm:"foreignKey:OrderID" json:"status_history"`
+	User          User                `gorm:"foreignKey:UserID;references:ID" json:"-"`
+}
+
+type OrderItem struct {
+	ID                   uint      `gorm:"primaryKey" json:"id"`
+	OrderID              uint      `gorm:"index" json:"order_id"`
+	ProductID            uint      `json:"product_id"`
+	TransactionHistoryID uint      `gorm:"index" json:"transaction_id"`
+	Title                string    `json:"title"`
+	Quantity             int       `json:"quantity"`
+	UnitPrice            int       `json:"unit_price"`
+	Currency             string    `gorm:"size:3" json:"currency"`
+	TotalPrice           int       `json:"total_price"`
+	CreatedAt            time.Time `json:"created_at"`
+}
+
+func (o Order) TotalPriceMoney() Money {
+	return NewMoney(o.TotalPrice, BaseCurrency)
+}
+
+func (o Order) ShippingCostMoney() Money {
+	return NewMoney(o.ShippingCost, BaseCurrency)
+}
+
+func (i OrderItem) UnitPriceMoney() Money {
+	return NewMoney(i.UnitPrice, i.Currency)
+}
+
+type OrderStatusChange struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	OrderID    uint      `gorm:"index" json:"order_id"`
+	FromStatus string    `json:"from_status"`
+	ToStatus   string    `json:"to_status"`
+	ChangedBy  uint      `json:"changed_by"`
+	Note       string    `json:"note"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+type Address struct {
+	gorm.Model
+	ID            uint      `gorm:"primaryKey" json:"id"`
+	UserID        uint      `gorm:"index" json:"user_id"`
+	Label         string    `json:"label" validate:"max=50"`
+	RecipientName string    `json:"recipient_name" validate:"required"`
+	Phone         string    `json:"phone" validate:"required,max=20"`
+	Street        string    `json:"street" validate:"required"`
+	City          string    `json:"city" validate:"required"`
+	Province      string    `json:"province" validate:"required"`
+	PostalCode    string    `json:"postal_code" validate:"required,max=10"`
+	IsDefault     bool      `json:"is_default"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+func (a Address) String() string {
+	return a.RecipientName + " (" + a.Phone + "), " + a.Street + ", " + a.City + ", " + a.Province + " " + a.PostalCode
+}
+
+// ShippingRate prices parcels sent to a province up to MaxWeightGrams. The
+// heaviest tier of a province also covers heavier parcels, adding ExtraPerKg
+// for every started kilogram above it. Province "*" applies to provinces
+// without rates of their own.
+type ShippingRate struct {
+	gorm.Model
+	ID             uint      `gorm:"primaryKey" json:"id"`
+	Province       string    `gorm:"uniqueIndex:idx_shipping_rates_province_weight" json:"province" validate:"required"`
+	MaxWeightGrams int       `gorm:"uniqueIndex:idx_shipping_rates_province_weight" json:"max_weight_grams" validate:"required,min=1"`
+	Cost           int       `json:"cost" validate:"min=0"`
+	ExtraPerKg     int       `json:"extra_per_kg" validate:"min=0"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// InvoiceSequence holds the last invoice number handed out in a month.
+type InvoiceSequence struct {
+	Period     string `gorm:"primaryKey;size:7"` // e.g. 2026/10
+	LastNumber int
+}
+
+type Coupon struct {
+	gorm.Model
+	ID           uint       `gorm:"primaryKey" json:"id"`
+	Code         string     `gorm:"uniqueIndex" json:"code"`
+	Type         string     `json:"type"`  // percentage or fixed
+	Value        int        `json:"value"` // percent, or amount in BaseCurrency
+	MinPurchase  int        `json:"min_purchase"`
+	MaxDiscount  int        `json:"max_discount"` // 0 means no cap
+	StartsAt     *time.Time `json:"starts_at"`
+	EndsAt       *time.Time `json:"ends_at"`
+	UsageLimit   int        `json:"usage_limit"`    // 0 means unlimited
+	PerUserLimit int        `json:"per_user_limit"` // 0 means unlimited
+	UsedCount    int        `json:"used_count"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+	// A coupon restricted to categories or products only discounts those.
+	Categories []Category `gorm:"many2many:coupon_categories" json:"-"`
+	Products   []Product  `gorm:"many2many:coupon_products" json:"-"`
+}
+
+type CouponRedemption struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CouponID  uint      `gorm:"index" json:"coupon_id"`
+	UserID    uint      `gorm:"index" json:"user_id"`
+	OrderID   uint      `gorm:"index" json:"order_id"`
+	Discount  int       `json:"discount"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Sale takes Percent off the price of a product, or of every product in a
+// category, between StartsAt and EndsAt.
+type Sale struct {
 	gorm.Model
 	ID         uint      `gorm:"primaryKey" json:"id"`
-	ProductID  uint      `json:"product_id" validate:"required"`
-	UserID     uint      `json:"user_id"`
-	Quantity   int       `json:"quantity" validate:"required"`
-	TotalPrice int       `json:"total_price" validate:"required"`
+	Name       string    `json:"name"`
+	Percent    int       `gorm:"check:chk_sales_percent,percent > 0 AND percent <= 100" json:"percent"`
+	CategoryID uint      `gorm:"index" json:"category_id"` // 0 unless the sale covers a category
+	ProductID  uint      `gorm:"index" json:"product_id"`  // 0 unless the sale covers a product
+	StartsAt   time.Time `gorm:"index" json:"starts_at"`
+	EndsAt     time.Time `gorm:"index" json:"ends_at"`
 	CreatedAt  time.Time `json:"created_at"`
 	UpdatedAt  time.Time `json:"updated_at"`
-	Product    Product   `gorm:"foreignKey:ProductID;references:ID"`
-	User       User      `gorm:"foreignKey:UserID;references:ID"`
+}
+
+// TaxClass sets the tax rate of the categories assigned to it. A rate of 0
+// makes them exempt.
+type TaxClass struct {
+	gorm.Model
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	Name      string    `gorm:"uniqueIndex" json:"name"`
+	Rate      int       `gorm:"check:chk_tax_classes_rate,rate >= 0" json:"rate"` // basis points, 1100 is 11%
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// PointEntry is a line in a user's loyalty points ledger. Entries that add
+// points are lots that expire at ExpiresAt; Remaining is what is left of the
+// lot after points were spent from it, and is the only column that changes
+// once written. The remaining points of a user's lots always add up to the
+// BalanceAfter of their latest entry.
+type PointEntry struct {
+	ID            uint       `gorm:"primaryKey" json:"id"`
+	UserID        uint       `gorm:"uniqueIndex:idx_point_entries_user_sequence" json:"user_id"`
+	Sequence      int        `gorm:"uniqueIndex:idx_point_entries_user_sequence" json:"sequence"`
+	Type          string     `gorm:"index" json:"type"`
+	Points        int        `json:"points"`
+	BalanceAfter  int        `gorm:"check:chk_point_entries_balance_after,balance_after >= 0" json:"balance_after"`
+	Remaining     int        `gorm:"check:chk_point_entries_remaining,remaining >= 0" json:"-"`
+	ExpiresAt     *time.Time `gorm:"index" json:"expires_at"`
+	ReferenceType string     `json:"reference_type"`
+	ReferenceID   uint       `json:"reference_id"`
+	Description   string     `json:"description"`
+	CreatedAt     time.Time  `json:"created_at"`
+}
+
+// PointAllocation records how many points an entry that spent points took
+// from each lot, so they can be put back if the spending is undone.
+type PointAllocation struct {
+	ID      uint `gorm:"primaryKey"`
+	EntryID uint `gorm:"index"`
+	LotID   uint `gorm:"index"`
+	Points  int
+}
+
+type WishlistItem struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	UserID    uint      `gorm:"uniqueIndex:idx_wishlist_items_user_product" json:"user_id"`
+	ProductID uint      `gorm:"uniqueIndex:idx_wishlist_items_user_product;index" json:"product_id"`
+	CreatedAt time.Time `json:"created_at"`
+	Product   Product   `gorm:"foreignKey:ProductID;references:ID" json:"-"`
+}
+
+// Notification is an in-app message for a user, such as a wishlist alert.
+type Notification struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	UserID    uint       `gorm:"index" json:"user_id"`
+	Type      string     `json:"type"`
+	ProductID uint       `json:"product_id,omitempty"`
+	Message   string     `json:"message"`
+	ReadAt    *time.Time `json:"read_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// Reservation holds Quantity units of a product for a user's checkout until
+// ExpiresAt. Product.Reserved is the total of a product's active
+// reservations; both only change while the product row is locked.
+type Reservation struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	UserID    uint      `gorm:"index" json:"user_id"`
+	ProductID uint      `gorm:"index" json:"product_id"`
+	Quantity  int       `json:"quantity"`
+	Status    string    `gorm:"index" json:"status"`
+	ExpiresAt time.Time `gorm:"index" json:"expires_at"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// GiftCard is a prepaid code that credits Amount to the wallet of whoever
+// redeems it first. Only the hash of the code is stored.
+type GiftCard struct {
+	ID         uint       `gorm:"primaryKey" json:"id"`
+	BatchID    string     `gorm:"index" json:"batch_id"`
+	CodeHash   string     `gorm:"uniqueIndex" json:"-"`
+	Last4      string     `json:"last4"`
+	Amount     int        `json:"amount"` // minor units of Currency
+	Currency   string     `gorm:"size:3" json:"currency"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	CreatedBy  uint       `json:"created_by"`
+	RedeemedBy *uint      `gorm:"index" json:"redeemed_by"`
+	RedeemedAt *time.Time `json:"redeemed_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+}
+
+// GiftCardAttempt records a failed redemption so guessing codes can be
+// throttled per user and per client IP.
+type GiftCardAttempt struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	UserID    uint      `gorm:"index" json:"user_id"`
+	IP        string    `gorm:"index" json:"ip"`
+	CreatedAt time.Time `gorm:"index" json:"created_at"`
+}
+
+// SubscriptionPlan offers Quantity units of a product delivered every
+// IntervalDays days.
+type SubscriptionPlan struct {
+	ID           uint      `gorm:"primaryKey" json:"id"`
+	ProductID    uint      `gorm:"index" json:"product_id"`
+	Name         string    `json:"name"`
+	IntervalDays int       `gorm:"check:chk_subscription_plans_interval,interval_days > 0" json:"interval_days"`
+	Quantity     int       `gorm:"check:chk_subscription_plans_quantity,quantity > 0" json:"quantity"`
+	Active       bool      `gorm:"default:true" json:"active"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// Subscription places an order of its plan for the user every interval,
+// starting at NextRunAt. The plan's product, quantity and interval are copied
+// so later changes to the plan do not alter running subscriptions.
+type Subscription struct {
+	ID           uint   `gorm:"primaryKey" json:"id"`
+	UserID       uint   `gorm:"index" json:"user_id"`
+	PlanID       uint   `json:"plan_id"`
+	ProductID    uint   `json:"product_id"`
+	Quantity     int    `json:"quantity"`
+	IntervalDays int    `json:"interval_days"`
+	AddressID    uint   `json:"address_id"` // 0 ships to the default address, if any
+	Status       string `gorm:"index" json:"status"`
+	// NextRunAt is when the next order is placed.
+	NextRunAt   time.Time  `gorm:"index" json:"next_run_at"`
+	LastRunAt   *time.Time `json:"last_run_at"`
+	LastOrderID uint       `json:"last_order_id"`
+	LastError   string     `json:"last_error"`
+	CancelledAt *time.Time `json:"cancelled_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+// ProductReview is a customer's rating of a product they bought, one per
+// customer and product.
+type ProductReview struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	UserID    uint      `gorm:"uniqueIndex:idx_product_reviews_user_product" json:"user_id"`
+	ProductID uint      `gorm:"uniqueIndex:idx_product_reviews_user_product;index" json:"product_id"`
+	Rating    int       `gorm:"check:chk_product_reviews_rating,rating BETWEEN 1 AND 5" json:"rating"`
+	Comment   string    `json:"comment"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
 }
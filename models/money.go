@@ -0,0 +1,117 @@
+package models
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+)
+
+// BaseCurrency is the currency of wallets, the ledger and every amount that is
+// charged. Products priced in another currency are converted to it.
+const BaseCurrency = "IDR"
+
+type Currency struct {
+	Code        string
+	Symbol      string
+	Decimals    int
+	ThousandSep string
+	DecimalSep  string
+}
+
+var currencies = map[string]Currency{
+	"IDR": {Code: "IDR", Symbol: "Rp ", Decimals: 0, ThousandSep: ".", DecimalSep: ","},
+	"USD": {Code: "USD", Symbol: "$", Decimals: 2, ThousandSep: ",", DecimalSep: "."},
+	"EUR": {Code: "EUR", Symbol: "€", Decimals: 2, ThousandSep: ".", DecimalSep: ","},
+	"SGD": {Code: "SGD", Symbol: "S$", Decimals: 2, ThousandSep: ",", DecimalSep: "."},
+	"MYR": {Code: "MYR", Symbol: "RM", Decimals: 2, ThousandSep: ",", DecimalSep: "."},
+	"JPY": {Code: "JPY", Symbol: "¥", Decimals: 0, ThousandSep: ",", DecimalSep: "."},
+}
+
+func LookupCurrency(code string) (Currency, bool) {
+	currency, ok := currencies[strings.ToUpper(code)]
+	return currency, ok
+}
+
+// Money is an amount in the minor unit of its ISO 4217 currency, e.g. cents
+// for USD and whole rupiah for IDR.
+//
+// Amount columns are stored as plain integers of minor units next to the
+// currency they are in (Product.Price in Product.Currency, balances and totals
+// in BaseCurrency). The models' *Money methods pair them up, and arithmetic and
+// formatting of amounts go through Money rather than the bare ints.
+type Money struct {
+	Amount   int    `json:"amount"`
+	Currency string `json:"currency"`
+}
+
+func NewMoney(amount int, currency string) Money {
+	return Money{Amount: amount, Currency: strings.ToUpper(currency)}
+}
+
+// Add returns m + other. Both have to be in the same currency, amounts in
+// different currencies are converted first; mixing them is a bug and panics.
+func (m Money) Add(other Money) Money {
+	m.mustMatch(other)
+	return Money{Amount: m.Amount + other.Amount, Currency: m.Currency}
+}
+
+// Sub returns m - other, with the same currency rule as Add.
+func (m Money) Sub(other Money) Money {
+	m.mustMatch(other)
+	return Money{Amount: m.Amount - other.Amount, Currency: m.Currency}
+}
+
+func (m Money) mustMatch(other Money) {
+	if m.Currency != other.Currency {
+		panic("models: mixing " + m.Currency + " and " + other.Currency + " amounts")
+	}
+}
+
+func (m Money) Mul(quantity int) Money {
+	return Money{Amount: m.Amount * quantity, Currency: m.Currency}
+}
+
+// String formats the amount the way the currency is usually written,
+// e.g. "Rp 15.000" or "$1,234.50".
+func (m Money) String() string {
+	currency, ok := LookupCurrency(m.Currency)
+	if !ok {
+		return strconv.Itoa(m.Amount) + " " + m.Currency
+	}
+
+	amount := m.Amount
+	sign := ""
+	if amount < 0 {
+		sign = "-"
+		amount = -amount
+	}
+
+	digits := strconv.Itoa(amount)
+	if len(digits) <= currency.Decimals {
+		digits = strings.Repeat("0", currency.Decimals-len(digits)+1) + digits
+	}
+	whole := digits[:len(digits)-currency.Decimals]
+	fraction := digits[len(digits)-currency.Decimals:]
+
+	var grouped strings.Builder
+	for i, digit := range whole {
+		if i > 0 && (len(whole)-i)%3 == 0 {
+			grouped.WriteString(currency.ThousandSep)
+		}
+		grouped.WriteRune(digit)
+	}
+
+	formatted := sign + currency.Symbol + grouped.String()
+	if currency.Decimals > 0 {
+		formatted += currency.DecimalSep + fraction
+	}
+	return formatted
+}
+
+func (m Money) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Amount    int    `json:"amount"`
+		Currency  string `json:"currency"`
+		Formatted string `json:"formatted"`
+	}{m.Amount, m.Currency, m.String()})
+}
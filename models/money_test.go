@@ -0,0 +1,86 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestMoneyString(t *testing.T) {
+	tests := []struct {
+		money Money
+		want  string
+	}{
+		{NewMoney(15000, "IDR"), "Rp 15.000"},
+		{NewMoney(0, "IDR"), "Rp 0"},
+		{NewMoney(999, "IDR"), "Rp 999"},
+		{NewMoney(1234567, "idr"), "Rp 1.234.567"},
+		{NewMoney(-15000, "IDR"), "-Rp 15.000"},
+		{NewMoney(123450, "USD"), "$1,234.50"},
+		{NewMoney(5, "USD"), "$0.05"},
+		{NewMoney(50, "USD"), "$0.50"},
+		{NewMoney(100, "USD"), "$1.00"},
+		{NewMoney(0, "USD"), "$0.00"},
+		{NewMoney(-7, "USD"), "-$0.07"},
+		{NewMoney(123456, "EUR"), "€1.234,56"},
+		{NewMoney(100000000, "SGD"), "S$1,000,000.00"},
+		{NewMoney(1000000, "JPY"), "¥1,000,000"},
+		{NewMoney(100, "XYZ"), "100 XYZ"},
+	}
+	for _, tt := range tests {
+		if got := tt.money.String(); got != tt.want {
+			t.Errorf("%d %s formats as %q, want %q", tt.money.Amount, tt.money.Currency, got, tt.want)
+		}
+	}
+}
+
+func TestMoneyArithmetic(t *testing.T) {
+	a := NewMoney(1050, "USD")
+	b := NewMoney(325, "usd")
+
+	if got := a.Add(b); got != NewMoney(1375, "USD") {
+		t.Errorf("Add = %+v", got)
+	}
+	if got := a.Sub(b); got != NewMoney(725, "USD") {
+		t.Errorf("Sub = %+v", got)
+	}
+	if got := b.Sub(a); got != NewMoney(-725, "USD") {
+		t.Errorf("Sub below zero = %+v", got)
+	}
+	if got := a.Mul(3); got != NewMoney(3150, "USD") {
+		t.Errorf("Mul = %+v", got)
+	}
+	if a != NewMoney(1050, "USD") {
+		t.Errorf("arithmetic changed its receiver to %+v", a)
+	}
+}
+
+func TestMoneyCurrencyMismatch(t *testing.T) {
+	tests := []struct {
+		name string
+		op   func(a, b Money) Money
+	}{
+		{"Add", Money.Add},
+		{"Sub", Money.Sub},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s of IDR and USD did not panic", tt.name)
+				}
+			}()
+			tt.op(NewMoney(15000, "IDR"), NewMoney(100, "USD"))
+		})
+	}
+}
+
+func TestMoneyMarshalJSON(t *testing.T) {
+	encoded, err := json.Marshal(NewMoney(123450, "USD"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"amount":123450,"currency":"USD","formatted":"$1,234.50"}`
+	if string(encoded) != want {
+		t.Errorf("json = %s, want %s", encoded, want)
+	}
+}
@@ -0,0 +1,114 @@
+// Package testdb opens the database tests run against. Only tests import it,
+// so its drivers stay out of the server binary.
+//
+// Tests run on Postgres when TEST_DATABASE_URL is set, which they empty
+// first, and otherwise on a SQLite file of their own. SQLite serialises
+// writers and has no row locks, so only Postgres exercises the locking;
+// as packages share the database, run them one at a time with go test -p 1.
+package testdb
+
+import (
+	"main/models"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// Open returns an empty database with every model migrated.
+func Open(t testing.TB) *gorm.DB {
+	t.Helper()
+
+	config := &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)}
+	var db *gorm.DB
+	var err error
+	if url := os.Getenv("TEST_DATABASE_URL"); url != "" {
+		db, err = gorm.Open(postgres.Open(url), config)
+		if err == nil {
+			err = db.Exec("DROP SCHEMA public CASCADE; CREATE SCHEMA public").Error
+		}
+	} else {
+		// Writers queue up behind each other rather than failing with
+		// SQLITE_BUSY, the way they would wait for row locks on Postgres.
+		path := filepath.Join(t.TempDir(), "test.db")
+		db, err = gorm.Open(sqlite.Open(path+"?_busy_timeout=10000&_txlock=immediate&_foreign_keys=off"), config)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = db.AutoMigrate(
+		&models.User{},
+		&models.Category{},
+		&models.Product{},
+		&models.TransactionHistory{},
+		&models.PasswordReset{},
+		&models.WalletEntry{},
+		&models.JournalEntry{},
+		&models.JournalLine{},
+		&models.PaymentIntent{},
+		&models.IdempotencyKey{},
+		&models.Refund{},
+		&models.ExchangeRate{},
+		&models.CartItem{},
+		&models.Order{},
+		&models.OrderItem{},
+		&models.OrderStatusChange{},
+		&models.Address{},
+		&models.ShippingRate{},
+		&models.InvoiceSequence{},
+		&models.Coupon{},
+		&models.CouponRedemption{},
+		&models.Sale{},
+		&models.TaxClass{},
+		&models.PointEntry{},
+		&models.PointAllocation{},
+		&models.WishlistItem{},
+		&models.Notification{},
+		&models.Reservation{},
+		&models.GiftCard{},
+		&models.GiftCardAttempt{},
+		&models.SubscriptionPlan{},
+		&models.Subscription{},
+		&models.ProductReview{},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sqlDB.Close() })
+	return db
+}
+
+// CreateUser creates a user with the given role. Their balance is left at
+// zero, tests top it up through the ledger.
+func CreateUser(t testing.TB, db *gorm.DB, email string, role string) models.User {
+	t.Helper()
+	user := models.User{FullName: email, Email: email, Role: role}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+// CreateProduct creates product in a category of its own.
+func CreateProduct(t testing.TB, db *gorm.DB, product models.Product) models.Product {
+	t.Helper()
+	category := models.Category{Type: "Test " + product.Title}
+	if err := db.Create(&category).Error; err != nil {
+		t.Fatal(err)
+	}
+	product.CategoryID = category.ID
+	if err := db.Create(&product).Error; err != nil {
+		t.Fatal(err)
+	}
+	return product
+}